@@ -15,7 +15,9 @@ const peekBufferSize = 4096
 
 type boundaryReader struct {
 	finished  bool          // No parts remain when finished
+	truncated bool          // Reached EOF before the next boundary
 	partsRead int           // Number of parts read thus far
+	preamble  []byte        // Content preceding the first boundary
 	r         *bufio.Reader // Source reader
 	nlPrefix  []byte        // NL + MIME boundary prefix
 	prefix    []byte        // MIME boundary prefix
@@ -23,6 +25,28 @@ type boundaryReader struct {
 	buffer    *bytes.Buffer // Content waiting to be read
 }
 
+// maxBoundaryLen is the longest boundary permitted by RFC 2046.
+const maxBoundaryLen = 70
+
+// sniffBoundary returns the boundary of the first delimiter line, a line starting with "--", in
+// the content buffered by r, or "" if none is found.  r is not advanced.  It recovers multipart
+// content whose Content-Type lacks a boundary parameter.
+func sniffBoundary(r *bufio.Reader) string {
+	peek, _ := r.Peek(peekBufferSize)
+	for {
+		i := bytes.IndexByte(peek, '\n')
+		if i < 0 {
+			// Only complete lines are considered, the last may have been cut short by Peek
+			return ""
+		}
+		line := bytes.TrimRight(peek[:i], " \t\r")
+		peek = peek[i+1:]
+		if len(line) > 2 && len(line) <= maxBoundaryLen+2 && bytes.HasPrefix(line, []byte("--")) {
+			return string(line[2:])
+		}
+	}
+}
+
 // newBoundaryReader returns an initialized boundaryReader
 func newBoundaryReader(reader *bufio.Reader, boundary string) *boundaryReader {
 	fullBoundary := []byte("\n--" + boundary + "--")
@@ -43,10 +67,12 @@ func (b *boundaryReader) Read(dest []byte) (n int, err error) {
 	}
 
 	peek, err := b.r.Peek(peekBufferSize)
-	peekEOF := (err == io.EOF)
+	// A truncated parent part ends in io.ErrUnexpectedEOF
+	peekEOF := (err == io.EOF || err == io.ErrUnexpectedEOF)
+	var readErr error
 	if err != nil && !peekEOF && err != bufio.ErrBufferFull {
-		// Unexpected error
-		return 0, err
+		// Unexpected error, return it once the content peeked before it has been read
+		readErr = err
 	}
 	var nCopy int
 	idx, complete := locateBoundary(peek, b.nlPrefix)
@@ -58,13 +84,20 @@ func (b *boundaryReader) Read(dest []byte) (n int, err error) {
 			nCopy = 1
 		}
 	} else {
-		// No boundary found, move forward a safe distance
-		if nCopy = len(peek) - len(b.nlPrefix) - 1; nCopy <= 0 {
-			nCopy = 0
-			if peekEOF {
-				// No more peek space remaining and no boundary found
+		if peekEOF {
+			if len(bytes.TrimSpace(peek)) == 0 && b.buffer.Len() == 0 {
+				// No more content remaining and no boundary found
+				b.truncated = true
 				return 0, io.ErrUnexpectedEOF
 			}
+			// No boundary before EOF, the remaining content belongs to this part
+			nCopy = len(peek)
+		} else if readErr != nil {
+			// No more content can be peeked, the remaining content belongs to this part
+			nCopy = len(peek)
+		} else if nCopy = len(peek) - len(b.nlPrefix) - 1; nCopy <= 0 {
+			// No boundary found, move forward a safe distance
+			nCopy = 0
 		}
 	}
 	if nCopy > 0 {
@@ -74,6 +107,9 @@ func (b *boundaryReader) Read(dest []byte) (n int, err error) {
 	}
 
 	n, err = b.buffer.Read(dest)
+	if n == 0 && readErr != nil && !complete {
+		return 0, readErr
+	}
 	if err == io.EOF && !complete {
 		// Only the buffer is empty, not the boundaryReader
 		return n, nil
@@ -82,6 +118,7 @@ func (b *boundaryReader) Read(dest []byte) (n int, err error) {
 }
 
 // Next moves over the boundary to the next part, returns true if there is another part to be read.
+// Returns io.ErrUnexpectedEOF if the input ended before the boundary following the current part.
 func (b *boundaryReader) Next() (bool, error) {
 	if b.finished {
 		return false, nil
@@ -89,12 +126,25 @@ func (b *boundaryReader) Next() (bool, error) {
 	if b.partsRead > 0 {
 		// Exhaust the current part to prevent errors when moving to the next part
 		_, _ = io.Copy(ioutil.Discard, b)
+		if b.truncated {
+			b.finished = true
+			return false, io.ErrUnexpectedEOF
+		}
 	}
 	for {
 		line, err := b.r.ReadSlice('\n')
 		if err != nil && err != io.EOF {
 			return false, err
 		}
+		if b.partsRead == 0 && !bytes.HasPrefix(bytes.TrimLeft(line, " \t"), b.prefix) {
+			// Preamble in front of the first boundary, it may mention the boundary but only a line
+			// beginning with the boundary can start the first part
+			b.preamble = append(b.preamble, line...)
+			if err == io.EOF {
+				return false, io.EOF
+			}
+			continue
+		}
 		if len(line) > 0 && (line[0] == '\r' || line[0] == '\n') {
 			// Blank line
 			continue
@@ -112,8 +162,9 @@ func (b *boundaryReader) Next() (bool, error) {
 			return false, io.EOF
 		}
 		if b.partsRead == 0 {
-			// The first part didn't find the starting delimiter, burn off any preamble in front of
-			// the boundary
+			// The first part didn't find the starting delimiter, treat similar boundaries as
+			// preamble
+			b.preamble = append(b.preamble, line...)
 			continue
 		}
 		b.finished = true
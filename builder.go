@@ -239,27 +239,73 @@ func (p *MailBuilder) Build() (*Part, error) {
 	if len(p.to)+len(p.cc)+len(p.bcc) == 0 {
 		return nil, errors.New("no recipients (to, cc, bcc) set")
 	}
-	// Fully loaded structure; the presence of text, html, inlines, and attachments will determine
-	// how much is necessary:
-	//
-	//  multipart/mixed
-	//  |- multipart/related
-	//  |  |- multipart/alternative
-	//  |  |  |- text/plain
-	//  |  |  `- text/html
-	//  |  `- inlines..
-	//  `- attachments..
-	//
+	// Copy inline and attachment Parts to isolate mutations
+	inlines := make([]*Part, len(p.inlines))
+	for i, ip := range p.inlines {
+		part := &Part{}
+		*part = *ip
+		part.Header = make(textproto.MIMEHeader)
+		inlines[i] = part
+	}
+	attachments := make([]*Part, len(p.attachments))
+	for i, ap := range p.attachments {
+		part := &Part{}
+		*part = *ap
+		part.Header = make(textproto.MIMEHeader)
+		attachments[i] = part
+	}
+	root := buildPartTree(p.text, p.html, inlines, attachments)
+	// Headers
+	h := root.Header
+	h.Set(hnMIMEVersion, "1.0")
+	h.Set("From", p.from.String())
+	h.Set("Subject", p.subject)
+	if len(p.to) > 0 {
+		h.Set("To", stringutil.JoinAddress(p.to))
+	}
+	if len(p.cc) > 0 {
+		h.Set("Cc", stringutil.JoinAddress(p.cc))
+	}
+	if p.replyTo.Address != "" {
+		h.Set("Reply-To", p.replyTo.String())
+	}
+	date := p.date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	h.Set("Date", date.Format(time.RFC1123Z))
+	for k, v := range p.header {
+		for _, s := range v {
+			h.Add(k, s)
+		}
+	}
+	return root, nil
+}
+
+// buildPartTree constructs a tree of Parts from the provided bodies, inlines and attachments,
+// which are added to the tree as is.  A fully loaded structure is shown below, the presence of
+// text, html, inlines, and attachments will determine how much is necessary:
+//
+//	multipart/mixed
+//	|- multipart/related
+//	|  |- multipart/alternative
+//	|  |  |- text/plain
+//	|  |  `- text/html
+//	|  `- inlines..
+//	`- attachments..
+//
+// A text/plain Part is always present if html is nil.
+func buildPartTree(text, html []byte, inlines, attachments []*Part) *Part {
 	// We build this tree starting at the leaves, re-rooting as needed.
 	var root, part *Part
-	if p.text != nil || p.html == nil {
+	if text != nil || html == nil {
 		root = NewPart(nil, ctTextPlain)
-		root.Content = p.text
+		root.Content = text
 		root.Charset = utf8
 	}
-	if p.html != nil {
+	if html != nil {
 		part = NewPart(nil, ctTextHTML)
-		part.Content = p.html
+		part.Content = html
 		part.Charset = utf8
 		if root == nil {
 			root = part
@@ -267,61 +313,29 @@ func (p *MailBuilder) Build() (*Part, error) {
 			root.NextSibling = part
 		}
 	}
-	if p.text != nil && p.html != nil {
+	if text != nil && html != nil {
 		// Wrap Text & HTML bodies
 		part = root
 		root = NewPart(nil, ctMultipartAltern)
 		root.AddChild(part)
 	}
-	if len(p.inlines) > 0 {
+	if len(inlines) > 0 {
 		part = root
 		root = NewPart(nil, ctMultipartRelated)
 		root.AddChild(part)
-		for _, ip := range p.inlines {
-			// Copy inline Part to isolate mutations
-			part = &Part{}
-			*part = *ip
-			part.Header = make(textproto.MIMEHeader)
-			root.AddChild(part)
+		for _, ip := range inlines {
+			root.AddChild(ip)
 		}
 	}
-	if len(p.attachments) > 0 {
+	if len(attachments) > 0 {
 		part = root
 		root = NewPart(nil, ctMultipartMixed)
 		root.AddChild(part)
-		for _, ap := range p.attachments {
-			// Copy attachment Part to isolate mutations
-			part = &Part{}
-			*part = *ap
-			part.Header = make(textproto.MIMEHeader)
-			root.AddChild(part)
+		for _, ap := range attachments {
+			root.AddChild(ap)
 		}
 	}
-	// Headers
-	h := root.Header
-	h.Set(hnMIMEVersion, "1.0")
-	h.Set("From", p.from.String())
-	h.Set("Subject", p.subject)
-	if len(p.to) > 0 {
-		h.Set("To", stringutil.JoinAddress(p.to))
-	}
-	if len(p.cc) > 0 {
-		h.Set("Cc", stringutil.JoinAddress(p.cc))
-	}
-	if p.replyTo.Address != "" {
-		h.Set("Reply-To", p.replyTo.String())
-	}
-	date := p.date
-	if date.IsZero() {
-		date = time.Now()
-	}
-	h.Set("Date", date.Format(time.RFC1123Z))
-	for k, v := range p.header {
-		for _, s := range v {
-			h.Add(k, s)
-		}
-	}
-	return root, nil
+	return root
 }
 
 // Send encodes the message and sends it via the SMTP server specified by addr.  Send uses
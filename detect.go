@@ -13,6 +13,10 @@ func detectMultipartMessage(root *Part) bool {
 	if err != nil {
 		return false
 	}
+	if !strings.Contains(mediatype, "/") {
+		// A bare "multipart" is treated as multipart/mixed, see Part.setupHeaders
+		mediatype = defaultSubtype(mediatype)
+	}
 	// According to rfc2046#section-5.1.7 all other multipart should
 	// be treated as multipart/mixed
 	return strings.HasPrefix(mediatype, ctMultipartPrefix)
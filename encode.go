@@ -8,6 +8,7 @@ import (
 	"mime/quotedprintable"
 	"net/textproto"
 	"sort"
+	"strings"
 
 	"github.com/jhillyerd/enmime/internal/coding"
 	"github.com/jhillyerd/enmime/internal/stringutil"
@@ -17,22 +18,71 @@ import (
 // from quoted-printable to base64 encoding.
 const b64Percent = 20
 
+// maxLineLen is the longest line, excluding CRLF, permitted in 7bit content by RFC 5322.
+const maxLineLen = 998
+
 type transferEncoding byte
 
 const (
 	te7Bit transferEncoding = iota
+	te8Bit
 	teQuoted
 	teBase64
 )
 
+// String returns the Content-Transfer-Encoding header value for te.
+func (te transferEncoding) String() string {
+	switch te {
+	case te8Bit:
+		return cte8Bit
+	case teQuoted:
+		return cteQuotedPrintable
+	case teBase64:
+		return cteBase64
+	}
+	return cte7Bit
+}
+
 var crnl = []byte{'\r', '\n'}
 
-// Encode writes this Part and all its children to the specified writer in MIME format.
+// Encode writes this Part and all its children to the specified writer in MIME format.  Lines end
+// in CRLF, unless LineEnding is "\n", in which case every CRLF written is converted to LF to match
+// the style of the parsed message.
+//
+// The content of each Part is encoded with its TransferEncoding, as read by the parser, to keep
+// re-encoded messages close to the original.  A Part is encoded as selected by
+// SelectTransferEncoding instead if its TransferEncoding is empty, is not 7bit, 8bit,
+// quoted-printable or base64, or cannot represent its Content, such as 7bit for non-ASCII text.
 func (p *Part) Encode(writer io.Writer) error {
+	return p.encodeTree(writer, false)
+}
+
+// EncodeOptimized writes this Part and all its children to the specified writer in MIME format
+// like Encode, but ignores TransferEncoding, encoding the content of every Part as selected by
+// SelectTransferEncoding.
+func (p *Part) EncodeOptimized(writer io.Writer) error {
+	return p.encodeTree(writer, true)
+}
+
+// encodeTree writes this Part and all its children to the specified writer, converting line
+// endings as LineEnding requires.  If optimize is set TransferEncoding is ignored.
+func (p *Part) encodeTree(writer io.Writer, optimize bool) error {
+	if p.LineEnding != "\n" {
+		return p.encode(writer, optimize)
+	}
+	lw := coding.NewLFWriter(writer)
+	if err := p.encode(lw, optimize); err != nil {
+		return err
+	}
+	return lw.Flush()
+}
+
+// encode writes this Part and all its children to the specified writer with CRLF line endings.
+func (p *Part) encode(writer io.Writer, optimize bool) error {
 	if p.Header == nil {
 		p.Header = make(textproto.MIMEHeader)
 	}
-	cte := p.setupMIMEHeaders()
+	cte := p.setupMIMEHeaders(optimize)
 	// Encode this part.
 	b := bufio.NewWriter(writer)
 	p.encodeHeader(b)
@@ -43,7 +93,8 @@ func (p *Part) Encode(writer io.Writer) error {
 		}
 		b.Write(crnl)
 	}
-	if p.FirstChild == nil {
+	if p.FirstChild == nil || p.FirstChild.Encapsulated {
+		// Encapsulated messages are encoded as Content.
 		return b.Flush()
 	}
 	// Encode children.
@@ -53,7 +104,7 @@ func (p *Part) Encode(writer io.Writer) error {
 	for c != nil {
 		b.Write(marker)
 		b.Write(crnl)
-		if err := c.Encode(b); err != nil {
+		if err := c.encode(b, optimize); err != nil {
 			return err
 		}
 		c = c.NextSibling
@@ -63,29 +114,99 @@ func (p *Part) Encode(writer io.Writer) error {
 	return b.Flush()
 }
 
+// Encode writes a message rebuilt from the Text, HTML, Inlines, Attachments and OtherParts of this
+// Envelope to the specified writer in MIME format, so that changes made to those fields are
+// reflected in the result.  The multipart structure is chosen as by MailBuilder.Build, with
+// OtherParts following the Attachments.  Text parts are re-encoded as UTF-8.
+//
+// The headers of Root, other than its Content-* headers, are used as the message headers; all
+// other changes made to the Part tree of Root are ignored, the Envelope fields take precedence.
+// Text downconverted from HTML is encoded as a text/plain body, and Parts whose content was
+// streamed are encoded without content.  Line endings follow the LineEnding of Root.
+func (e *Envelope) Encode(w io.Writer) error {
+	var text, html []byte
+	if e.Text != "" {
+		text = []byte(e.Text)
+	}
+	if e.HTML != "" {
+		html = []byte(e.HTML)
+	}
+	inlines := make([]*Part, 0, len(e.Inlines))
+	for _, p := range e.Inlines {
+		inlines = append(inlines, p.encodableCopy())
+	}
+	attachments := make([]*Part, 0, len(e.Attachments)+len(e.OtherParts))
+	for _, p := range e.Attachments {
+		attachments = append(attachments, p.encodableCopy())
+	}
+	for _, p := range e.OtherParts {
+		attachments = append(attachments, p.encodableCopy())
+	}
+	root := buildPartTree(text, html, inlines, attachments)
+	if e.Root != nil {
+		for k, v := range e.Root.Header {
+			if strings.HasPrefix(strings.ToLower(k), "content-") || strings.EqualFold(k, hnMIMEVersion) {
+				// Describes the original structure
+				continue
+			}
+			root.Header[k] = append([]string(nil), v...)
+		}
+	}
+	root.Header.Set(hnMIMEVersion, "1.0")
+	if e.Root != nil {
+		root.LineEnding = e.Root.LineEnding
+	}
+	return root.Encode(w)
+}
+
+// encodableCopy returns a copy of p without relatives for encoding into a new Part tree.  Its
+// Header is copied, less the headers describing the encoding of the original content, which do
+// not apply to the decoded Content.
+func (p *Part) encodableCopy() *Part {
+	c := &Part{}
+	*c = *p
+	c.Parent = nil
+	c.FirstChild = nil
+	c.NextSibling = nil
+	c.Boundary = ""
+	c.Header = make(textproto.MIMEHeader, len(p.Header))
+	for k, v := range p.Header {
+		c.Header[k] = append([]string(nil), v...)
+	}
+	c.Header.Del(hnContentEncoding)
+	c.Header.Del(hnHTTPContentEncoding)
+	if c.TextContent() {
+		// Content was converted to UTF-8
+		c.Charset = utf8
+	}
+	return c
+}
+
 // setupMIMEHeaders determines content transfer encoding, generates a boundary string if required,
 // then sets the Content-Type (type, charset, filename, boundary) and Content-Disposition headers.
-func (p *Part) setupMIMEHeaders() transferEncoding {
+// Other params parsed from these headers are carried over.
+// Unless optimize is set, the TransferEncoding of p is used when possible.
+func (p *Part) setupMIMEHeaders(optimize bool) transferEncoding {
 	// Determine content transfer encoding.
-	cte := te7Bit
+	cte := contentTransferEncoding(p.Content, p.ContentType)
+	if !optimize {
+		if preserved, ok := p.preservedTransferEncoding(cte); ok {
+			cte = preserved
+		}
+	}
 	if len(p.Content) > 0 {
-		cte = teBase64
-		if p.TextContent() {
-			cte = selectTransferEncoding(p.Content, false)
-			if p.Charset == "" {
-				p.Charset = utf8
-			}
+		if p.TextContent() && p.Charset == "" {
+			p.Charset = utf8
 		}
 		// RFC 2045: 7bit is assumed if CTE header not present.
-		switch cte {
-		case teBase64:
-			p.Header.Set(hnContentEncoding, cteBase64)
-		case teQuoted:
-			p.Header.Set(hnContentEncoding, cteQuotedPrintable)
+		if cte != te7Bit {
+			p.Header.Set(hnContentEncoding, cte.String())
+		} else {
+			p.Header.Del(hnContentEncoding)
 		}
 	}
 	// Setup headers.
-	if p.FirstChild != nil && p.Boundary == "" {
+	if p.FirstChild != nil && !p.FirstChild.Encapsulated && p.Boundary == "" {
 		// Multipart, generate random boundary marker.
 		p.Boundary = "enmime-" + stringutil.UUID()
 	}
@@ -93,8 +214,13 @@ func (p *Part) setupMIMEHeaders() transferEncoding {
 		p.Header.Set(hnContentID, coding.ToIDHeader(p.ContentID))
 	}
 	if p.ContentType != "" {
-		// Build content type header.
-		param := make(map[string]string)
+		// Build content type header.  Params represented by fields of p are set from them.
+		param := copyParams(p.ContentTypeParams, hpCharset, hpName, hpBoundary)
+		if p.ContentType == ctTextPlain && strings.EqualFold(param[hpFormat], "flowed") {
+			// Soft line breaks were removed from Content when it was decoded
+			delete(param, hpFormat)
+			delete(param, hpDelSp)
+		}
 		setParamValue(param, hpCharset, p.Charset)
 		setParamValue(param, hpName, stringutil.ToASCII(p.FileName))
 		setParamValue(param, hpBoundary, p.Boundary)
@@ -107,7 +233,7 @@ func (p *Part) setupMIMEHeaders() transferEncoding {
 	}
 	if p.Disposition != "" {
 		// Build disposition header.
-		param := make(map[string]string)
+		param := copyParams(p.DispositionParams, hpFilename)
 		setParamValue(param, hpFilename, stringutil.ToASCII(p.FileName))
 		mt := mime.FormatMediaType(p.Disposition, param)
 		if mt == "" {
@@ -119,6 +245,42 @@ func (p *Part) setupMIMEHeaders() transferEncoding {
 	return cte
 }
 
+// preservedTransferEncoding returns the encoding named by the TransferEncoding of p, if it is
+// supported and able to represent the Content of p.  selected is the encoding chosen for the
+// Content by contentTransferEncoding.
+func (p *Part) preservedTransferEncoding(selected transferEncoding) (transferEncoding, bool) {
+	switch p.TransferEncoding {
+	case cte7Bit:
+		return te7Bit, selected == te7Bit
+	case cte8Bit:
+		return te8Bit, selected == te7Bit || valid8Bit(p.Content)
+	case cteQuotedPrintable, cteXQuotedPrintable:
+		return teQuoted, !requiresIdentityEncoding(p.ContentType)
+	case cteBase64, cteXBase64:
+		return teBase64, !requiresIdentityEncoding(p.ContentType)
+	}
+	return te7Bit, false
+}
+
+// valid8Bit indicates whether content may be sent as 8bit: it has no NUL bytes, and no lines
+// longer than 998 bytes, RFC 2045.
+func valid8Bit(content []byte) bool {
+	lineLen := 0
+	for _, b := range content {
+		switch b {
+		case 0:
+			return false
+		case '\r', '\n':
+			lineLen = 0
+		default:
+			if lineLen++; lineLen > maxLineLen {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 // encodeHeader writes out a sorted list of headers.
 func (p *Part) encodeHeader(b *bufio.Writer) {
 	keys := make([]string, 0, len(p.Header))
@@ -129,7 +291,7 @@ func (p *Part) encodeHeader(b *bufio.Writer) {
 	for _, k := range keys {
 		for _, v := range p.Header[k] {
 			encv := v
-			switch selectTransferEncoding([]byte(v), true) {
+			switch selectHeaderEncoding(v) {
 			case teBase64:
 				encv = mime.BEncoding.Encode(utf8, v)
 			case teQuoted:
@@ -174,19 +336,47 @@ func (p *Part) encodeContent(b *bufio.Writer, cte transferEncoding) (err error)
 	return err
 }
 
-// selectTransferEncoding scans content for non-ASCII characters and selects 'b' or 'q' encoding.
-func selectTransferEncoding(content []byte, quoteLineBreaks bool) transferEncoding {
+// SelectTransferEncoding returns the Content-Transfer-Encoding Encode uses for content of the
+// specified content type: "7bit", "8bit", "quoted-printable" or "base64".  Non-text content is
+// always base64, and message/rfc822 content is never encoded, per RFC 2046.  Text content is 7bit
+// if it is entirely printable ASCII in lines of at most 998 bytes, base64 if more than 20 percent
+// of its bytes are not printable ASCII, and quoted-printable otherwise.  CR, LF and tab are
+// counted as printable.  Empty content is 7bit.
+func SelectTransferEncoding(content []byte, contentType string) string {
+	return contentTransferEncoding(content, contentType).String()
+}
+
+// contentTransferEncoding selects the encoding for content of the specified content type, see
+// SelectTransferEncoding.
+func contentTransferEncoding(content []byte, contentType string) transferEncoding {
 	if len(content) == 0 {
 		return te7Bit
 	}
+	ctype := strings.ToLower(contentType)
+	switch {
+	case textContentType(ctype):
+		return selectTransferEncoding(content)
+	case ctype == ctMessageRFC822:
+		// RFC 2046: message/rfc822 content may not be encoded.
+		if selectTransferEncoding(content) != te7Bit {
+			return te8Bit
+		}
+		return te7Bit
+	}
+	return teBase64
+}
+
+// selectHeaderEncoding scans a header value for non-ASCII characters and selects 'b' or 'q'
+// encoding for it.  Line breaks are counted as non-ASCII.
+func selectHeaderEncoding(value string) transferEncoding {
+	if len(value) == 0 {
+		return te7Bit
+	}
 	// Binary chars remaining before we choose b64 encoding.
-	threshold := b64Percent * 100 / len(content)
+	threshold := b64Percent * 100 / len(value)
 	bincount := 0
-	for _, b := range content {
-		if (b < ' ' || '~' < b) && b != '\t' {
-			if !quoteLineBreaks && (b == '\r' || b == '\n') {
-				continue
-			}
+	for i := 0; i < len(value); i++ {
+		if b := value[i]; (b < ' ' || '~' < b) && b != '\t' {
 			bincount++
 			if bincount >= threshold {
 				return teBase64
@@ -199,7 +389,49 @@ func selectTransferEncoding(content []byte, quoteLineBreaks bool) transferEncodi
 	return teQuoted
 }
 
+// selectTransferEncoding scans content for non-ASCII characters and selects 'b' or 'q' encoding.
+// Lines too long for 7bit content also select 'q' encoding.
+func selectTransferEncoding(content []byte) transferEncoding {
+	if len(content) == 0 {
+		return te7Bit
+	}
+	bincount := 0
+	lineLen := 0
+	longLines := false
+	for _, b := range content {
+		if b == '\r' || b == '\n' {
+			lineLen = 0
+			continue
+		}
+		if lineLen++; lineLen > maxLineLen {
+			longLines = true
+		}
+		if (b < ' ' || '~' < b) && b != '\t' {
+			bincount++
+		}
+	}
+	if bincount*100 > len(content)*b64Percent {
+		return teBase64
+	}
+	if bincount == 0 && !longLines {
+		return te7Bit
+	}
+	return teQuoted
+}
+
 // setParamValue will ignore empty values
+// copyParams returns a copy of params without the keys in omit.
+func copyParams(params map[string]string, omit ...string) map[string]string {
+	c := make(map[string]string, len(params))
+	for k, v := range params {
+		c[k] = v
+	}
+	for _, k := range omit {
+		delete(c, k)
+	}
+	return c
+}
+
 func setParamValue(p map[string]string, k, v string) {
 	if v != "" {
 		p[k] = v
@@ -2,6 +2,9 @@ package enmime_test
 
 import (
 	"bytes"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/jhillyerd/enmime"
@@ -130,6 +133,24 @@ func TestEncodePartWithChildren(t *testing.T) {
 	test.DiffGolden(t, b.Bytes(), "testdata", "encode", "part-with-children.golden")
 }
 
+func TestEncodePartEncapsulated(t *testing.T) {
+	root := enmime.NewPart(nil, "message/rfc822")
+	root.Disposition = "attachment"
+	root.Content = []byte("Subject: Inner\r\n\r\nInner message")
+
+	p := enmime.NewPart(root, "text/plain")
+	p.Encapsulated = true
+	p.Content = []byte("Inner message")
+	root.FirstChild = p
+
+	b := &bytes.Buffer{}
+	err := root.Encode(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.DiffGolden(t, b.Bytes(), "testdata", "encode", "part-encapsulated.golden")
+}
+
 func TestEncodePartNoContentWithChildren(t *testing.T) {
 	p := enmime.NewPart(nil, "multipart/alternative")
 	p.Boundary = "enmime-1234567890-parent"
@@ -178,3 +199,241 @@ func TestEncodePartContentBinary(t *testing.T) {
 	}
 	test.DiffGolden(t, b.Bytes(), "testdata", "encode", "part-bin-content.golden")
 }
+
+func TestSelectTransferEncoding(t *testing.T) {
+	ttable := []struct {
+		name    string
+		content string
+		ctype   string
+		want    string
+	}{
+		{"empty", "", "image/png", "7bit"},
+		{"ascii", "Hello\r\nWorld\r\n", "text/plain", "7bit"},
+		{"no content type", "Hello", "", "7bit"},
+		{"long line", strings.Repeat("x", 999), "text/plain", "quoted-printable"},
+		{"longest line", strings.Repeat("x", 998) + "\r\n", "text/plain", "7bit"},
+		{"some 8bit", "¡Hola, señor! Welcome to MIME", "text/plain", "quoted-printable"},
+		{"20 percent 8bit", "éé" + strings.Repeat("x", 16), "text/plain", "quoted-printable"},
+		{"over 20 percent 8bit", "éé" + strings.Repeat("x", 15), "text/plain", "base64"},
+		{"control chars", "\x00\x01\x02\x03", "text/html", "base64"},
+		{"binary", "GIF89a", "image/gif", "base64"},
+		{"message", "Subject: Hi\r\n\r\nHello", "message/rfc822", "7bit"},
+		{"message 8bit", "Subject: Hi\r\n\r\nCafé", "message/rfc822", "8bit"},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			got := enmime.SelectTransferEncoding([]byte(tt.content), tt.ctype)
+			if got != tt.want {
+				t.Errorf("got: %q, want: %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeEnvelope(t *testing.T) {
+	root, err := enmime.Builder().
+		From("Sender", "sender@example.com").
+		To("Recipient", "recipient@example.com").
+		Subject("Café report").
+		Header("X-Custom", "retained").
+		Text([]byte("Text body")).
+		HTML([]byte("<p>HTML body <img src=\"cid:logo@example.com\"></p>")).
+		AddInline([]byte{0x89, 'P', 'N', 'G'}, "image/png", "logo.png", "logo@example.com").
+		AddAttachment([]byte("%PDF-1.4"), "application/pdf", "report.pdf").
+		AddAttachment([]byte("Café notes"), "text/plain", "notes.txt").
+		Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &bytes.Buffer{}
+	if err := root.Encode(b); err != nil {
+		t.Fatal(err)
+	}
+	e, err := enmime.ReadEnvelope(b)
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+	if len(e.Attachments) != 2 {
+		t.Fatalf("len(Attachments) got: %v, want: 2", len(e.Attachments))
+	}
+
+	// Drop the first attachment and replace the HTML body
+	e.Attachments = e.Attachments[1:]
+	e.HTML = "<p>New HTML body <img src=\"cid:logo@example.com\"></p>"
+	b = &bytes.Buffer{}
+	if err := e.Encode(b); err != nil {
+		t.Fatal(err)
+	}
+	e, err = enmime.ReadEnvelope(b)
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+
+	if got, want := e.GetHeader("Subject"), "Café report"; got != want {
+		t.Errorf("Subject got: %q, want: %q", got, want)
+	}
+	if got, want := e.GetHeader("X-Custom"), "retained"; got != want {
+		t.Errorf("X-Custom got: %q, want: %q", got, want)
+	}
+	if got, want := e.Root.ContentType, "multipart/mixed"; got != want {
+		t.Errorf("Root ContentType got: %q, want: %q", got, want)
+	}
+	// Each Part.Encode adds a line break to the content
+	if got, want := strings.TrimSpace(e.Text), "Text body"; got != want {
+		t.Errorf("Text got: %q, want: %q", got, want)
+	}
+	want := "<p>New HTML body <img src=\"cid:logo@example.com\"></p>"
+	if got := strings.TrimSpace(e.HTML); got != want {
+		t.Errorf("HTML got: %q, want: %q", got, want)
+	}
+	if len(e.Attachments) != 1 {
+		t.Fatalf("len(Attachments) got: %v, want: 1", len(e.Attachments))
+	}
+	a := e.Attachments[0]
+	if a.FileName != "notes.txt" {
+		t.Errorf("Attachment FileName got: %q, want: %q", a.FileName, "notes.txt")
+	}
+	test.ContentEqualsString(t, bytes.TrimSpace(a.Content), "Café notes")
+	if len(e.Inlines) != 1 {
+		t.Fatalf("len(Inlines) got: %v, want: 1", len(e.Inlines))
+	}
+	if got, want := e.Inlines[0].ContentID, "logo@example.com"; got != want {
+		t.Errorf("Inline ContentID got: %q, want: %q", got, want)
+	}
+	if len(e.Errors) != 0 {
+		t.Errorf("Errors got: %v, want none", e.Errors)
+	}
+}
+
+func TestEncodePreservesTransferEncoding(t *testing.T) {
+	msg := "Content-Type: multipart/mixed; boundary=Enmime-Test\r\n" +
+		"\r\n" +
+		"--Enmime-Test\r\n" +
+		"Content-Type: text/plain; charset=us-ascii\r\n" +
+		"Content-Transfer-Encoding: Base64 (plain ASCII)\r\n" +
+		"\r\n" +
+		"UGxhaW4gdGV4dA==\r\n" +
+		"--Enmime-Test\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: 7bit\r\n" +
+		"\r\n" +
+		"Café au lait\r\n" +
+		"--Enmime-Test\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Data=3D\r\n" +
+		"--Enmime-Test--\r\n"
+	p, err := enmime.ReadParts(strings.NewReader(msg))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	var got []string
+	for c := p.FirstChild; c != nil; c = c.NextSibling {
+		got = append(got, c.TransferEncoding)
+	}
+	want := "base64 7bit quoted-printable"
+	if strings.Join(got, " ") != want {
+		t.Errorf("TransferEncoding got: %v, want: %v", got, want)
+	}
+
+	ttable := []struct {
+		name   string
+		encode func(p *enmime.Part, w io.Writer) error
+		want   string
+	}{
+		// 7bit cannot represent non-ASCII text, so it is replaced
+		{"preserved", (*enmime.Part).Encode, "base64 quoted-printable quoted-printable"},
+		{"optimized", (*enmime.Part).EncodeOptimized, " quoted-printable base64"},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			c := p.Clone()
+			b := &bytes.Buffer{}
+			if err := tt.encode(c, b); err != nil {
+				t.Fatal("Encode returned error:", err)
+			}
+			e, err := enmime.ReadParts(b)
+			if err != nil {
+				t.Fatal("Unexpected parse error:", err)
+			}
+			var got []string
+			for c := e.FirstChild; c != nil; c = c.NextSibling {
+				got = append(got, c.TransferEncoding)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("TransferEncoding got: %q, want: %q", strings.Join(got, " "), tt.want)
+			}
+			c = e.FirstChild
+			test.ContentContainsString(t, c.Content, "Plain text")
+			test.ContentContainsString(t, c.NextSibling.Content, "Café")
+			test.ContentContainsString(t, c.NextSibling.NextSibling.Content, "Data=")
+		})
+	}
+}
+
+func TestEncodePreservesParams(t *testing.T) {
+	r := test.OpenTestData("parts", "signed.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	b := &bytes.Buffer{}
+	if err := p.Encode(b); err != nil {
+		t.Fatal("Encode returned error:", err)
+	}
+	p, err = enmime.ReadParts(b)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	if got, want := p.ContentType, "multipart/signed"; got != want {
+		t.Errorf("ContentType got: %q, want: %q", got, want)
+	}
+	for k, want := range map[string]string{
+		"protocol": "application/pgp-signature",
+		"micalg":   "pgp-sha256",
+	} {
+		if got := p.ContentTypeParams[k]; got != want {
+			t.Errorf("ContentTypeParams[%q] got: %q, want: %q", k, got, want)
+		}
+	}
+	sig := p.FirstChild.NextSibling
+	if sig == nil || sig.ContentType != "application/pgp-signature" {
+		t.Fatalf("Signature Part got: %+v, want application/pgp-signature", sig)
+	}
+	if got, want := sig.FileName, "signature.asc"; got != want {
+		t.Errorf("FileName got: %q, want: %q", got, want)
+	}
+}
+
+func TestEncodeFlowedParams(t *testing.T) {
+	msg := "Content-Type: text/plain; charset=us-ascii; format=flowed; delsp=yes\r\n" +
+		"Content-Disposition: inline; size=13\r\n" +
+		"\r\n" +
+		"Soft wrap- \r\n" +
+		"ped\r\n"
+	p, err := enmime.ReadParts(strings.NewReader(msg))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	b := &bytes.Buffer{}
+	if err := p.Encode(b); err != nil {
+		t.Fatal("Encode returned error:", err)
+	}
+	p, err = enmime.ReadParts(b)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	test.ContentContainsString(t, p.Content, "Soft wrap-ped\r\n")
+	want := map[string]string{"charset": "us-ascii"}
+	if !reflect.DeepEqual(p.ContentTypeParams, want) {
+		t.Errorf("ContentTypeParams got: %v, want: %v", p.ContentTypeParams, want)
+	}
+	if got, want := p.DispositionParams["size"], "13"; got != want {
+		t.Errorf("DispositionParams[size] got: %q, want: %q", got, want)
+	}
+}
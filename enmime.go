@@ -16,7 +16,10 @@
 //
 // If the part was encoded in quoted-printable or base64, it is decoded prior to being placed in
 // Content.  If the Part contains text in a character set other than utf-8, enmime will attempt to
-// convert it to utf-8.
+// convert it to utf-8.  Text Parts that do not declare a character set will have it detected.
+//
+// ReadParts and ReadEnvelope use the default parsing options, to customize them create a Parser
+// with NewParser, adjust its fields, and call its ReadParts or ReadEnvelope methods.
 //
 // To locate a particular Part, pass a custom PartMatcher function into the BreadthMatchFirst() or
 // DepthMatchFirst() methods to search the Part tree.  BreadthMatchAll() and DepthMatchAll() will
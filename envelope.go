@@ -5,7 +5,9 @@ import (
 	"io"
 	"net/mail"
 	"net/textproto"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/jaytaylor/html2text"
 	"github.com/jhillyerd/enmime/internal/coding"
@@ -17,19 +19,54 @@ type Envelope struct {
 	HTML        string                // The HTML portion of the message
 	Root        *Part                 // The top-level Part
 	Attachments []*Part               // All parts having a Content-Disposition of attachment
-	Inlines     []*Part               // All parts having a Content-Disposition of inline
+	Inlines     []*Part               // Parts with an inline disposition, other than bodies
 	OtherParts  []*Part               // All parts not in Attachments and Inlines
 	Errors      []*Error              // Errors encountered while parsing
 	header      *textproto.MIMEHeader // Header from original message
 }
 
+// TextContentTypes is the set of media types, outside of the text/ type, that TextParts considers
+// to hold text.  Keys containing "*" are MatchMediaType patterns, so XML and JSON based formats
+// such as application/vnd.api+json are included.  It may be modified to suit the messages being
+// processed, but not concurrently with calls to TextParts.  Keys must be all lowercase.
+var TextContentTypes = map[string]bool{
+	"application/xhtml+xml":   true,
+	"application/xml":         true,
+	"application/json":        true,
+	"application/*+xml":       true,
+	"application/*+json":      true,
+	"message/delivery-status": true,
+}
+
+// isTextContentType indicates whether the media type ctype holds text, per TextContentTypes.
+func isTextContentType(ctype string) bool {
+	if strings.HasPrefix(ctype, ctTextPrefix) || TextContentTypes[ctype] {
+		return true
+	}
+	for pattern, ok := range TextContentTypes {
+		if ok && strings.Contains(pattern, "*") && MatchMediaType(ctype, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// AttachmentMeta describes an attachment without its content, see Envelope.AttachmentInfo.
+type AttachmentMeta struct {
+	FileName    string // The file-name from disposition or type header
+	ContentType string // ContentType header without parameters
+	ContentID   string // ContentID header for cid URL scheme
+	Disposition string // Content-Disposition header without parameters
+	Size        int    // Length of the decoded content in bytes, -1 if it was streamed
+}
+
 // GetHeader processes the specified header for RFC 2047 encoded words and returns the result as a
 // UTF-8 string
 func (e *Envelope) GetHeader(name string) string {
 	if e.header == nil {
 		return ""
 	}
-	return decodeHeader(e.header.Get(name))
+	return decodeHeader(unfoldHeader(e.header.Get(name)))
 }
 
 // AddressList returns a mail.Address slice with RFC 2047 encoded names converted to UTF-8
@@ -55,17 +92,275 @@ func (e *Envelope) AddressList(key string) ([]*mail.Address, error) {
 	return ret, nil
 }
 
+// Subject returns the Subject header of the message, decoded to UTF-8.
+func (e *Envelope) Subject() string {
+	return e.GetHeader("Subject")
+}
+
+// From returns the addresses in the From header of the message, or nil if the header is missing
+// or cannot be parsed.  Use AddressList to determine the cause.
+func (e *Envelope) From() []*mail.Address {
+	addrs, _ := e.AddressList("From")
+	return addrs
+}
+
+// To returns the addresses in the To header of the message, or nil if the header is missing or
+// cannot be parsed.  Use AddressList to determine the cause.
+func (e *Envelope) To() []*mail.Address {
+	addrs, _ := e.AddressList("To")
+	return addrs
+}
+
+// Date parses the Date header of the message.  In addition to RFC 5322 dates, several
+// non-standard formats produced by mail software are accepted.  Returns mail.ErrHeaderNotPresent if
+// there is no Date header.
+func (e *Envelope) Date() (time.Time, error) {
+	if e.header == nil {
+		return time.Time{}, mail.ErrHeaderNotPresent
+	}
+	value := e.header.Get("Date")
+	if value == "" {
+		return time.Time{}, mail.ErrHeaderNotPresent
+	}
+	return parseDate(value)
+}
+
+// AttachmentInfo returns a description of each Part in Attachments, in the same order, for when
+// only a manifest of the attachments is needed.
+func (e *Envelope) AttachmentInfo() []AttachmentMeta {
+	meta := make([]AttachmentMeta, 0, len(e.Attachments))
+	for _, p := range e.Attachments {
+		meta = append(meta, AttachmentMeta{
+			FileName:    p.FileName,
+			ContentType: p.ContentType,
+			ContentID:   p.ContentID,
+			Disposition: p.Disposition,
+			Size:        p.ContentLength(),
+		})
+	}
+	return meta
+}
+
+// TextParts returns the Parts of the message that hold text and are not attachments, in depth
+// first order.  This includes all text/ types, such as text/calendar, in addition to those listed
+// in TextContentTypes, so it may contain body text missed by the Text and HTML fields.  Parts of
+// encapsulated messages are excluded.
+func (e *Envelope) TextParts() []*Part {
+	if e.Root == nil {
+		return nil
+	}
+	return e.Root.DepthMatchAll(func(p *Part) bool {
+		if p.FirstChild != nil || p.attachmentDisposition() || withinEncapsulated(e.Root, p) {
+			return false
+		}
+		return isTextContentType(p.ContentType)
+	})
+}
+
+// AllText returns the decoded content of every text Part in the message joined together, for
+// full-text search indexing.  Unlike TextParts, attachments and the Parts of parsed encapsulated
+// messages are included, so this is a superset of the Text field.  A Part holds text if its type is
+// text/ or listed in TextContentTypes.  Tags are stripped from HTML and XHTML, which is not
+// rendered.  Parts are joined in depth first order, separated by "\n--\n".
+func (e *Envelope) AllText() string {
+	if e.Root == nil {
+		return ""
+	}
+	parts := e.Root.DepthMatchAll(func(p *Part) bool {
+		if p.FirstChild != nil || len(p.Content) == 0 {
+			return false
+		}
+		return isTextContentType(p.ContentType)
+	})
+	texts := make([]string, 0, len(parts))
+	for _, p := range parts {
+		text := string(p.Content)
+		if p.ContentType == ctTextHTML || p.ContentType == ctAppXHTML {
+			text = stripHTMLTags(text)
+		}
+		if text != "" {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "\n--\n")
+}
+
+// PreviewText returns a short plain text summary of the message body for display in
+// notifications.  It is the Text body, or if the message has no text/plain body, the HTML body
+// with its tags stripped and character references decoded.  Whitespace, including line breaks, is
+// collapsed to single spaces.  The result is truncated to at most maxLen runes, at a word boundary
+// where possible; a maxLen of zero or less does not limit it.
+func (e *Envelope) PreviewText(maxLen int) string {
+	text := e.Text
+	if e.HTML != "" && (text == "" || e.textFromHTML()) {
+		text = stripHTMLTags(e.HTML)
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if maxLen <= 0 {
+		return text
+	}
+	// Find the byte offset of the rune following the limit
+	end, n := len(text), 0
+	for i := range text {
+		if n == maxLen {
+			end = i
+			break
+		}
+		n++
+	}
+	if end == len(text) {
+		return text
+	}
+	if text[end] != ' ' {
+		// Avoid splitting a word, unless it is the only one
+		if i := strings.LastIndexByte(text[:end], ' '); i > 0 {
+			end = i
+		}
+	}
+	return strings.TrimRight(text[:end], " ")
+}
+
+// textFromHTML indicates whether the Text of e was downconverted from its HTML, as recorded by
+// the ErrorPlainTextFromHTML warning.
+func (e *Envelope) textFromHTML() bool {
+	if e.Root == nil {
+		return false
+	}
+	for _, err := range e.Root.Errors {
+		if err.Name == ErrorPlainTextFromHTML {
+			return true
+		}
+	}
+	return false
+}
+
+// Calendar returns the decoded content of the first text/calendar Part of the message, such as a
+// meeting invitation, and true; or false if there is none.  The iCalendar data is not parsed.
+func (e *Envelope) Calendar() (string, bool) {
+	parts := e.contentTypeParts(ctTextCalendar)
+	if len(parts) == 0 {
+		return "", false
+	}
+	return string(parts[0].Content), true
+}
+
+// VCards returns the decoded content of each text/vcard or text/x-vcard Part of the message.  The
+// vCard data is not parsed.
+func (e *Envelope) VCards() []string {
+	parts := e.contentTypeParts(ctTextVCard, ctTextXVCard)
+	cards := make([]string, 0, len(parts))
+	for _, p := range parts {
+		cards = append(cards, string(p.Content))
+	}
+	return cards
+}
+
+// contentTypeParts returns the Parts of the message, excluding those of encapsulated messages, with
+// one of the specified content types, in depth first order.
+func (e *Envelope) contentTypeParts(contentTypes ...string) []*Part {
+	if e.Root == nil {
+		return nil
+	}
+	return e.Root.DepthMatchAll(func(p *Part) bool {
+		if withinEncapsulated(e.Root, p) {
+			return false
+		}
+		for _, ctype := range contentTypes {
+			if strings.EqualFold(p.ContentType, ctype) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// PartByLocation returns the Part with the specified Content-Location, as used to identify the
+// resources of web pages saved as MHTML, or nil if there is no match.  Relative URLs, whether the
+// location or a Content-Location, are resolved against the Content-Location of the root Part; or
+// of the root document of a multipart/related message, its first child, per RFC 2557.  Multipart
+// containers are not matched, as they often share the Content-Location of their root document.
+func (e *Envelope) PartByLocation(location string) *Part {
+	location = strings.TrimSpace(location)
+	if e.Root == nil || location == "" {
+		return nil
+	}
+	p := e.Root.BreadthMatchFirst(func(p *Part) bool {
+		return p.ContentLocation == location && !strings.HasPrefix(p.ContentType, ctMultipartPrefix)
+	})
+	if p != nil {
+		return p
+	}
+	base, err := url.Parse(e.baseLocation())
+	if err != nil {
+		return nil
+	}
+	want, err := base.Parse(location)
+	if err != nil {
+		return nil
+	}
+	return e.Root.BreadthMatchFirst(func(p *Part) bool {
+		if p.ContentLocation == "" || strings.HasPrefix(p.ContentType, ctMultipartPrefix) {
+			return false
+		}
+		got, err := base.Parse(p.ContentLocation)
+		return err == nil && got.String() == want.String()
+	})
+}
+
+// baseLocation returns the Content-Location that relative URLs within the message are resolved
+// against, see PartByLocation.
+func (e *Envelope) baseLocation() string {
+	if e.Root.ContentLocation == "" && e.Root.ContentType == ctMultipartRelated &&
+		e.Root.FirstChild != nil {
+		return e.Root.FirstChild.ContentLocation
+	}
+	return e.Root.ContentLocation
+}
+
+// InlineByCID returns the inline Part with the specified Content-ID, or nil if there is no match.
+// The cid may be given in the "cid:" URL form used by HTML src attributes.  Parts referenced from a
+// multipart/related body often lack a Content-Disposition, so OtherParts is searched as well.
+func (e *Envelope) InlineByCID(cid string) *Part {
+	if len(cid) > 4 && strings.EqualFold(cid[:4], "cid:") {
+		cid = cid[4:]
+	}
+	cid = coding.FromIDHeader(cid)
+	if cid == "" {
+		return nil
+	}
+	for _, p := range e.Inlines {
+		if p.ContentID == cid {
+			return p
+		}
+	}
+	for _, p := range e.OtherParts {
+		if p.ContentID == cid {
+			return p
+		}
+	}
+	return nil
+}
+
 // ReadEnvelope is a wrapper around ReadParts and EnvelopeFromPart.  It parses the content of the
 // provided reader into an Envelope, downconverting HTML to plain text if needed, and sorting the
 // attachments, inlines and other parts into their respective slices. Errors are collected from all
-// Parts and placed into the Envelope.Errors slice.
+// Parts and placed into the Envelope.Errors slice.  Should the message fail to parse the error
+// returned by ReadParts is returned unaltered.
 func ReadEnvelope(r io.Reader) (*Envelope, error) {
-	// Read MIME parts from reader
-	root, err := ReadParts(r)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to ReadParts: %v", err)
-	}
-	return EnvelopeFromPart(root)
+	return defaultParser.ReadEnvelope(r)
+}
+
+// ReadEnvelopeBytes parses the message held in b into an Envelope, see ReadEnvelope.
+func ReadEnvelopeBytes(b []byte) (*Envelope, error) {
+	return defaultParser.ReadEnvelopeBytes(b)
+}
+
+// ReadEnvelopeTee parses the content of r into an Envelope like ReadEnvelope, and also returns the
+// complete raw message exactly as it was read from r.  The message is only read once, avoiding the
+// need to buffer it before parsing in order to retain a copy.  Data following the message, such
+// as an epilogue, is included, and counts towards Parser.MaxBodySize.
+func ReadEnvelopeTee(r io.Reader) (*Envelope, []byte, error) {
+	return defaultParser.ReadEnvelopeTee(r)
 }
 
 // EnvelopeFromPart uses the provided Part tree to build an Envelope, downconverting HTML to plain
@@ -77,8 +372,9 @@ func EnvelopeFromPart(root *Part) (*Envelope, error) {
 		header: &root.Header,
 	}
 
-	if detectMultipartMessage(root) {
-		// Multi-part message (message with attachments, etc)
+	if detectMultipartMessage(root) && root.Boundary != "" {
+		// Multi-part message (message with attachments, etc).  Without a boundary, declared or
+		// found in the content, it was parsed as a single part.
 		if err := parseMultiPartBody(root, e); err != nil {
 			return nil, err
 		}
@@ -189,7 +485,7 @@ func parseBinaryOnlyBody(root *Part, e *Envelope) error {
 	// Add header from binary only part
 	e.Root.Header = root.Header
 
-	if root.Disposition == cdInline {
+	if strings.EqualFold(root.Disposition, cdInline) {
 		e.Inlines = append(e.Inlines, root)
 	} else {
 		e.Attachments = append(e.Attachments, root)
@@ -202,31 +498,40 @@ func parseBinaryOnlyBody(root *Part, e *Envelope) error {
 func parseMultiPartBody(root *Part, e *Envelope) error {
 	// Parse top-level multipart
 	ctype := root.Header.Get(hnContentType)
-	mediatype, params, err := parseMediaType(ctype)
+	mediatype, _, err := parseMediaType(ctype)
 	if err != nil {
 		return fmt.Errorf("Unable to parse media type: %v", err)
 	}
+	if !strings.Contains(mediatype, "/") {
+		mediatype = defaultSubtype(mediatype)
+	}
 	if !strings.HasPrefix(mediatype, ctMultipartPrefix) {
 		return fmt.Errorf("Unknown mediatype: %v", mediatype)
 	}
-	boundary := params[hpBoundary]
-	if boundary == "" {
+	if root.Boundary == "" {
 		return fmt.Errorf("Unable to locate boundary param in Content-Type header")
 	}
 
+	// Parts of encapsulated messages belong to those messages, not this envelope
+	outer := func(matcher PartMatcher) PartMatcher {
+		return func(p *Part) bool {
+			return !withinEncapsulated(root, p) && matcher(p)
+		}
+	}
+
 	// Locate text body
 	if mediatype == ctMultipartAltern {
-		p := root.BreadthMatchFirst(func(p *Part) bool {
-			return p.ContentType == ctTextPlain && p.Disposition != cdAttachment
-		})
+		p := root.BreadthMatchFirst(outer(func(p *Part) bool {
+			return p.ContentType == ctTextPlain && !p.attachmentDisposition()
+		}))
 		if p != nil {
 			e.Text = string(p.Content)
 		}
 	} else {
 		// multipart is of a mixed type
-		parts := root.DepthMatchAll(func(p *Part) bool {
-			return p.ContentType == ctTextPlain && p.Disposition != cdAttachment
-		})
+		parts := root.DepthMatchAll(outer(func(p *Part) bool {
+			return p.ContentType == ctTextPlain && !p.attachmentDisposition()
+		}))
 		for i, p := range parts {
 			if i > 0 {
 				e.Text += "\n--\n"
@@ -236,23 +541,23 @@ func parseMultiPartBody(root *Part, e *Envelope) error {
 	}
 
 	// Locate HTML body
-	p := root.BreadthMatchFirst(matchHTMLBodyPart)
+	p := root.BreadthMatchFirst(outer(matchHTMLBodyPart))
 	if p != nil {
 		e.HTML += string(p.Content)
 	}
 
 	// Locate attachments
-	e.Attachments = root.BreadthMatchAll(func(p *Part) bool {
-		return p.Disposition == cdAttachment || p.ContentType == ctAppOctetStream
-	})
+	e.Attachments = root.BreadthMatchAll(outer(func(p *Part) bool {
+		return p.Kind() == PartKindAttachment
+	}))
 
 	// Locate inlines
-	e.Inlines = root.BreadthMatchAll(func(p *Part) bool {
-		return p.Disposition == cdInline
-	})
+	e.Inlines = root.BreadthMatchAll(outer(func(p *Part) bool {
+		return p.Kind() == PartKindInline
+	}))
 
 	// Locate others parts not considered in attachments or inlines
-	e.OtherParts = root.BreadthMatchAll(func(p *Part) bool {
+	e.OtherParts = root.BreadthMatchAll(outer(func(p *Part) bool {
 		if strings.HasPrefix(p.ContentType, ctMultipartPrefix) {
 			return false
 		}
@@ -263,12 +568,22 @@ func parseMultiPartBody(root *Part, e *Envelope) error {
 			return false
 		}
 		return p.ContentType != ctTextPlain && p.ContentType != ctTextHTML
-	})
+	}))
 
 	return nil
 }
 
+// withinEncapsulated returns true if p is part of a message encapsulated within root.
+func withinEncapsulated(root, p *Part) bool {
+	for ; p != nil && p != root; p = p.Parent {
+		if p.Encapsulated {
+			return true
+		}
+	}
+	return false
+}
+
 // Used by Part matchers to locate the HTML body.  Not inlined because it's used in multiple places.
 func matchHTMLBodyPart(p *Part) bool {
-	return p.ContentType == ctTextHTML && p.Disposition != cdAttachment
+	return p.ContentType == ctTextHTML && !p.attachmentDisposition()
 }
@@ -0,0 +1,24 @@
+//go:build go1.13
+// +build go1.13
+
+package enmime_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jhillyerd/enmime"
+	"github.com/jhillyerd/enmime/internal/test"
+)
+
+func TestReadEnvelopeErrorsAs(t *testing.T) {
+	r := test.OpenTestData("parts", "bad-ctype.raw")
+	_, err := enmime.ReadEnvelope(r)
+	var perr *enmime.ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("errors.As(%#v) failed, want: *ParseError", err)
+	}
+	if perr.Stage != enmime.StageHeader || perr.Boundary != "Enmime-Test-100" {
+		t.Errorf("ParseError got: %+v, want header stage at boundary Enmime-Test-100", perr)
+	}
+}
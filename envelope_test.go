@@ -2,8 +2,12 @@ package enmime_test
 
 import (
 	"bytes"
+	"io"
+	"io/ioutil"
+	"net/mail"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jhillyerd/enmime"
 	"github.com/jhillyerd/enmime/internal/test"
@@ -251,6 +255,313 @@ func TestParseAttachment(t *testing.T) {
 	test.ContentContainsString(t, e.Attachments[0].Content, want)
 }
 
+func TestEnvelopeAttachmentInfo(t *testing.T) {
+	e := &enmime.Envelope{}
+	if got := e.AttachmentInfo(); len(got) != 0 {
+		t.Errorf("AttachmentInfo() got: %v, want empty", got)
+	}
+
+	msg := test.OpenTestData("mail", "attachment.raw")
+	e, err := enmime.ReadEnvelope(msg)
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+
+	want := []enmime.AttachmentMeta{
+		{
+			FileName:    "test.html",
+			ContentType: "text/html",
+			Disposition: "attachment",
+			Size:        7,
+		},
+	}
+	got := e.AttachmentInfo()
+	if len(got) != len(want) {
+		t.Fatalf("AttachmentInfo() got: %+v, want: %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("AttachmentInfo()[%v] got: %+v, want: %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestEnvelopeTextParts(t *testing.T) {
+	e := &enmime.Envelope{}
+	if got := e.TextParts(); len(got) != 0 {
+		t.Errorf("TextParts() got: %v, want empty", got)
+	}
+
+	msg := test.OpenTestData("mail", "text-parts.raw")
+	e, err := enmime.ReadEnvelope(msg)
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+
+	want := []string{"text/plain", "text/calendar", "application/xhtml+xml"}
+	parts := e.TextParts()
+	var got []string
+	for _, p := range parts {
+		got = append(got, p.ContentType)
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("TextParts() content types got: %v, want: %v", got, want)
+	}
+	if len(parts) == 3 {
+		test.ContentContainsString(t, parts[1].Content, "BEGIN:VCALENDAR")
+	}
+
+	// The set of text types may be changed
+	delete(enmime.TextContentTypes, "application/xhtml+xml")
+	delete(enmime.TextContentTypes, "application/*+xml")
+	defer func() {
+		enmime.TextContentTypes["application/xhtml+xml"] = true
+		enmime.TextContentTypes["application/*+xml"] = true
+	}()
+	if got := len(e.TextParts()); got != 2 {
+		t.Errorf("len(TextParts()) got: %v, want: %v", got, 2)
+	}
+}
+
+func TestEnvelopeTextPartsSuffix(t *testing.T) {
+	msg := test.OpenTestData("mail", "text-suffix.raw")
+	e, err := enmime.ReadEnvelope(msg)
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+
+	// SVG is an image, despite its +xml suffix
+	want := []string{"application/vnd.api+json", "application/atom+xml"}
+	var got []string
+	for _, p := range e.TextParts() {
+		got = append(got, p.ContentType)
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("TextParts() content types got: %v, want: %v", got, want)
+	}
+}
+
+func TestEnvelopeCalendarVCards(t *testing.T) {
+	e, err := enmime.ReadEnvelope(test.OpenTestData("mail", "calendar-vcard.raw"))
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+
+	cal, ok := e.Calendar()
+	if !ok {
+		t.Fatal("Calendar() got: false, want: true")
+	}
+	want := "SUMMARY:Caf\u00e9 meeting\r\n"
+	if !strings.HasPrefix(cal, "BEGIN:VCALENDAR\r\n") || !strings.Contains(cal, want) {
+		t.Errorf("Calendar() got: %q, want it to contain: %q", cal, want)
+	}
+
+	cards := e.VCards()
+	if len(cards) != 2 {
+		t.Fatalf("len(VCards()) got: %v, want: 2", len(cards))
+	}
+	for i, want := range []string{"FN:Organizer\r\n", "FN:Assistant\r\n"} {
+		if !strings.HasPrefix(cards[i], "BEGIN:VCARD\r\n") || !strings.Contains(cards[i], want) {
+			t.Errorf("VCards()[%v] got: %q, want it to contain: %q", i, cards[i], want)
+		}
+	}
+
+	e, err = enmime.ReadEnvelope(test.OpenTestData("mail", "attachment.raw"))
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+	if cal, ok := e.Calendar(); ok {
+		t.Errorf("Calendar() got: %q, true, want: false", cal)
+	}
+	if cards := e.VCards(); len(cards) != 0 {
+		t.Errorf("VCards() got: %q, want none", cards)
+	}
+}
+
+func TestEnvelopeAllText(t *testing.T) {
+	e := &enmime.Envelope{}
+	if got := e.AllText(); got != "" {
+		t.Errorf("AllText() got: %q, want empty", got)
+	}
+
+	msg := test.OpenTestData("mail", "text-parts.raw")
+	e, err := enmime.ReadEnvelope(msg)
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+
+	want := "You are invited\n--\n" +
+		"BEGIN:VCALENDAR\r\nEND:VCALENDAR\n--\n" +
+		"You are invited\n--\n" +
+		"Notes"
+	if got := e.AllText(); got != want {
+		t.Errorf("AllText() got: %q, want: %q", got, want)
+	}
+}
+
+func TestEnvelopePreviewText(t *testing.T) {
+	e := &enmime.Envelope{}
+	if got := e.PreviewText(10); got != "" {
+		t.Errorf("PreviewText() got: %q, want empty", got)
+	}
+
+	// HTML is stripped when there is no text/plain body
+	msg := test.OpenTestData("mail", "html-only-inline.raw")
+	e, err := enmime.ReadEnvelope(msg)
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+	if got, want := e.PreviewText(0), "Test of HTML section"; got != want {
+		t.Errorf("PreviewText() got: %q, want: %q", got, want)
+	}
+
+	ttable := []struct {
+		name   string
+		text   string
+		html   string
+		maxLen int
+		want   string
+	}{
+		{"text", "Hello\r\n  world\r\n", "<p>Ignored</p>", 0, "Hello world"},
+		{"html", "", "<p>Caf&eacute;</p><p>au &lt;lait&gt;</p>", 0, "Café au <lait>"},
+		{"html head", "", "<head><title>Title</title></head><p>Body</p>", 0, "Body"},
+		{"short", "Hello world", "", 20, "Hello world"},
+		{"exact", "Hello world", "", 11, "Hello world"},
+		{"word boundary", "Hello wonderful world", "", 14, "Hello"},
+		{"at space", "Hello wonderful world", "", 15, "Hello wonderful"},
+		{"long word", "Supercalifragilistic", "", 5, "Super"},
+		{"runes", "Caf\u00e9 cr\u00e8me br\u00fbl\u00e9e", "", 11, "Caf\u00e9 cr\u00e8me"},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &enmime.Envelope{Text: tt.text, HTML: tt.html}
+			if got := e.PreviewText(tt.maxLen); got != tt.want {
+				t.Errorf("PreviewText(%v) got: %q, want: %q", tt.maxLen, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvelopePartByLocation(t *testing.T) {
+	msg := test.OpenTestData("mail", "mhtml.raw")
+	e, err := enmime.ReadEnvelope(msg)
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+
+	wantp := &enmime.Part{
+		Parent:          test.PartExists,
+		NextSibling:     test.PartExists,
+		ContentType:     "text/html",
+		ContentLocation: "http://example.com/dir/page.html",
+		Charset:         "us-ascii",
+		PartID:          "1",
+	}
+	test.ComparePart(t, e.Root.FirstChild, wantp)
+	// The root shares the location of the page, its document
+	if got, want := e.Root.ContentLocation, wantp.ContentLocation; got != want {
+		t.Errorf("Root ContentLocation got: %q, want: %q", got, want)
+	}
+
+	ttable := []struct {
+		location string
+		want     string
+	}{
+		{"http://example.com/dir/page.html", "text/html"},
+		{"page.html", "text/html"},
+		{"http://example.com/dir/images/a.png", "image/png"},
+		{"images/a.png", "image/png"},
+		{"./images/a.png", "image/png"},
+		{" b.png ", "image/gif"},
+		{"http://example.com/dir/b.png", "image/gif"},
+		{"/dir/b.png", "image/gif"},
+		{"c.png", ""},
+		{"http://example.com/b.png", ""},
+		{"", ""},
+	}
+	for _, tt := range ttable {
+		p := e.PartByLocation(tt.location)
+		got := ""
+		if p != nil {
+			got = p.ContentType
+		}
+		if got != tt.want {
+			t.Errorf("PartByLocation(%q) got: %q, want: %q", tt.location, got, tt.want)
+		}
+	}
+
+	e = &enmime.Envelope{}
+	if p := e.PartByLocation("a.png"); p != nil {
+		t.Errorf("PartByLocation() got: %v, want nil", p)
+	}
+}
+
+func TestReadEnvelopeBytes(t *testing.T) {
+	b, err := ioutil.ReadAll(test.OpenTestData("mail", "attachment.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := enmime.ReadEnvelopeBytes(b)
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+	if got, want := e.GetHeader("Subject"), "Attachment"; got != want {
+		t.Errorf("Subject got: %q, want: %q", got, want)
+	}
+	if len(e.Attachments) != 1 {
+		t.Errorf("len(Attachments) got: %v, want: 1", len(e.Attachments))
+	}
+
+	parser := enmime.NewParser()
+	parser.MaxBodySize = 10
+	if _, err := parser.ReadEnvelopeBytes(b); err != enmime.ErrMessageTooLarge {
+		t.Errorf("ReadEnvelopeBytes() error got: %v, want: %v", err, enmime.ErrMessageTooLarge)
+	}
+}
+
+func TestReadEnvelopeTee(t *testing.T) {
+	want, err := ioutil.ReadAll(test.OpenTestData("mail", "attachment.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, raw, err := enmime.ReadEnvelopeTee(test.OpenTestData("mail", "attachment.raw"))
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+	if got, want := e.GetHeader("Subject"), "Attachment"; got != want {
+		t.Errorf("Subject got: %q, want: %q", got, want)
+	}
+	if len(e.Attachments) != 1 {
+		t.Errorf("len(Attachments) got: %v, want: 1", len(e.Attachments))
+	}
+	if !bytes.Equal(raw, want) {
+		t.Errorf("Raw message got %v bytes, want the %v bytes of the original", len(raw), len(want))
+	}
+
+	parser := enmime.NewParser()
+	parser.MaxBodySize = 10
+	_, raw, err = parser.ReadEnvelopeTee(test.OpenTestData("mail", "attachment.raw"))
+	if err != enmime.ErrMessageTooLarge {
+		t.Errorf("ReadEnvelopeTee() error got: %v, want: %v", err, enmime.ErrMessageTooLarge)
+	}
+	if raw != nil {
+		t.Errorf("Raw message got %v bytes, want nil on error", len(raw))
+	}
+
+	// Trailing data counts towards the limit
+	msg := "Subject: Trailing\r\n\r\nBody\r\n"
+	r := io.MultiReader(strings.NewReader(msg), strings.NewReader(strings.Repeat("x", 100)))
+	parser.MaxBodySize = int64(len(msg)) + 50
+	_, raw, err = parser.ReadEnvelopeTee(r)
+	if err != enmime.ErrMessageTooLarge {
+		t.Errorf("ReadEnvelopeTee() error got: %v, want: %v", err, enmime.ErrMessageTooLarge)
+	}
+	if raw != nil {
+		t.Errorf("Raw message got %v bytes, want nil on error", len(raw))
+	}
+}
+
 func TestParseAttachmentOctet(t *testing.T) {
 	msg := test.OpenTestData("mail", "attachment-octet.raw")
 	e, err := enmime.ReadEnvelope(msg)
@@ -391,6 +702,73 @@ func TestParseInline(t *testing.T) {
 	}
 }
 
+func TestInlineByCID(t *testing.T) {
+	msg := test.OpenTestData("mail", "html-mime-inline.raw")
+	e, err := enmime.ReadEnvelope(msg)
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+
+	for _, cid := range []string{
+		"8B8481A2-25CA-4886-9B5A-8EB9115DD064@skynet",
+		"<8B8481A2-25CA-4886-9B5A-8EB9115DD064@skynet>",
+		"cid:8B8481A2-25CA-4886-9B5A-8EB9115DD064@skynet",
+		"CID:8B8481A2-25CA-4886-9B5A-8EB9115DD064%40skynet",
+	} {
+		p := e.InlineByCID(cid)
+		if p == nil {
+			t.Errorf("InlineByCID(%q) got nil, want part", cid)
+			continue
+		}
+		if p.FileName != "favicon.png" {
+			t.Errorf("InlineByCID(%q) FileName got: %q, want: %q", cid, p.FileName, "favicon.png")
+		}
+	}
+
+	for _, cid := range []string{"", "cid:", "cid:unknown@skynet"} {
+		if p := e.InlineByCID(cid); p != nil {
+			t.Errorf("InlineByCID(%q) got %v, want nil", cid, p)
+		}
+	}
+}
+
+func TestParseEncapsulatedMessage(t *testing.T) {
+	msg := test.OpenTestData("mail", "attached-message.raw")
+	parser := enmime.NewParser()
+	parser.ParseEncapsulated = true
+	e, err := parser.ReadEnvelope(msg)
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+
+	want := "Forwarding the message below."
+	if e.Text != want {
+		t.Errorf("Text got: %q, want: %q", e.Text, want)
+	}
+	if len(e.Attachments) != 1 {
+		t.Fatal("Should have one attachment, got:", len(e.Attachments))
+	}
+	got := e.Attachments[0].FileName
+	if got != "inner.eml" {
+		t.Errorf("FileName got: %q, want: %q", got, "inner.eml")
+	}
+
+	// The encapsulated message may be used to build its own Envelope
+	inner, err := enmime.EnvelopeFromPart(e.Attachments[0].FirstChild)
+	if err != nil {
+		t.Fatal("Failed to build inner Envelope:", err)
+	}
+	if got := inner.GetHeader("Subject"); got != "Inner message" {
+		t.Errorf("Inner Subject got: %q, want: %q", got, "Inner message")
+	}
+	if inner.Text != "Inner text section" {
+		t.Errorf("Inner Text got: %q, want: %q", inner.Text, "Inner text section")
+	}
+	if len(inner.Attachments) != 1 || inner.Attachments[0].FileName != "inner.bin" {
+		t.Errorf("Inner Attachments got: %v, want inner.bin", inner.Attachments)
+	}
+}
+
 func TestParseHTMLOnlyInline(t *testing.T) {
 	msg := test.OpenTestData("mail", "html-only-inline.raw")
 	e, err := enmime.ReadEnvelope(msg)
@@ -435,6 +813,161 @@ func TestParseHTMLOnlyInline(t *testing.T) {
 	}
 }
 
+func TestAttachmentDispositions(t *testing.T) {
+	fileNames := func(parts []*enmime.Part) string {
+		names := make([]string, 0, len(parts))
+		for _, p := range parts {
+			names = append(names, p.FileName)
+		}
+		return strings.Join(names, " ")
+	}
+
+	// Dispositions are case insensitive
+	e, err := enmime.ReadEnvelope(test.OpenTestData("mail", "custom-disposition.raw"))
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+	if got, want := fileNames(e.Attachments), "report.pdf"; got != want {
+		t.Errorf("Attachments got: %q, want: %q", got, want)
+	}
+	if got, want := fileNames(e.Inlines), "logo.png"; got != want {
+		t.Errorf("Inlines got: %q, want: %q", got, want)
+	}
+	want := "Message body\n--\nAttached notes"
+	if e.Text != want {
+		t.Errorf("Text got: %q, want: %q", e.Text, want)
+	}
+
+	// Custom dispositions are attachments
+	parser := enmime.NewParser()
+	parser.AttachmentDispositions = []string{"X-Attachment"}
+	e, err = parser.ReadEnvelope(test.OpenTestData("mail", "custom-disposition.raw"))
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+	if got, want := fileNames(e.Attachments), "notes.txt report.pdf"; got != want {
+		t.Errorf("Attachments got: %q, want: %q", got, want)
+	}
+	if got, want := fileNames(e.Inlines), "logo.png"; got != want {
+		t.Errorf("Inlines got: %q, want: %q", got, want)
+	}
+	want = "Message body"
+	if e.Text != want {
+		t.Errorf("Text got: %q, want: %q", e.Text, want)
+	}
+}
+
+func TestParseMultipartNoSubtype(t *testing.T) {
+	e, err := enmime.ReadEnvelope(test.OpenTestData("mail", "multipart-no-subtype.raw"))
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+	if got, want := e.Root.ContentType, "multipart/mixed"; got != want {
+		t.Errorf("Root ContentType got: %q, want: %q", got, want)
+	}
+	want := `[W] Malformed Content-Type: Content-Type "multipart" has no subtype, ` +
+		`using "multipart/mixed"`
+	if len(e.Errors) != 1 || e.Errors[0].String() != want {
+		t.Errorf("Errors got: %v, want: %v", e.Errors, want)
+	}
+	if got, want := e.Text, "Message body"; got != want {
+		t.Errorf("Text got: %q, want: %q", got, want)
+	}
+	if len(e.Attachments) != 1 {
+		t.Fatal("len(Attachments) got:", len(e.Attachments), "want: 1")
+	}
+	if got, want := e.Attachments[0].FileName, "report.pdf"; got != want {
+		t.Errorf("Attachment FileName got: %q, want: %q", got, want)
+	}
+	test.ContentEqualsString(t, e.Attachments[0].Content, "%PDF-1.4\n")
+}
+
+func TestParseInlineHTMLBody(t *testing.T) {
+	// The HTML body is marked inline without a Content-ID, it must not be treated as an inline
+	msg := test.OpenTestData("mail", "html-inline-body.raw")
+	e, err := enmime.ReadEnvelope(msg)
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+
+	want := "<p>Inline HTML body</p>"
+	if !strings.Contains(e.HTML, want) {
+		t.Errorf("HTML: %q should contain %q", e.HTML, want)
+	}
+	want = "Inline HTML body"
+	if !strings.Contains(e.Text, want) {
+		t.Errorf("Downconverted Text: %q should contain: %q", e.Text, want)
+	}
+
+	if len(e.Inlines) != 1 {
+		t.Fatal("Should have one inline, got:", len(e.Inlines))
+	}
+	if got, want := e.Inlines[0].ContentID, "logo@example.com"; got != want {
+		t.Errorf("Inline ContentID got: %q, want: %q", got, want)
+	}
+	if len(e.Attachments) > 0 {
+		t.Error("Should have no attachments, got:", len(e.Attachments))
+	}
+	if len(e.OtherParts) > 0 {
+		t.Error("Should have no other parts, got:", len(e.OtherParts))
+	}
+}
+
+func TestParseInlineWithoutContentID(t *testing.T) {
+	// Nothing can refer to an inline image without a Content-ID, it is an attachment
+	msg := test.OpenTestData("mail", "inline-no-cid.raw")
+	e, err := enmime.ReadEnvelope(msg)
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+
+	if e.Text != "Text body" {
+		t.Errorf("Text got: %q, want: %q", e.Text, "Text body")
+	}
+	if len(e.Inlines) > 0 {
+		t.Error("Should have no inlines, got:", len(e.Inlines))
+	}
+	if len(e.Attachments) != 1 {
+		t.Fatal("Should have one attachment, got:", len(e.Attachments))
+	}
+	if got, want := e.Attachments[0].FileName, "photo.png"; got != want {
+		t.Errorf("Attachment FileName got: %q, want: %q", got, want)
+	}
+}
+
+func TestParseInlineCalendar(t *testing.T) {
+	// Inline text parts are not attachments, whatever their subtype
+	r := strings.NewReader("Content-Type: multipart/mixed; boundary=\"Enmime-Test-100\"\r\n" +
+		"\r\n" +
+		"--Enmime-Test-100\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Text body\r\n" +
+		"--Enmime-Test-100\r\n" +
+		"Content-Type: text/calendar; method=REQUEST\r\n" +
+		"Content-Disposition: inline\r\n" +
+		"\r\n" +
+		"BEGIN:VCALENDAR\r\n" +
+		"END:VCALENDAR\r\n" +
+		"--Enmime-Test-100--\r\n")
+	e, err := enmime.ReadEnvelope(r)
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+	if len(e.Attachments) > 0 || len(e.Inlines) > 0 {
+		t.Errorf("Attachments, Inlines got: %v, %v, want none", len(e.Attachments), len(e.Inlines))
+	}
+	p := e.Root.BreadthMatchFirst(func(p *enmime.Part) bool {
+		return p.ContentType == "text/calendar"
+	})
+	if p == nil {
+		t.Fatal("text/calendar Part not found")
+	}
+	if got := p.Kind(); got != enmime.PartKindOther {
+		t.Errorf("Kind() got: %v, want: %v", got, enmime.PartKindOther)
+	}
+}
+
 func TestParseNestedHeaders(t *testing.T) {
 	msg := test.OpenTestData("mail", "html-mime-inline.raw")
 	e, err := enmime.ReadEnvelope(msg)
@@ -493,6 +1026,29 @@ func TestEnvelopeGetHeader(t *testing.T) {
 	if got != want {
 		t.Errorf("Subject was: %q, want: %q", got, want)
 	}
+
+	// Test GB2312 subject line, decoded with the same charsets as content
+	r = test.OpenTestData("mail", "gb2312-subject.raw")
+	e, err = enmime.ReadEnvelope(r)
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+
+	want = "\u4e2d\u6587\u90ae\u4ef6"
+	got = e.GetHeader("Subject")
+	if got != want {
+		t.Errorf("Subject was: %q, want: %q", got, want)
+	}
+	if e.Text != want {
+		t.Errorf("Text was: %q, want: %q", e.Text, want)
+	}
+	from, err := e.AddressList("From")
+	if err != nil {
+		t.Fatal("AddressList returned error:", err)
+	}
+	if len(from) != 1 || from[0].Name != "\u4e2d\u6587" {
+		t.Errorf("From was: %v, want name: %q", from, "\u4e2d\u6587")
+	}
 }
 
 func TestEnvelopeAddressList(t *testing.T) {
@@ -545,6 +1101,57 @@ func TestEnvelopeAddressList(t *testing.T) {
 	}
 }
 
+func TestEnvelopeAccessors(t *testing.T) {
+	// Test empty header
+	e := &enmime.Envelope{}
+	if got := e.Subject(); got != "" {
+		t.Errorf("Subject() got: %q, want: %q", got, "")
+	}
+	if got := e.From(); got != nil {
+		t.Errorf("From() got: %v, want: nil", got)
+	}
+	if _, err := e.Date(); err != mail.ErrHeaderNotPresent {
+		t.Errorf("Date() error got: %v, want: %v", err, mail.ErrHeaderNotPresent)
+	}
+
+	r := test.OpenTestData("mail", "qp-utf8-header.raw")
+	e, err := enmime.ReadEnvelope(r)
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+
+	if got, want := e.Subject(), "MIME UTF8 Test \u00a2 More Text"; got != want {
+		t.Errorf("Subject() got: %q, want: %q", got, want)
+	}
+
+	from := e.From()
+	if len(from) != 2 {
+		t.Fatalf("len(From()) got: %v, want: %v", len(from), 2)
+	}
+	if got, want := from[1].Name, "André Pirard"; got != want {
+		t.Errorf("From()[1].Name got: %q, want: %q", got, want)
+	}
+	if got, want := from[1].Address, "PIRARD@vm1.ulg.ac.be"; got != want {
+		t.Errorf("From()[1].Address got: %q, want: %q", got, want)
+	}
+
+	to := e.To()
+	if len(to) != 1 {
+		t.Fatalf("len(To()) got: %v, want: %v", len(to), 1)
+	}
+	if got, want := to[0].Name, "Mirosław Marczak"; got != want {
+		t.Errorf("To()[0].Name got: %q, want: %q", got, want)
+	}
+
+	date, err := e.Date()
+	if err != nil {
+		t.Fatal("Failed to parse Date:", err)
+	}
+	if want := time.Date(2012, 10, 19, 19, 22, 49, 0, time.UTC); !date.Equal(want) {
+		t.Errorf("Date() got: %v, want: %v", date, want)
+	}
+}
+
 func TestDetectCharacterSetInHTML(t *testing.T) {
 	msg := test.OpenTestData("mail", "non-mime-missing-charset.raw")
 	e, err := enmime.ReadEnvelope(msg)
@@ -804,3 +1411,63 @@ func TestEnvelopeEpilogue(t *testing.T) {
 		t.Errorf("Epilogue == %q, want: %q", got, want)
 	}
 }
+
+func TestEnvelopeMultipartNoBoundary(t *testing.T) {
+	// Boundary found in the content
+	r := test.OpenTestData("parts", "multipart-no-boundary.raw")
+	e, err := enmime.ReadEnvelope(r)
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+	if e.Text != "A text section" {
+		t.Errorf("Text got: %q, want: %q", e.Text, "A text section")
+	}
+	if len(e.Attachments) != 0 || len(e.Inlines) != 0 {
+		t.Errorf("Attachments, Inlines got: %v, %v, want none", len(e.Attachments), len(e.Inlines))
+	}
+
+	// No boundary in the content, treated as a single part
+	r = strings.NewReader("Content-Type: multipart/mixed\r\n\r\nOpaque body\r\n")
+	e, err = enmime.ReadEnvelope(r)
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+	if e.Text != "" {
+		t.Errorf("Text got: %q, want none", e.Text)
+	}
+	if len(e.Attachments) != 1 {
+		t.Fatalf("Attachments got: %v, want: 1", len(e.Attachments))
+	}
+	test.ContentEqualsString(t, e.Attachments[0].Content, "Opaque body\r\n")
+}
+
+func TestReadEnvelopeParseError(t *testing.T) {
+	r := test.OpenTestData("parts", "bad-ctype.raw")
+	_, err := enmime.ReadEnvelope(r)
+	perr, ok := err.(*enmime.ParseError)
+	if !ok {
+		t.Fatalf("ReadEnvelope() error got: %#v, want: *ParseError", err)
+	}
+	if perr.Stage != enmime.StageHeader || perr.Boundary != "Enmime-Test-100" {
+		t.Errorf("ParseError got: %+v, want header stage at boundary Enmime-Test-100", perr)
+	}
+}
+
+func TestEnvelopeGetHeaderUnsupportedCharset(t *testing.T) {
+	r := strings.NewReader("Subject: =?x-unknown?Q?Caf=E9?=\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Body\r\n")
+	e, err := enmime.ReadEnvelope(r)
+	if err != nil {
+		t.Fatal("Failed to parse MIME:", err)
+	}
+	if got, want := e.GetHeader("Subject"), "Caf\uFFFD"; got != want {
+		t.Errorf("Subject got: %q, want: %q", got, want)
+	}
+	want := "[W] Header Decode: Failed to decode Subject header \"=?x-unknown?Q?Caf=E9?=\": " +
+		"Unsupported charset \"x-unknown\""
+	if len(e.Errors) != 1 || e.Errors[0].String() != want {
+		t.Errorf("Errors got: %v, want: %v", e.Errors, want)
+	}
+}
@@ -4,21 +4,41 @@ import (
 	"fmt"
 )
 
+// Error names, these are stable and may be compared against Error.Name to identify the type of
+// problem encountered.
 const (
 	// ErrorMalformedBase64 name
 	ErrorMalformedBase64 = "Malformed Base64"
 	// ErrorMalformedHeader name
 	ErrorMalformedHeader = "Malformed Header"
+	// ErrorMalformedContentType name
+	ErrorMalformedContentType = "Malformed Content-Type"
+	// ErrorMalformedDisposition name
+	ErrorMalformedDisposition = "Malformed Content-Disposition"
+	// ErrorHeaderDecode name
+	ErrorHeaderDecode = "Header Decode"
+	// ErrorDuplicateHeader name
+	ErrorDuplicateHeader = "Duplicate Header"
 	// ErrorMissingBoundary name
 	ErrorMissingBoundary = "Missing Boundary"
 	// ErrorMissingContentType name
 	ErrorMissingContentType = "Missing Content-Type"
 	// ErrorCharsetConversion name
 	ErrorCharsetConversion = "Character Set Conversion"
+	// ErrorCharsetDeclaration name
+	ErrorCharsetDeclaration = "Character Set Declaration"
 	// ErrorContentEncoding name
 	ErrorContentEncoding = "Content Encoding"
+	// ErrorMaxDepth name
+	ErrorMaxDepth = "Maximum Depth Exceeded"
+	// ErrorMaxParts name
+	ErrorMaxParts = "Maximum Parts Exceeded"
+	// ErrorUnexpectedEOF name
+	ErrorUnexpectedEOF = "Unexpected EOF"
 	// ErrorPlainTextFromHTML name
 	ErrorPlainTextFromHTML = "Plain Text from HTML"
+	// ErrorMixedLineEndings name
+	ErrorMixedLineEndings = "Mixed Line Endings"
 )
 
 // Error describes an error encountered while parsing.
@@ -37,6 +57,67 @@ func (e *Error) String() string {
 	return fmt.Sprintf("[%s] %s: %s", sev, e.Name, e.Detail)
 }
 
+// Parse stages, these identify what was being parsed when a ParseError occurred.
+const (
+	// StageHeader is reading and parsing a header block
+	StageHeader = "header"
+	// StageBoundary is locating a multipart boundary
+	StageBoundary = "boundary"
+	// StageContent is reading and decoding content
+	StageContent = "content"
+)
+
+// ParseError is returned by ReadParts when a message could not be parsed.  Problems that parsing
+// could recover from are recorded in Part.Errors instead.
+type ParseError struct {
+	Stage    string // The stage of parsing that failed, from Stage consts
+	Boundary string // Boundary of the enclosing multipart Part, empty at the top level
+	Err      error  // The underlying cause
+}
+
+// Error formats the ParseError as a string
+func (e *ParseError) Error() string {
+	if e.Boundary == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("error at boundary %v: %v", e.Boundary, e.Err)
+}
+
+// Unwrap returns the underlying cause, for use with errors.Is and errors.As
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// parseError returns err wrapped in a ParseError, unless it is nil or already a ParseError.
+func parseError(stage, boundary string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*ParseError); ok {
+		return err
+	}
+	return &ParseError{Stage: stage, Boundary: boundary, Err: err}
+}
+
+// AllErrors returns the Errors recorded on p and all of its descendants, including encapsulated
+// messages, in depth first tree order.  Envelope.Errors holds the same Errors for the whole
+// message.
+func (p *Part) AllErrors() []Error {
+	var errs []Error
+	_ = p.DepthMatchAll(func(part *Part) bool {
+		errs = append(errs, part.Errors...)
+		return false
+	})
+	return errs
+}
+
+// HasErrors returns true if an Error was recorded on p or any of its descendants.
+func (p *Part) HasErrors() bool {
+	return p.DepthMatchFirst(func(part *Part) bool {
+		return len(part.Errors) > 0
+	}) != nil
+}
+
 // addWarning builds a severe Error and appends to the Part error slice
 func (p *Part) addError(name string, detailFmt string, args ...interface{}) {
 	p.Errors = append(
@@ -74,6 +74,50 @@ func TestErrorAddWarning(t *testing.T) {
 	}
 }
 
+func TestErrorPartAllErrors(t *testing.T) {
+	root := &Part{}
+	child := &Part{Parent: root}
+	grandchild := &Part{Parent: child}
+	sibling := &Part{Parent: root}
+	root.FirstChild = child
+	child.FirstChild = grandchild
+	child.NextSibling = sibling
+
+	if root.HasErrors() {
+		t.Error("HasErrors() == true, want false for a tree without errors")
+	}
+	if got := root.AllErrors(); len(got) != 0 {
+		t.Errorf("AllErrors() == %v, want none", got)
+	}
+
+	root.addWarning("Root", "root")
+	grandchild.addError("Grandchild", "grandchild")
+	sibling.addWarning("Sibling", "sibling")
+	if !root.HasErrors() {
+		t.Error("root.HasErrors() == false, want true")
+	}
+	if !child.HasErrors() {
+		t.Error("child.HasErrors() == false, want true for an error on a descendant")
+	}
+
+	want := []string{"Root", "Grandchild", "Sibling"}
+	got := root.AllErrors()
+	if len(got) != len(want) {
+		t.Fatalf("AllErrors() returned %v errors, want %v: %v", len(got), len(want), got)
+	}
+	for i, name := range want {
+		if got[i].Name != name {
+			t.Errorf("AllErrors()[%v].Name == %q, want: %q", i, got[i].Name, name)
+		}
+	}
+
+	// Siblings of p are not included
+	got = child.AllErrors()
+	if len(got) != 1 || got[0].Name != "Grandchild" {
+		t.Errorf("child.AllErrors() == %v, want only the Grandchild error", got)
+	}
+}
+
 func TestErrorEnvelopeWarnings(t *testing.T) {
 	// To pass each file below must error one or more times with the specified errorName, and no
 	// other errorNames.
@@ -90,6 +134,11 @@ func TestErrorEnvelopeWarnings(t *testing.T) {
 		{"unk-charset-html-only.raw", ErrorCharsetConversion},
 		{"unk-charset-part.raw", ErrorCharsetConversion},
 		{"malformed-base64-attach.raw", ErrorMalformedBase64},
+		{"malformed-uuencode-attach.raw", ErrorContentEncoding},
+		{"malformed-disposition.raw", ErrorMalformedDisposition},
+		{"bad-filename-encoding.raw", ErrorHeaderDecode},
+		{"truncated-part.raw", ErrorUnexpectedEOF},
+		{"duplicate-content-type.raw", ErrorDuplicateHeader},
 	}
 
 	for _, tt := range files {
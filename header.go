@@ -3,11 +3,18 @@ package enmime
 import (
 	"bufio"
 	"bytes"
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"io"
 	"mime"
+	"net/mail"
 	"net/textproto"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/jhillyerd/enmime/internal/coding"
 )
@@ -18,13 +25,24 @@ const (
 	cdInline     = "inline"
 
 	// Standard MIME content types
-	ctAppOctetStream   = "application/octet-stream"
-	ctMultipartAltern  = "multipart/alternative"
-	ctMultipartMixed   = "multipart/mixed"
-	ctMultipartPrefix  = "multipart/"
-	ctMultipartRelated = "multipart/related"
-	ctTextPlain        = "text/plain"
-	ctTextHTML         = "text/html"
+	ctAppOctetStream     = "application/octet-stream"
+	ctAppXHTML           = "application/xhtml+xml"
+	ctMessageExternal    = "message/external-body"
+	ctMessagePartial     = "message/partial"
+	ctMessageRFC822      = "message/rfc822"
+	ctMultipartAltern    = "multipart/alternative"
+	ctMultipartDigest    = "multipart/digest"
+	ctMultipartEncrypted = "multipart/encrypted"
+	ctMultipartMixed     = "multipart/mixed"
+	ctMultipartPrefix    = "multipart/"
+	ctMultipartRelated   = "multipart/related"
+	ctMultipartSigned    = "multipart/signed"
+	ctTextCalendar       = "text/calendar"
+	ctTextPrefix         = "text/"
+	ctTextPlain          = "text/plain"
+	ctTextHTML           = "text/html"
+	ctTextVCard          = "text/vcard"
+	ctTextXVCard         = "text/x-vcard"
 
 	// Standard Transfer encodings
 	cte7Bit            = "7bit"
@@ -32,26 +50,67 @@ const (
 	cteBase64          = "base64"
 	cteBinary          = "binary"
 	cteQuotedPrintable = "quoted-printable"
+	cteUUEncode        = "uuencode"
+
+	// Non-standard Transfer encodings
+	cteXBase64          = "x-base64"
+	cteXGzip64          = "x-gzip64"
+	cteXQuotedPrintable = "x-quoted-printable"
+	cteXUUEncode        = "x-uuencode"
+	cteXUUE             = "x-uue"
 
 	// Standard MIME header names
+	hnContentDescription = "Content-Description"
 	hnContentDisposition = "Content-Disposition"
 	hnContentEncoding    = "Content-Transfer-Encoding"
 	hnContentID          = "Content-ID"
+	hnContentLocation    = "Content-Location"
 	hnContentType        = "Content-Type"
 	hnMIMEVersion        = "MIME-Version"
 
+	// HTTP header names
+	hnHTTPContentEncoding = "Content-Encoding"
+
 	// Standard MIME header parameters
 	hpBoundary = "boundary"
 	hpCharset  = "charset"
+	hpDelSp    = "delsp"
 	hpFile     = "file"
 	hpFilename = "filename"
+	hpFormat   = "format"
+	hpID       = "id"
 	hpName     = "name"
+	hpNumber   = "number"
+	hpProtocol = "protocol"
+	hpTotal    = "total"
 
 	utf8 = "utf-8"
 )
 
 var errEmptyHeaderBlock = errors.New("empty header block")
 
+// dateLayouts are tried in order by parseDate after mail.ParseDate fails, they describe the
+// non-standard dates produced by various mail software.
+var dateLayouts = []string{
+	"Mon, 2 Jan 2006 15:04:05 -0700 MST",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"Mon, 2 Jan 2006 15:04:05",
+	"Mon 2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 06 15:04:05 -0700",
+	"Mon, 2 Jan 06 15:04:05 MST",
+	"Mon, 2 January 2006 15:04:05 -0700",
+	"Monday, 2 Jan 2006 15:04:05 -0700",
+	"Monday, 02-Jan-06 15:04:05 MST",
+	"Mon Jan 2 15:04:05 2006",
+	"Mon Jan 2 15:04:05 MST 2006",
+	"Mon Jan 2 15:04:05 -0700 2006",
+	"2006-01-02T15:04:05Z07:00",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+}
+
 // AddressHeaders is the set of SMTP headers that contain email addresses, used by
 // Envelope.AddressList().  Key characters must be all lowercase.
 var AddressHeaders = map[string]bool{
@@ -81,11 +140,21 @@ var AddressHeaders = map[string]bool{
 func readHeader(r *bufio.Reader, p *Part) (textproto.MIMEHeader, error) {
 	// buf holds the massaged output for textproto.Reader.ReadMIMEHeader()
 	buf := &bytes.Buffer{}
-	tp := textproto.NewReader(r)
+	// raw holds the header block as it was read, rawEnd excludes the blank line that ends it
+	raw := &bytes.Buffer{}
+	rawEnd := 0
+	defer func() {
+		p.rawHeader = raw.Bytes()[:rawEnd]
+	}()
+	var readErr error
 	firstHeader := true
+	lenient := p.parser != nil && p.parser.LenientParsing
 	for {
 		// Pull out each line of the headers as a temporary slice s
-		s, err := tp.ReadLineBytes()
+		s, err := readHeaderLine(r, raw, &readErr)
+		if len(s) > 0 {
+			rawEnd = raw.Len()
+		}
 		if err != nil {
 			if err == io.ErrUnexpectedEOF && buf.Len() == 0 {
 				return nil, errEmptyHeaderBlock
@@ -95,6 +164,12 @@ func readHeader(r *bufio.Reader, p *Part) (textproto.MIMEHeader, error) {
 			}
 			return nil, err
 		}
+		if lenient {
+			if clean := removeControlChars(s); len(clean) < len(s) {
+				p.addWarning(ErrorMalformedHeader, "Removed control characters from header line %q", s)
+				s = clean
+			}
+		}
 		firstColon := bytes.IndexByte(s, ':')
 		firstSpace := bytes.IndexAny(s, " \t\n\r")
 		if firstSpace == 0 {
@@ -115,10 +190,19 @@ func readHeader(r *bufio.Reader, p *Part) (textproto.MIMEHeader, error) {
 				buf.Write([]byte{'\r', '\n'})
 			}
 			s = textproto.TrimBytes(s)
+			// Remove whitespace preceding the colon, as in "Name : value"
+			if name := bytes.TrimRight(s[:firstColon], " \t"); len(name) < firstColon {
+				s = append(name, s[firstColon:]...)
+			}
 			buf.Write(s)
 			firstHeader = false
 		} else {
 			// No colon: potential non-indented continuation
+			if len(s) > 0 && firstHeader && lenient {
+				// There is no previous line to continue, drop the line
+				p.addWarning(ErrorMalformedHeader, "Dropped header line %q, it had no colon", s)
+				continue
+			}
 			if len(s) > 0 {
 				// Attempt to detect and repair a non-indented continuation of previous line
 				buf.WriteByte(' ')
@@ -137,20 +221,241 @@ func readHeader(r *bufio.Reader, p *Part) (textproto.MIMEHeader, error) {
 	return header, err
 }
 
+// readHeaderLine reads a line from r, appending it to raw, and returns it without the line ending.
+// An error that ends a partial line is stored in readErr, to be returned by the next call.
+func readHeaderLine(r *bufio.Reader, raw *bytes.Buffer, readErr *error) ([]byte, error) {
+	if *readErr != nil {
+		return nil, *readErr
+	}
+	line, err := r.ReadBytes('\n')
+	raw.Write(line)
+	if err != nil {
+		if len(line) == 0 {
+			return nil, err
+		}
+		*readErr = err
+		return line, nil
+	}
+	line = line[:len(line)-1]
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	return line, nil
+}
+
+// defaultSubtype returns the media type to use in place of mediatype, a top-level type lacking the
+// required subtype.  Text defaults to plain and multipart to mixed, as for unrecognized subtypes of
+// those types; others are treated as application/octet-stream, RFC 2046.
+func defaultSubtype(mediatype string) string {
+	switch mediatype {
+	case "text":
+		return ctTextPlain
+	case "multipart":
+		return ctMultipartMixed
+	}
+	return ctAppOctetStream
+}
+
+// requiresIdentityEncoding returns true for the message media types that may only be sent with a
+// 7bit, 8bit or binary Content-Transfer-Encoding, RFC 2046 section 5.2.
+func requiresIdentityEncoding(mediatype string) bool {
+	switch mediatype {
+	case ctMessageRFC822, ctMessagePartial, ctMessageExternal:
+		return true
+	}
+	return false
+}
+
+// parseDate parses an RFC 5322 date, falling back to the non-standard dateLayouts.  Comments and
+// redundant whitespace are ignored.
+func parseDate(value string) (time.Time, error) {
+	value = unfoldHeader(value)
+	if t, err := mail.ParseDate(value); err == nil {
+		return t, nil
+	}
+	// Remove comments such as "(PDT)", then collapse whitespace
+	b := &bytes.Buffer{}
+	depth := 0
+	for _, r := range value {
+		switch {
+		case r == '(':
+			depth++
+		case r == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			b.WriteRune(r)
+		}
+	}
+	clean := strings.Join(strings.Fields(b.String()), " ")
+	if t, err := mail.ParseDate(clean); err == nil {
+		return t, nil
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, clean); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Unable to parse date %q", value)
+}
+
+// removeControlChars returns s without ASCII control characters other than tab, which are not
+// permitted in header lines.  s is returned as-is if there are none.
+func removeControlChars(s []byte) []byte {
+	var clean []byte
+	for i, b := range s {
+		if (b < ' ' && b != '\t') || b == 0x7f {
+			if clean == nil {
+				clean = append(make([]byte, 0, len(s)), s[:i]...)
+			}
+			continue
+		}
+		if clean != nil {
+			clean = append(clean, b)
+		}
+	}
+	if clean == nil {
+		return s
+	}
+	return clean
+}
+
+// unfoldHeader removes folding line breaks from a header value, RFC 5322 section 2.2.3.
+func unfoldHeader(value string) string {
+	if !strings.ContainsAny(value, "\r\n") {
+		return value
+	}
+	return strings.NewReplacer("\r", "", "\n", "").Replace(value)
+}
+
 // decodeHeader decodes a single line (per RFC 2047) using Golang's mime.WordDecoder
 func decodeHeader(input string) string {
+	header, _ := decodeHeaderErr(input)
+	return header
+}
+
+// decodeHeaderErr decodes a single line (per RFC 2047) using Golang's mime.WordDecoder.  If
+// decoding fails the input is returned unaltered, along with the error.  Encoded-words in an
+// unsupported character set are decoded without charset conversion, replacing bytes that are not
+// valid UTF-8 with U+FFFD, and the error is returned along with the result.
+func decodeHeaderErr(input string) (string, error) {
 	if !strings.Contains(input, "=?") {
 		// Don't scan if there is nothing to do here
-		return input
+		return input, nil
 	}
 
+	var charsetErr error
 	dec := new(mime.WordDecoder)
-	dec.CharsetReader = coding.NewCharsetReader
-	header, err := dec.DecodeHeader(input)
+	dec.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		// Remove the RFC 2231 language suffix permitted in encoded-words, as in "utf-8*en"
+		if i := strings.IndexByte(charset, '*'); i > 0 {
+			charset = charset[:i]
+		}
+		r, err := coding.NewCharsetReader(charset, input)
+		if err != nil {
+			if strings.IndexFunc(charset, unicode.IsControl) >= 0 {
+				// Malformed encoded-word, leave the header as is
+				return nil, err
+			}
+			// Pass the decoded bytes through unconverted, as far as they are valid UTF-8
+			charsetErr = err
+			return coding.NewUTF8Reader(input), nil
+		}
+		return r, nil
+	}
+	header, err := dec.DecodeHeader(joinEncodedWords(input))
 	if err != nil {
+		return input, err
+	}
+	return header, charsetErr
+}
+
+// encodedWord is an RFC 2047 encoded-word found within a header value.
+type encodedWord struct {
+	start, end int // Position of the encoded-word within the header value
+	charset    string
+	encoding   byte // 'B' or 'Q'
+	text       string
+}
+
+// String formats the encodedWord as an encoded-word.
+func (w encodedWord) String() string {
+	return "=?" + w.charset + "?" + string(w.encoding) + "?" + w.text + "?="
+}
+
+// nextEncodedWord returns the first well formed encoded-word in input starting at or after
+// position i.
+func nextEncodedWord(input string, i int) (encodedWord, bool) {
+	for {
+		start := strings.Index(input[i:], "=?")
+		if start < 0 {
+			return encodedWord{}, false
+		}
+		start += i
+		i = start + 2
+		fields := strings.SplitN(input[start+2:], "?", 4)
+		if len(fields) < 4 || !strings.HasPrefix(fields[3], "=") || len(fields[1]) != 1 ||
+			fields[0] == "" || strings.ContainsAny(fields[0]+fields[2], " \t\r\n") {
+			continue
+		}
+		encoding := fields[1][0] &^ 0x20 // Upper case
+		if encoding != 'B' && encoding != 'Q' {
+			continue
+		}
+		end := start + len(fields[0]) + len(fields[1]) + len(fields[2]) + 6
+		return encodedWord{start, end, fields[0], encoding, fields[2]}, true
+	}
+}
+
+// joinEncodedWords merges adjacent encoded-words sharing a charset and encoding into a single
+// encoded-word, dropping the whitespace between them as RFC 2047 requires.  Encoders may split the
+// bytes of a multi-byte character between encoded-words, which must be joined before charset
+// conversion to decode correctly.
+func joinEncodedWords(input string) string {
+	prev, ok := nextEncodedWord(input, 0)
+	if !ok {
 		return input
 	}
-	return header
+	buf := new(bytes.Buffer)
+	last := 0
+	for {
+		next, ok := nextEncodedWord(input, prev.end)
+		if !ok {
+			break
+		}
+		if strings.TrimLeft(input[prev.end:next.start], " \t\r\n") == "" &&
+			strings.EqualFold(prev.charset, next.charset) && prev.encoding == next.encoding {
+			if text, ok := joinEncodedText(prev.encoding, prev.text, next.text); ok {
+				prev.text = text
+				prev.end = next.end
+				continue
+			}
+		}
+		buf.WriteString(input[last:prev.start])
+		buf.WriteString(prev.String())
+		last = prev.end
+		prev = next
+	}
+	buf.WriteString(input[last:prev.start])
+	buf.WriteString(prev.String())
+	buf.WriteString(input[prev.end:])
+	return buf.String()
+}
+
+// joinEncodedText concatenates the encoded text of two encoded-words.  Returns false if base64
+// text could not be decoded.
+func joinEncodedText(encoding byte, a, b string) (string, bool) {
+	if encoding == 'Q' {
+		return a + b, true
+	}
+	da, err := base64.StdEncoding.DecodeString(a)
+	if err != nil {
+		return "", false
+	}
+	db, err := base64.StdEncoding.DecodeString(b)
+	if err != nil {
+		return "", false
+	}
+	return base64.StdEncoding.EncodeToString(append(da, db...)), true
 }
 
 // decodeToUTF8Base64Header decodes a MIME header per RFC 2047, reencoding to =?utf-8b?
@@ -186,8 +491,33 @@ func decodeToUTF8Base64Header(input string) string {
 	return strings.Join(output, " ")
 }
 
+// parseTransferEncoding returns the lowercase mechanism from a Content-Transfer-Encoding header
+// value, with surrounding whitespace and RFC 822 comments removed.
+func parseTransferEncoding(value string) string {
+	if !strings.Contains(value, "(") {
+		return strings.ToLower(strings.TrimSpace(value))
+	}
+	b := make([]byte, 0, len(value))
+	depth := 0
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; {
+		case c == '\\' && depth > 0:
+			// Skip quoted-pair within comment
+			i++
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case depth == 0:
+			b = append(b, c)
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(string(b)))
+}
+
 // parseMediaType is a more tolerant implementation of Go's mime.ParseMediaType function.
 func parseMediaType(ctype string) (mtype string, params map[string]string, err error) {
+	ctype = fixUnquotedEncodedWords(fixRFC2231Charsets(ctype))
 	mtype, params, err = mime.ParseMediaType(ctype)
 	if err != nil {
 		// Small hack to remove harmless charset duplicate params.
@@ -201,13 +531,34 @@ func parseMediaType(ctype string) (mtype string, params map[string]string, err e
 			}
 			mtype, params, err = mime.ParseMediaType(mctype)
 			if err != nil {
-				return "", nil, err
+				// A boundary containing whitespace may have been left unquoted.
+				if fixed := fixUnquotedBoundary(ctype); fixed != ctype {
+					mtype, params, err = mime.ParseMediaType(fixed)
+				}
+				if err != nil && len(valuelessParams(ctype)) > 0 {
+					// Parameters lacking a value are rejected by mime.ParseMediaType.
+					mtype, params, err = salvageMediaType(ctype)
+				}
+				if err != nil {
+					return "", nil, err
+				}
 			}
 		}
 	}
 	return mtype, params, err
 }
 
+// cleanBoundary removes quotes and trailing whitespace left in a boundary parameter value by
+// broken mail software.  RFC 2046 does not permit quotes within a boundary, nor whitespace at its
+// end.
+func cleanBoundary(boundary string) string {
+	b := strings.TrimRight(boundary, " \t")
+	for len(b) >= 2 && (b[0] == '"' || b[0] == '\'') && b[len(b)-1] == b[0] {
+		b = strings.TrimRight(b[1:len(b)-1], " \t")
+	}
+	return b
+}
+
 // fixMangledMediaType is used to insert ; separators into media type strings that lack them, and
 // remove repeated parameters.
 func fixMangledMediaType(mtype, sep string) string {
@@ -229,6 +580,264 @@ func fixMangledMediaType(mtype, sep string) string {
 	return mtype
 }
 
+// fixRFC2231Charsets rewrites RFC 2231 extended parameters declared in a character set other than
+// utf-8 or us-ascii, which mime.ParseMediaType discards, into their utf-8 equivalent.  Continued
+// parameters are reassembled before conversion, as a multi-byte character may span segments.
+func fixRFC2231Charsets(ctype string) string {
+	if !strings.Contains(ctype, "*=") {
+		return ctype
+	}
+	type piece struct {
+		value   string
+		encoded bool
+	}
+	segs := splitMediaParams(ctype)
+	owner := make([]string, len(segs))
+	pieces := make(map[string]map[int]piece)
+	for i := 1; i < len(segs); i++ {
+		eq := strings.Index(segs[i], "=")
+		if eq < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(segs[i][:eq]))
+		if !strings.Contains(key, "*") {
+			continue
+		}
+		p := piece{value: strings.TrimSpace(segs[i][eq+1:])}
+		if strings.HasSuffix(key, "*") {
+			p.encoded = true
+			key = key[:len(key)-1]
+		}
+		index := 0
+		if star := strings.Index(key, "*"); star >= 0 {
+			n, err := strconv.Atoi(key[star+1:])
+			if err != nil {
+				continue
+			}
+			key, index = key[:star], n
+		}
+		if pieces[key] == nil {
+			pieces[key] = make(map[int]piece)
+		}
+		pieces[key][index] = p
+		owner[i] = key
+	}
+
+	keys := make([]string, 0, len(pieces))
+	for key := range pieces {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	replaced := make(map[string]string)
+	for _, key := range keys {
+		first := pieces[key][0]
+		if !first.encoded {
+			continue
+		}
+		fields := strings.SplitN(first.value, "'", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		charset := strings.ToLower(fields[0])
+		if charset == "" || charset == utf8 || charset == "us-ascii" {
+			// Supported by mime.ParseMediaType.
+			continue
+		}
+		var raw []byte
+		for n := 0; ; n++ {
+			p, ok := pieces[key][n]
+			if !ok {
+				break
+			}
+			if n == 0 {
+				p.value = fields[2]
+			}
+			if p.encoded {
+				raw = append(raw, percentUnescape(p.value)...)
+			} else {
+				raw = append(raw, unquoteParamValue(p.value)...)
+			}
+		}
+		value, err := coding.ConvertToUTF8String(charset, raw)
+		if err != nil {
+			continue
+		}
+		replaced[key] = key + "*=utf-8''" + percentEscape(value)
+	}
+	if len(replaced) == 0 {
+		return ctype
+	}
+
+	result := segs[0]
+	for i := 1; i < len(segs); i++ {
+		if _, ok := replaced[owner[i]]; ok {
+			continue
+		}
+		result += ";" + segs[i]
+	}
+	for _, key := range keys {
+		if param, ok := replaced[key]; ok {
+			result += "; " + param
+		}
+	}
+	return result
+}
+
+// fixUnquotedEncodedWords quotes parameter values made up of several whitespace separated RFC 2047
+// encoded-words, which broken mail software fails to quote; mime.ParseMediaType rejects them.
+func fixUnquotedEncodedWords(ctype string) string {
+	if !strings.Contains(ctype, "=?") {
+		return ctype
+	}
+	segs := splitMediaParams(ctype)
+	fixed := false
+	for i := 1; i < len(segs); i++ {
+		eq := strings.Index(segs[i], "=")
+		if eq < 0 {
+			continue
+		}
+		value := strings.TrimSpace(segs[i][eq+1:])
+		if strings.HasPrefix(value, "=?") && strings.ContainsAny(value, " \t") &&
+			!strings.ContainsAny(value, "\"\\") {
+			segs[i] = segs[i][:eq+1] + `"` + value + `"`
+			fixed = true
+		}
+	}
+	if !fixed {
+		return ctype
+	}
+	return strings.Join(segs, ";")
+}
+
+// fixUnquotedBoundary quotes a boundary parameter value containing whitespace that broken mail
+// software left unquoted, or quoted with single quotes, such as boundary=simple boundary; the
+// value runs to the next semicolon.  mime.ParseMediaType rejects such values.
+func fixUnquotedBoundary(ctype string) string {
+	segs := splitMediaParams(ctype)
+	fixed := false
+	for i := 1; i < len(segs); i++ {
+		eq := strings.Index(segs[i], "=")
+		if eq < 0 || !strings.EqualFold(strings.TrimSpace(segs[i][:eq]), hpBoundary) {
+			continue
+		}
+		value := strings.TrimSpace(segs[i][eq+1:])
+		if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		}
+		if value != "" && !strings.HasPrefix(value, `"`) && !strings.ContainsAny(value, "\"\\") {
+			segs[i] = segs[i][:eq+1] + `"` + value + `"`
+			fixed = true
+		}
+	}
+	if !fixed {
+		return ctype
+	}
+	return strings.Join(segs, ";")
+}
+
+// valuelessParams returns the names of the parameters of ctype that lack a value, such as charset
+// in "text/plain; charset".
+func valuelessParams(ctype string) []string {
+	var names []string
+	for _, s := range splitMediaParams(ctype)[1:] {
+		s = strings.TrimSpace(s)
+		if s != "" && !strings.Contains(s, "=") {
+			names = append(names, s)
+		}
+	}
+	return names
+}
+
+// salvageMediaType parses ctype ignoring any parameters that lack a value.  Should the remaining
+// parameters still fail to parse, the media type preceding the first semicolon is returned alone.
+func salvageMediaType(ctype string) (mtype string, params map[string]string, err error) {
+	segs := splitMediaParams(ctype)
+	kept := []string{segs[0]}
+	for _, s := range segs[1:] {
+		if strings.Contains(s, "=") {
+			kept = append(kept, s)
+		}
+	}
+	if len(kept) > 1 {
+		mtype, params, err = parseMediaType(strings.Join(kept, ";"))
+		if err == nil {
+			return mtype, params, nil
+		}
+	}
+	return mime.ParseMediaType(strings.TrimSpace(segs[0]))
+}
+
+// splitMediaParams splits a media type string on semicolons that are not inside quoted strings.
+func splitMediaParams(ctype string) []string {
+	var segs []string
+	start, quoted := 0, false
+	for i := 0; i < len(ctype); i++ {
+		switch ctype[i] {
+		case '\\':
+			if quoted {
+				i++
+			}
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				segs = append(segs, ctype[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(segs, ctype[start:])
+}
+
+// unquoteParamValue removes the quotes and escapes from a quoted-string parameter value, unquoted
+// values are returned as is.
+func unquoteParamValue(v string) string {
+	if len(v) < 2 || v[0] != '"' || v[len(v)-1] != '"' {
+		return v
+	}
+	v = v[1 : len(v)-1]
+	b := make([]byte, 0, len(v))
+	for i := 0; i < len(v); i++ {
+		if v[i] == '\\' && i+1 < len(v) {
+			i++
+		}
+		b = append(b, v[i])
+	}
+	return string(b)
+}
+
+// percentUnescape decodes %XX escapes, invalid escapes are passed through untouched.
+func percentUnescape(v string) []byte {
+	b := make([]byte, 0, len(v))
+	for i := 0; i < len(v); i++ {
+		if v[i] == '%' && i+2 < len(v) {
+			if n, err := strconv.ParseUint(v[i+1:i+3], 16, 8); err == nil {
+				b = append(b, byte(n))
+				i += 2
+				continue
+			}
+		}
+		b = append(b, v[i])
+	}
+	return b
+}
+
+// percentEscape encodes all bytes that are not RFC 2231 attribute-chars as %XX escapes.
+func percentEscape(v string) string {
+	const hex = "0123456789ABCDEF"
+	b := make([]byte, 0, len(v)*3)
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+			strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b = append(b, c)
+			continue
+		}
+		b = append(b, '%', hex[c>>4], hex[c&0x0f])
+	}
+	return string(b)
+}
+
 // Detects a RFC-822 linear-white-space, passed to strings.FieldsFunc
 func whiteSpaceRune(r rune) bool {
 	return r == ' ' || r == '\t' || r == '\r' || r == '\n'
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"strings"
 	"testing"
+	"time"
 )
 
 // Ensure that a single plain text token passes unharmed
@@ -117,6 +118,59 @@ func TestSpacing(t *testing.T) {
 	}
 }
 
+// Q encoding represents space as underscore, only within encoded-words
+func TestQEncodingUnderscore(t *testing.T) {
+	var testTable = []struct {
+		in, want string
+		err      bool
+	}{
+		{in: "=?utf-8?Q?Hello_World?=", want: "Hello World"},
+		{in: "=?UTF-8?q?Hello_World?=", want: "Hello World"},
+		{in: "=?utf-8?Q?snake=5Fcase?=", want: "snake_case"},
+		{in: "=?utf-8?Q?a_=5F_b?=", want: "a _ b"},
+		{in: "plain_text =?utf-8?Q?Hello_World?= more_text", want: "plain_text Hello World more_text"},
+		{in: "=?utf-8?B?SGVsbG9fV29ybGQ=?=", want: "Hello_World"},
+		{in: "=?utf-8*en?Q?Hello_World?=", want: "Hello World"},
+		{in: "=?x-unknown?Q?Hello_World?=", want: "Hello World", err: true},
+		{in: "=?x-unknown?Q?Caf=E9_cr=E8me?=", want: "Caf\uFFFD cr\uFFFDme", err: true},
+		{in: "=?x-unknown?B?/w==?=", want: "\uFFFD", err: true},
+	}
+
+	for _, tt := range testTable {
+		got, err := decodeHeaderErr(tt.in)
+		if got != tt.want {
+			t.Errorf("decodeHeaderErr(%q) == %q, want: %q", tt.in, got, tt.want)
+		}
+		if (err != nil) != tt.err {
+			t.Errorf("decodeHeaderErr(%q) returned error %v, want error: %v", tt.in, err, tt.err)
+		}
+	}
+}
+
+// Adjacent encoded-words are joined before decoding
+func TestAdjacentEncodedWords(t *testing.T) {
+	var testTable = []struct {
+		in, want string
+	}{
+		{"=?utf-8?B?w6lw?= =?utf-8?B?w6kucGRm?=", "\u00e9p\u00e9.pdf"},
+		{"=?utf-8?B?w6lw?=\r\n =?UTF-8?b?w6kucGRm?=", "\u00e9p\u00e9.pdf"},
+		{"=?utf-8?B?w6lw?= and =?utf-8?B?w6kucGRm?=", "\u00e9p and \u00e9.pdf"},
+		{"=?utf-8?Q?caf=C3?= =?utf-8?Q?=A9?=", "caf\u00e9"},
+		// Multi-byte character split between encoded-words
+		{"=?shift_jis?B?k/qW?= =?shift_jis?B?ew==?=", "\u65e5\u672c"},
+		{"=?shift_jis?B?k/qW?=\t=?shift_jis?B?ew==?=.txt", "\u65e5\u672c.txt"},
+		// Differing encodings are decoded separately
+		{"=?utf-8?B?w6lw?= =?utf-8?Q?=C3=A9.pdf?=", "\u00e9p\u00e9.pdf"},
+	}
+
+	for _, tt := range testTable {
+		got := decodeHeader(tt.in)
+		if got != tt.want {
+			t.Errorf("DecodeHeader(%q) == %q, want: %q", tt.in, got, tt.want)
+		}
+	}
+}
+
 // Test some different character sets
 func TestCharsets(t *testing.T) {
 	var testTable = []struct {
@@ -125,6 +179,8 @@ func TestCharsets(t *testing.T) {
 		{"=?utf-8?q?abcABC_=24_=c2=a2_=e2=82=ac?=", "abcABC $ \u00a2 \u20ac"},
 		{"=?iso-8859-1?q?#=a3_c=a9_r=ae_u=b5?=", "#\u00a3 c\u00a9 r\u00ae u\u00b5"},
 		{"=?big5?q?=a1=5d_=a1=61_=a1=71?=", "\uff08 \uff5b \u3008"},
+		{"=?gb2312?B?1tDOxNPKvP4=?=", "\u4e2d\u6587\u90ae\u4ef6"},
+		{"=?GB2312?b?1tDOxNPKvP4=?= report", "\u4e2d\u6587\u90ae\u4ef6 report"},
 	}
 
 	for _, tt := range testTable {
@@ -357,3 +413,187 @@ func TestReadHeader(t *testing.T) {
 		}
 	}
 }
+
+func TestParseMediaTypeRFC2231(t *testing.T) {
+	testCases := []struct {
+		label, input, want string
+	}{
+		{
+			label: "utf-8 single",
+			input: "attachment; filename*=utf-8''%E6%97%A5%E6%9C%AC%E8%AA%9E.txt",
+			want:  "日本語.txt",
+		},
+		{
+			label: "utf-8 continued",
+			input: "attachment; filename*0*=utf-8''%E6%97%A5%E6%9C%AC%E8%AA%9E%E3%83;" +
+				" filename*1*=%86%E3%82%B9%E3%83%88; filename*2=\".txt\"",
+			want: "日本語テスト.txt",
+		},
+		{
+			label: "shift_jis single",
+			input: "attachment; filename*=Shift_JIS''%93%FA%96%7B%8C%EA.txt",
+			want:  "日本語.txt",
+		},
+		{
+			label: "shift_jis continued",
+			input: "attachment; filename*0*=shift_jis'ja'%93%FA%96%7B;" +
+				" filename*1*=%8C%EA; filename*2=\".txt\"",
+			want: "日本語.txt",
+		},
+		{
+			label: "iso-8859-1 with plain parameter",
+			input: "attachment; size=12; filename*=iso-8859-1''caf%E9%3Bcr%E8me.txt",
+			want:  "café;crème.txt",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			mtype, params, err := parseMediaType(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mtype != "attachment" {
+				t.Errorf("mtype got %q, want %q", mtype, "attachment")
+			}
+			got := params[hpFilename]
+			if got != tc.want {
+				t.Errorf("filename got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseMediaTypeUnquotedEncodedWords(t *testing.T) {
+	input := "application/pdf; name==?utf-8?B?w6lw?=\t=?utf-8?B?w6kucGRm?=; size=10"
+	mtype, params, err := parseMediaType(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mtype != "application/pdf" {
+		t.Errorf("mtype got %q, want %q", mtype, "application/pdf")
+	}
+	want := "=?utf-8?B?w6lw?=\t=?utf-8?B?w6kucGRm?="
+	if got := params[hpName]; got != want {
+		t.Errorf("name got %q, want %q", got, want)
+	}
+	if got := params["size"]; got != "10" {
+		t.Errorf("size got %q, want %q", got, "10")
+	}
+}
+
+func TestParseMediaTypeBoundary(t *testing.T) {
+	testCases := []struct {
+		input, want string
+	}{
+		{`multipart/mixed; boundary="simple boundary"`, "simple boundary"},
+		{`multipart/mixed; boundary="simple: boundary"`, "simple: boundary"},
+		{`multipart/mixed; boundary="simple boundary"; charset=us-ascii`, "simple boundary"},
+		{`multipart/mixed; boundary=simple boundary`, "simple boundary"},
+		{`multipart/mixed; boundary=simple boundary ; charset=us-ascii`, "simple boundary"},
+		{`multipart/mixed; boundary='simple boundary'`, "simple boundary"},
+		{`multipart/mixed; boundary='simple'`, "simple"},
+		{`multipart/mixed; boundary="\"simple boundary\""`, "simple boundary"},
+		{`multipart/mixed; boundary="simple boundary  "`, "simple boundary"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			_, params, err := parseMediaType(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := cleanBoundary(params[hpBoundary]); got != tc.want {
+				t.Errorf("boundary got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseMediaTypeValuelessParam(t *testing.T) {
+	testCases := []struct {
+		input, mtype, charset string
+	}{
+		{"text/plain; charset", "text/plain", ""},
+		{"text/plain;charset;", "text/plain", ""},
+		{"text/html; charset=utf-8; format", "text/html", "utf-8"},
+		{"text/html; format; charset=\"utf-8\"", "text/html", "utf-8"},
+		{"text/plain; charset; name=a=b=c", "text/plain", ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			mtype, params, err := parseMediaType(tc.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if mtype != tc.mtype {
+				t.Errorf("mtype got %q, want %q", mtype, tc.mtype)
+			}
+			if got := params[hpCharset]; got != tc.charset {
+				t.Errorf("charset got %q, want %q", got, tc.charset)
+			}
+		})
+	}
+}
+
+func TestParseTransferEncoding(t *testing.T) {
+	testCases := []struct {
+		input, want string
+	}{
+		{"", ""},
+		{"base64", "base64"},
+		{"BASE64", "base64"},
+		{"base64 ", "base64"},
+		{" quoted-printable", "quoted-printable"},
+		{"\tQuoted-Printable\t", "quoted-printable"},
+		{"base64 (encoded by Exchange)", "base64"},
+		{"(comment) 7bit", "7bit"},
+		{"8bit (nested (comment) \\) here)", "8bit"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			got := parseTransferEncoding(tc.input)
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	want := time.Date(2012, 10, 19, 19, 22, 49, 0, time.UTC)
+	testCases := []string{
+		"Fri, 19 Oct 2012 12:22:49 -0700",
+		"Fri, 19 Oct 2012 12:22:49 -0700 (PDT)",
+		"Fri,  19 Oct 2012 12:22:49\r\n -0700",
+		"19 Oct 2012 12:22:49 -0700",
+		"Fri, 19 Oct 2012 19:22:49 GMT",
+		"Fri, 19 Oct 2012 19:22:49 UT",
+		"Fri, 19 Oct 2012 19:22:49 +0000 GMT",
+		"Fri 19 Oct 2012 12:22:49 -0700",
+		"Fri, 19 Oct 12 12:22:49 -0700",
+		"Fri, 19 October 2012 12:22:49 -0700",
+		"Friday, 19 Oct 2012 12:22:49 -0700",
+		"Friday, 19-Oct-12 19:22:49 UTC",
+		"Fri Oct 19 19:22:49 2012",
+		"Fri Oct 19 12:22:49 -0700 2012",
+		"2012-10-19T12:22:49-07:00",
+		"2012-10-19 12:22:49 -0700",
+		"2012-10-19 19:22:49",
+	}
+	for _, tc := range testCases {
+		t.Run(tc, func(t *testing.T) {
+			got, err := parseDate(tc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+
+	for _, tc := range []string{"", "yesterday", "Fri, 32 Oct 2012 12:22:49 -0700"} {
+		if got, err := parseDate(tc); err == nil {
+			t.Errorf("parseDate(%q) got %v, want error", tc, got)
+		}
+	}
+}
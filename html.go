@@ -0,0 +1,116 @@
+package enmime
+
+import (
+	"bytes"
+	"html"
+	"strings"
+)
+
+// htmlBlockTags are the elements that begin a new line when tags are stripped from HTML.
+var htmlBlockTags = map[string]bool{
+	"address": true, "blockquote": true, "br": true, "dd": true, "div": true, "dl": true,
+	"dt": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "hr": true,
+	"li": true, "ol": true, "p": true, "pre": true, "table": true, "td": true, "th": true,
+	"tr": true, "ul": true,
+}
+
+// stripHTMLTags returns the text of an HTML document with its tags, comments, head, scripts and
+// style sheets removed and character references decoded.  Block elements start new lines, blank lines
+// and repeated whitespace are removed.  It is a simple filter for indexing, not a renderer; see
+// html2text for that.
+func stripHTMLTags(s string) string {
+	b := &bytes.Buffer{}
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i == -1 {
+			b.WriteString(s)
+			break
+		}
+		b.WriteString(s[:i])
+		s = s[i:]
+		if len(s) < 2 || !isHTMLTagStart(s[1]) {
+			// Not markup, such as "a < b"
+			b.WriteByte('<')
+			s = s[1:]
+			continue
+		}
+		if strings.HasPrefix(s, "<!--") {
+			// Comment
+			if end := strings.Index(s, "-->"); end != -1 {
+				s = s[end+3:]
+			} else {
+				s = ""
+			}
+			continue
+		}
+		end := strings.IndexByte(s, '>')
+		if end == -1 {
+			// Unterminated tag
+			break
+		}
+		closing := s[1] == '/'
+		name := htmlTagName(s[1:end])
+		s = s[end+1:]
+		switch {
+		case (name == "script" || name == "style" || name == "title") && !closing:
+			// Skip content up to the closing tag
+			s = s[indexTag(s, "</"+name):]
+		case name == "head" && !closing:
+			// The closing tag of head is optional, body ends it too
+			end := indexTag(s, "</head")
+			if body := indexTag(s, "<body"); body < end {
+				end = body
+			}
+			s = s[end:]
+		case htmlBlockTags[name]:
+			b.WriteByte('\n')
+		}
+	}
+
+	// Tidy whitespace
+	lines := strings.Split(html.UnescapeString(b.String()), "\n")
+	out := lines[:0]
+	for _, line := range lines {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			out = append(out, line)
+		}
+	}
+	return strings.Join(out, "\n")
+}
+
+// indexTag returns the index in s of tag, the start of an opening or closing tag such as "<body"
+// or "</script", matched without regard to ASCII case, or len(s) if there is none.  s is not case
+// folded as a whole, as that may change its length.
+func indexTag(s, tag string) int {
+	for i := 0; i+len(tag) <= len(s); i++ {
+		if s[i] != '<' || !strings.EqualFold(s[i:i+len(tag)], tag) {
+			continue
+		}
+		if j := i + len(tag); j < len(s) && isHTMLNameChar(s[j]) {
+			// A longer name, such as "</header"
+			continue
+		}
+		return i
+	}
+	return len(s)
+}
+
+// isHTMLTagStart returns true if c may follow the < that opens a tag, comment or declaration.
+func isHTMLTagStart(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || c == '/' || c == '!' || c == '?'
+}
+
+// isHTMLNameChar returns true if c may continue an element name.
+func isHTMLNameChar(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || c == '-'
+}
+
+// htmlTagName returns the lowercase element name from the inside of an opening or closing tag,
+// such as "/p" or "img src=x".
+func htmlTagName(tag string) string {
+	tag = strings.TrimPrefix(tag, "/")
+	if i := strings.IndexAny(tag, " \t\r\n/"); i != -1 {
+		tag = tag[:i]
+	}
+	return strings.ToLower(tag)
+}
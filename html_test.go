@@ -0,0 +1,40 @@
+package enmime
+
+import "testing"
+
+func TestStripHTMLTags(t *testing.T) {
+	ttable := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"empty", "", ""},
+		{"plain", "Hello World", "Hello World"},
+		{"inline tags", "Hello <b>bold</b> <a href=\"x\">World</a>", "Hello bold World"},
+		{"block tags", "<p>One</p><p>Two<br>Three</p>", "One\nTwo\nThree"},
+		{"document", "<html>\r\n<head><title>T</title></head>\r\n<body>\r\n" +
+			"  <div>Body  text</div>\r\n</body></html>", "Body text"},
+		{"head", "<HEAD><meta charset=\"utf-8\"><TITLE>Title</TITLE>\r\n" +
+			"<style>p {}</style></HEAD><header>Header</header>", "Header"},
+		{"head unclosed", "<html><head><title>Title</title><body><p>Text</p></body>", "Text"},
+		{"title in body", "<body><title>Title</title><p>Text</p></body>", "Text"},
+		{"script", "<script type=\"x\">if (a < b) {}</script>Text<SCRIPT>x</SCRIPT>", "Text"},
+		{"style", "<style>p { color: red; }</style><p>Text</p>", "Text"},
+		{"script invalid utf-8", "<script>\xff\xff\xff</script>Text", "Text"},
+		{"script case change", "<script>\u0130\u0130\u0130</script>Text", "Text"},
+		{"script unterminated", "Text<script>\xff\u0130", "Text"},
+		{"comment", "One<!-- <p>hidden</p> -->Two", "OneTwo"},
+		{"entities", "Caf&eacute; &amp; &lt;tea&gt;", "Café & <tea>"},
+		{"less than", "a < b and c<5", "a < b and c<5"},
+		{"unterminated", "Text<a href", "Text"},
+		{"doctype", "<!DOCTYPE html><p>Text</p>", "Text"},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripHTMLTags(tt.input); got != tt.want {
+				t.Errorf("got: %q, want: %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -17,14 +17,24 @@ var base64CleanerTable = []int8{
 	41, 42, 43, 44, 45, 46, 47, 48, 49, 50, 51, -1, -1, -1, -1, -1,
 }
 
+// maxBase64LineLen is the longest encoded line permitted by RFC 2045, excluding the line ending.
+const maxBase64LineLen = 76
+
 // Base64Cleaner improves the tolerance of in Go's built-in base64 decoder by stripping out
 // characters that would cause decoding to fail.
 type Base64Cleaner struct {
 	// Report of non-whitespace characters detected while cleaning base64 data.
 	Errors []error
+	// Count of characters stripped with an error.
+	IllegalChars int
+	// Count of lines exceeding the RFC 2045 limit of 76 characters.
+	LongLines int
 
-	r      io.Reader
-	buffer [1024]byte
+	r       io.Reader
+	buffer  [1024]byte
+	lineLen int // Length of the current line
+	dataLen int // Count of base64 alphabet characters
+	padLen  int // Count of padding characters
 }
 
 // Enforce io.Reader interface.
@@ -49,16 +59,69 @@ func (bc *Base64Cleaner) Read(p []byte) (n int, err error) {
 	buf := bc.buffer[:size]
 	bn, err := bc.r.Read(buf)
 	for i := 0; i < bn; i++ {
+		switch buf[i] {
+		case '\n':
+			bc.endLine()
+		case '\r':
+		default:
+			bc.lineLen++
+		}
 		switch base64CleanerTable[buf[i]&0x7f] {
 		case -2:
 			// Strip these silently: tab, \n, \r, space, equals sign.
+			if buf[i] == '=' {
+				bc.padLen++
+			}
 		case -1:
 			// Strip these, but warn the client.
 			bc.Errors = append(bc.Errors, fmt.Errorf("Unexpected %q in Base64 stream", buf[i]))
+			bc.IllegalChars++
 		default:
 			p[n] = buf[i]
 			n++
+			bc.dataLen++
 		}
 	}
+	if err == io.EOF {
+		bc.endLine()
+	}
 	return
 }
+
+// MissingPadding returns true if the base64 data read so far was not padded to a multiple of four
+// characters.
+func (bc *Base64Cleaner) MissingPadding() bool {
+	return (bc.dataLen+bc.padLen)%4 != 0
+}
+
+// endLine checks the length of the line just completed.
+func (bc *Base64Cleaner) endLine() {
+	if bc.lineLen > maxBase64LineLen {
+		bc.LongLines++
+	}
+	bc.lineLen = 0
+}
+
+// LooksLikeBase64 returns true if b appears to be base64 encoded: it contains only base64 alphabet
+// characters and line breaks, padding appears only at the end, and the encoded length is a
+// multiple of four.  Plain text rarely satisfies these conditions, as it contains spaces.
+func LooksLikeBase64(b []byte) bool {
+	dataLen, padLen := 0, 0
+	for _, c := range b {
+		switch {
+		case c == '\r' || c == '\n':
+			continue
+		case c == '=':
+			padLen++
+		case c < 0x80 && base64CleanerTable[c] >= 0:
+			if padLen > 0 {
+				// Data following padding
+				return false
+			}
+			dataLen++
+		default:
+			return false
+		}
+	}
+	return dataLen > 0 && padLen <= 2 && (dataLen+padLen)%4 == 0
+}
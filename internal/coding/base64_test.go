@@ -2,6 +2,7 @@ package coding_test
 
 import (
 	"io"
+	"io/ioutil"
 	"strings"
 	"testing"
 
@@ -64,3 +65,65 @@ func TestBase64CleanerErrors(t *testing.T) {
 		})
 	}
 }
+
+// TestBase64CleanerAnomalies tests counting of non-conformant input
+func TestBase64CleanerAnomalies(t *testing.T) {
+	long := strings.Repeat("QUJD", 20)
+	testCases := []struct {
+		label, input       string
+		illegal, longLines int
+		missingPadding     bool
+	}{
+		{"conformant", "QUJD\r\nQUI=\r\n", 0, 0, false},
+		{"illegal", "QU!JD\r\nQU@I=\r\n", 2, 0, false},
+		{"long lines", long + "\r\n" + long + "\r\nQUJD\r\n", 0, 2, false},
+		{"long last line", "QUJD\r\n" + long, 0, 1, false},
+		{"limit", long[:76] + "\r\n", 0, 0, false},
+		{"missing padding", "QUJDQUI\r\n", 0, 0, true},
+		{"padding", "QUJDQQ==\r\n", 0, 0, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			cleaner := coding.NewBase64Cleaner(strings.NewReader(tc.input))
+			if _, err := ioutil.ReadAll(cleaner); err != nil {
+				t.Fatal(err)
+			}
+			if cleaner.IllegalChars != tc.illegal {
+				t.Errorf("IllegalChars got: %v, want: %v", cleaner.IllegalChars, tc.illegal)
+			}
+			if cleaner.LongLines != tc.longLines {
+				t.Errorf("LongLines got: %v, want: %v", cleaner.LongLines, tc.longLines)
+			}
+			if cleaner.MissingPadding() != tc.missingPadding {
+				t.Errorf("MissingPadding() got: %v, want: %v", cleaner.MissingPadding(), tc.missingPadding)
+			}
+		})
+	}
+}
+
+func TestLooksLikeBase64(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  bool
+	}{
+		{"", false},
+		{"\r\n", false},
+		{"dGVzdA==", true},
+		{"dGVz\r\ndA==\r\n", true},
+		{"JVBERi0xLjQKJcfsj6IKNSAwIG9iago8PC9MZW5ndGggNiAwIFIvRmlsdGVyIC9GbGF0ZURlY29kZT4+\n", true},
+		{"dGVzdA", false},
+		{"dGVzdA=", false},
+		{"dGV=zdA=", false},
+		{"dGVzdA===", false},
+		{"hello world\r\n", false},
+		{"dGVz dA==", false},
+		{"dGVz\tdA==", false},
+		{"dGVz-A==", false},
+		{"dGVz\xe9A==", false},
+	}
+	for _, tc := range testCases {
+		if got := coding.LooksLikeBase64([]byte(tc.input)); got != tc.want {
+			t.Errorf("LooksLikeBase64(%q) got: %v, want: %v", tc.input, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package coding
+
+import (
+	"bufio"
+	"io"
+)
+
+// utf8BOM is the UTF-8 encoding of the byte order mark, U+FEFF.
+const utf8BOM = "\xef\xbb\xbf"
+
+// BOMReader removes a byte order mark from the start of UTF-8 content.  A byte order mark
+// elsewhere in the content is left alone.
+type BOMReader struct {
+	r       *bufio.Reader
+	checked bool // The start of the content has been examined
+}
+
+// Assert BOMReader implements io.Reader.
+var _ io.Reader = &BOMReader{}
+
+// NewBOMReader returns a BOMReader for the specified reader.
+func NewBOMReader(r io.Reader) *BOMReader {
+	return &BOMReader{r: bufio.NewReader(r)}
+}
+
+// Read method for io.Reader interface.
+func (br *BOMReader) Read(p []byte) (int, error) {
+	if !br.checked {
+		br.checked = true
+		// Errors are left for Read to return
+		if head, _ := br.r.Peek(len(utf8BOM)); string(head) == utf8BOM {
+			_, _ = br.r.Discard(len(utf8BOM))
+		}
+	}
+	return br.r.Read(p)
+}
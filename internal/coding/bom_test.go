@@ -0,0 +1,62 @@
+package coding_test
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/jhillyerd/enmime/internal/coding"
+)
+
+func TestBOMReader(t *testing.T) {
+	ttable := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"empty", "", ""},
+		{"no bom", "text", "text"},
+		{"bom", "\xef\xbb\xbftext", "text"},
+		{"only bom", "\xef\xbb\xbf", ""},
+		{"partial bom", "\xef\xbbtext", "\xef\xbbtext"},
+		{"second bom", "\xef\xbb\xbf\xef\xbb\xbftext", "\xef\xbb\xbftext"},
+		{"inner bom", "te\xef\xbb\xbfxt", "te\xef\xbb\xbfxt"},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ioutil.ReadAll(coding.NewBOMReader(strings.NewReader(tt.input)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got: %q, want: %q", got, tt.want)
+			}
+
+			// One byte at a time
+			got, err = ioutil.ReadAll(
+				coding.NewBOMReader(iotest.OneByteReader(strings.NewReader(tt.input))))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("one byte reader got: %q, want: %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBOMReaderError(t *testing.T) {
+	want := errors.New("test error")
+	r := io.MultiReader(strings.NewReader("\xef\xbb\xbftext"), &errReader{err: want})
+	got, err := ioutil.ReadAll(coding.NewBOMReader(r))
+	if err != want {
+		t.Errorf("err got: %v, want: %v", err, want)
+	}
+	if string(got) != "text" {
+		t.Errorf("got: %q, want: %q", got, "text")
+	}
+}
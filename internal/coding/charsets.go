@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"regexp"
 	"strings"
+	"sync"
 
 	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/charmap"
@@ -253,6 +254,34 @@ var encodings = map[string]struct {
 	"136":                 {traditionalchinese.Big5, "big5"}, // same as chinese big5
 }
 
+// charsetAliases maps misspelled charset labels seen in the wild, that cannot be resolved by
+// ignoring punctuation, to a label in encodings.  Keys are in the form produced by looseCharsetKey.
+var charsetAliases = map[string]string{
+	"ansi":    "windows-1252",
+	"utf8mb3": "utf-8",
+	"utf8mb4": "utf-8",
+	"win1250": "windows-1250",
+	"win1251": "windows-1251",
+	"win1252": "windows-1252",
+	"win1253": "windows-1253",
+	"win1254": "windows-1254",
+	"win1255": "windows-1255",
+	"win1256": "windows-1256",
+	"win1257": "windows-1257",
+	"win1258": "windows-1258",
+}
+
+// looseEncodings maps the labels in encodings, with punctuation removed, to the original label.
+// Built by init, labels that would become ambiguous are left out.
+var looseEncodings = make(map[string]string)
+
+// charsetReaders holds charset reader factories registered by RegisterCharsetReader, keyed by
+// charsetKey.
+var (
+	charsetReadersMu sync.RWMutex
+	charsetReaders   = make(map[string]func(io.Reader) io.Reader)
+)
+
 var metaTagCharsetRegexp = regexp.MustCompile(
 	`(?i)<meta.*charset="?\s*(?P<charset>[a-zA-Z0-9_.:-]+)\s*"?`)
 var metaTagCharsetIndex int
@@ -265,18 +294,118 @@ func init() {
 			break
 		}
 	}
+
+	// Index encodings by loose label, excluding any that map to more than one charset
+	ambiguous := make(map[string]bool)
+	for label, csentry := range encodings {
+		key := looseCharsetKey(label)
+		if prev, ok := looseEncodings[key]; ok && encodings[prev].name != csentry.name {
+			ambiguous[key] = true
+		}
+		looseEncodings[key] = label
+	}
+	for key := range ambiguous {
+		delete(looseEncodings, key)
+	}
+}
+
+// looseCharsetKey lowercases charset and removes separator punctuation, so that "UTF_8", "utf-8"
+// and "utf8" produce the same key.  Other characters, such as control characters, are retained
+// and will prevent a match.
+func looseCharsetKey(charset string) string {
+	b := make([]byte, 0, len(charset))
+	for i := 0; i < len(charset); i++ {
+		c := charset[i]
+		switch {
+		case c == '-', c == '_', c == '.', c == ':', c == ' ':
+			continue
+		case 'A' <= c && c <= 'Z':
+			c += 'a' - 'A'
+		}
+		b = append(b, c)
+	}
+	return string(b)
+}
+
+// findCharset returns the encodings label matching charset.  Exact matches are preferred, followed
+// by known misspellings, and finally labels that differ only in case and punctuation.
+func findCharset(charset string) (label string, ok bool) {
+	label = strings.ToLower(strings.Trim(charset, " \t\"'"))
+	if _, ok = encodings[label]; ok {
+		return label, true
+	}
+	key := looseCharsetKey(label)
+	if label, ok = charsetAliases[key]; ok {
+		return label, true
+	}
+	label, ok = looseEncodings[key]
+	return label, ok
+}
+
+// NormalizeCharset returns the canonical name of charset, resolving common aliases and
+// misspellings such as "UTF_8" or "windows1252".  Labels already supported as-is, and labels that
+// are not recognized, are returned unaltered.
+func NormalizeCharset(charset string) string {
+	if _, ok := encodings[strings.ToLower(charset)]; ok {
+		return charset
+	}
+	if label, ok := findCharset(charset); ok {
+		return encodings[label].name
+	}
+	return charset
+}
+
+// RegisterCharsetReader registers a factory for readers converting the named charset into UTF-8.
+// Registered factories are consulted before the built-in charset table.  The charset label is
+// matched without regard to case, and aliases of charsets in the built-in table are treated as
+// equivalent.  A nil fn removes the registration.
+func RegisterCharsetReader(charset string, fn func(io.Reader) io.Reader) {
+	charsetReadersMu.Lock()
+	defer charsetReadersMu.Unlock()
+	if fn == nil {
+		delete(charsetReaders, charsetKey(charset))
+		return
+	}
+	charsetReaders[charsetKey(charset)] = fn
+}
+
+// registeredCharsetReader returns the reader factory registered for charset, or nil.
+func registeredCharsetReader(charset string) func(io.Reader) io.Reader {
+	charsetReadersMu.RLock()
+	defer charsetReadersMu.RUnlock()
+	if len(charsetReaders) == 0 {
+		return nil
+	}
+	return charsetReaders[charsetKey(charset)]
+}
+
+// charsetKey normalizes a charset label, resolving aliases known to the built-in table to their
+// canonical name.
+func charsetKey(charset string) string {
+	if label, ok := findCharset(charset); ok {
+		return encodings[label].name
+	}
+	return strings.ToLower(strings.Trim(charset, " \t\"'"))
 }
 
 // ConvertToUTF8String uses the provided charset to decode a slice of bytes into a normal
 // UTF-8 string.
 func ConvertToUTF8String(charset string, textBytes []byte) (string, error) {
-	if strings.ToLower(charset) == utf8 {
-		return string(textBytes), nil
+	if fn := registeredCharsetReader(charset); fn != nil {
+		output, err := ioutil.ReadAll(fn(bytes.NewReader(textBytes)))
+		if err != nil {
+			return "", err
+		}
+		return string(output), nil
 	}
-	csentry, ok := encodings[strings.ToLower(charset)]
+	label, ok := findCharset(charset)
 	if !ok {
 		return "", fmt.Errorf("Unsupported charset %q", charset)
 	}
+	csentry := encodings[label]
+	if csentry.name == utf8 {
+		return string(textBytes), nil
+	}
 	input := bytes.NewReader(textBytes)
 	reader := transform.NewReader(input, csentry.e.NewDecoder())
 	output, err := ioutil.ReadAll(reader)
@@ -286,21 +415,49 @@ func ConvertToUTF8String(charset string, textBytes []byte) (string, error) {
 	return string(output), nil
 }
 
+// ConvertFromUTF8 uses the provided charset to encode a slice of UTF-8 bytes, the inverse of
+// ConvertToUTF8String.  Returns an error if the charset is not supported, or cannot represent the
+// input.
+func ConvertFromUTF8(charset string, textBytes []byte) ([]byte, error) {
+	label, ok := findCharset(charset)
+	if !ok {
+		return nil, fmt.Errorf("Unsupported charset %q", charset)
+	}
+	csentry := encodings[label]
+	if csentry.name == utf8 {
+		return textBytes, nil
+	}
+	output, _, err := transform.Bytes(csentry.e.NewEncoder(), textBytes)
+	if err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
 // NewCharsetReader generates charset-conversion readers, converting from the provided charset into
 // UTF-8.  CharsetReader is a factory signature defined by Go's mime.WordDecoder.
 //
 // This function is similar to: https://godoc.org/golang.org/x/net/html/charset#NewReaderLabel
 func NewCharsetReader(charset string, input io.Reader) (io.Reader, error) {
-	if strings.ToLower(charset) == utf8 {
-		return input, nil
+	if fn := registeredCharsetReader(charset); fn != nil {
+		return fn(input), nil
 	}
-	csentry, ok := encodings[strings.ToLower(charset)]
+	label, ok := findCharset(charset)
 	if !ok {
 		return nil, fmt.Errorf("Unsupported charset %q", charset)
 	}
+	csentry := encodings[label]
+	if csentry.name == utf8 {
+		return input, nil
+	}
 	return transform.NewReader(input, csentry.e.NewDecoder()), nil
 }
 
+// NewUTF8Reader returns a reader of input with invalid UTF-8 sequences replaced by U+FFFD.
+func NewUTF8Reader(input io.Reader) io.Reader {
+	return transform.NewReader(input, unicode.UTF8.NewDecoder())
+}
+
 // FindCharsetInHTML looks for charset in the HTML meta tag (v4.01 and v5).
 func FindCharsetInHTML(html string) string {
 	charsetMatches := metaTagCharsetRegexp.FindAllStringSubmatch(html, -1)
@@ -2,6 +2,7 @@ package coding_test
 
 import (
 	"bytes"
+	"io"
 	"io/ioutil"
 	"strings"
 	"testing"
@@ -50,6 +51,147 @@ func TestCharsetReader(t *testing.T) {
 	}
 }
 
+// Test normalization of charset aliases and misspellings found in real messages
+func TestNormalizeCharset(t *testing.T) {
+	var testTable = []struct {
+		charset string
+		want    string
+	}{
+		// Supported labels are unaltered
+		{"utf-8", "utf-8"},
+		{"UTF-8", "UTF-8"},
+		{"cp1252", "cp1252"},
+		{"ANSI_X3.4-1968", "ANSI_X3.4-1968"},
+		{"latin1", "latin1"},
+		// Aliases differing in case and punctuation
+		{"UTF_8", "utf-8"},
+		{"Utf 8", "utf-8"},
+		{"windows1252", "windows-1252"},
+		{"windows_1251", "windows-1251"},
+		{"latin-1", "windows-1252"},
+		{"us_ascii", "windows-1252"},
+		{"ISO 8859-15", "iso-8859-15"},
+		{"iso_8859_2", "iso-8859-2"},
+		{"euc_kr", "euc-kr"},
+		{"big-5", "big5"},
+		{"koi8r", "koi8-r"},
+		{"Shift JIS", "shift_jis"},
+		{"US\nASCII", "US\nASCII"},
+		{" \"UTF_8\" ", "utf-8"},
+		// Misspellings
+		{"win-1252", "windows-1252"},
+		{"WIN1250", "windows-1250"},
+		{"utf8mb4", "utf-8"},
+		{"ansi", "windows-1252"},
+		// Unknown labels are unaltered
+		{"x-unknown", "x-unknown"},
+		{"", ""},
+	}
+
+	for _, tt := range testTable {
+		got := coding.NormalizeCharset(tt.charset)
+		if got != tt.want {
+			t.Errorf("NormalizeCharset(%q) = %q, want: %q", tt.charset, got, tt.want)
+		}
+		if tt.want == tt.charset {
+			continue
+		}
+		// Aliases must also be usable directly
+		reader, err := coding.NewCharsetReader(tt.charset, strings.NewReader("abc"))
+		if err != nil {
+			t.Errorf("NewCharsetReader(%q) returned error: %v", tt.charset, err)
+			continue
+		}
+		if b, _ := ioutil.ReadAll(reader); string(b) != "abc" {
+			t.Errorf("NewCharsetReader(%q) read %q, want: %q", tt.charset, b, "abc")
+		}
+	}
+}
+
+// Test conversion from UTF-8 into different character sets
+func TestConvertFromUTF8(t *testing.T) {
+	var testTable = []struct {
+		charset string
+		input   string
+		want    []byte
+	}{
+		{"utf-8", "abcABC\u2014", []byte("abcABC\u2014")},
+		{"windows-1250", "aZ\u2013", []byte{'a', 'Z', 0x96}},
+		{"ISO-8859-1", "Caf\u00e9", []byte{'C', 'a', 'f', 0xe9}},
+		{"big5", "\uff08\uff5b\u3008", []byte{0xa1, 0x5d, 0xa1, 0x61, 0xa1, 0x71}},
+		{"shift_jis", "\u65e5\u672c", []byte{0x93, 0xfa, 0x96, 0x7b}},
+	}
+
+	for _, tt := range testTable {
+		got, err := coding.ConvertFromUTF8(tt.charset, []byte(tt.input))
+		if err != nil {
+			t.Errorf("ConvertFromUTF8(%q, %q) returned error: %v", tt.charset, tt.input, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("ConvertFromUTF8(%q, %q) = %q, want: %q", tt.charset, tt.input, got, tt.want)
+		}
+	}
+}
+
+// Test conversion errors from UTF-8
+func TestConvertFromUTF8Errors(t *testing.T) {
+	if _, err := coding.ConvertFromUTF8("INVALIDcharsetZZZ", []byte("unused")); err == nil {
+		t.Error("Unsupported charset should return an error")
+	}
+	if _, err := coding.ConvertFromUTF8("iso-8859-1", []byte("\u65e5")); err == nil {
+		t.Error("Unrepresentable character should return an error")
+	}
+}
+
+// upperReader is a charset reader factory used to test RegisterCharsetReader
+func upperReader(r io.Reader) io.Reader {
+	b, _ := ioutil.ReadAll(r)
+	return bytes.NewReader(bytes.ToUpper(b))
+}
+
+// Test registered charset readers take precedence, and are matched by alias
+func TestRegisterCharsetReader(t *testing.T) {
+	coding.RegisterCharsetReader("X-Test-Upper", upperReader)
+	coding.RegisterCharsetReader("koi8", upperReader)
+	defer coding.RegisterCharsetReader("X-Test-Upper", nil)
+	defer coding.RegisterCharsetReader("koi8", nil)
+
+	for _, charset := range []string{"x-test-upper", "X-TEST-UPPER", "koi8-r", "csKOI8R"} {
+		t.Run(charset, func(t *testing.T) {
+			r, err := coding.NewCharsetReader(charset, strings.NewReader("abc"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != "ABC" {
+				t.Errorf("NewCharsetReader got: %q, want: %q", got, "ABC")
+			}
+
+			s, err := coding.ConvertToUTF8String(charset, []byte("abc"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s != "ABC" {
+				t.Errorf("ConvertToUTF8String got: %q, want: %q", s, "ABC")
+			}
+		})
+	}
+
+	// Removing the registration restores the built-in charset, and unknown charsets stay unknown
+	coding.RegisterCharsetReader("koi8", nil)
+	if s, err := coding.ConvertToUTF8String("koi8-r", []byte("abc")); err != nil || s != "abc" {
+		t.Errorf("ConvertToUTF8String got: %q, %v, want: %q", s, err, "abc")
+	}
+	coding.RegisterCharsetReader("X-Test-Upper", nil)
+	if _, err := coding.NewCharsetReader("x-test-upper", strings.NewReader("abc")); err == nil {
+		t.Error("Unregistered charset should return an error")
+	}
+}
+
 // Search for character set info inside of HTML
 func TestFindCharsetInHTML(t *testing.T) {
 	var ttable = []struct {
@@ -0,0 +1,154 @@
+package coding
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// gzipMagic is the ID1 and ID2 bytes that begin a gzip stream, RFC 1952.
+const gzipMagic = "\x1f\x8b"
+
+// Decompressor decompresses content compressed by one of the HTTP Content-Encoding codings,
+// "gzip", "x-gzip" or "deflate".  Content that does not begin with a valid header for the coding is
+// passed through unaltered.  Decompression is best-effort; when it fails Read returns io.EOF and
+// the problem is reported in Err.  Errors from the underlying reader are returned as-is.
+type Decompressor struct {
+	// Err reports why decompression failed, or is nil.
+	Err error
+	// MaxSize limits the number of decompressed bytes returned, protecting against compression
+	// bombs.  Output beyond the limit is discarded and reported in Err.  Zero disables the limit.
+	MaxSize int64
+
+	coding string
+	src    *errorRecorder
+	r      io.Reader
+	n      int64 // Decompressed bytes returned
+}
+
+// Assert Decompressor implements io.Reader.
+var _ io.Reader = &Decompressor{}
+
+// NewDecompressor returns a Decompressor for the specified reader and Content-Encoding coding.
+func NewDecompressor(r io.Reader, coding string) *Decompressor {
+	return &Decompressor{
+		coding: strings.ToLower(coding),
+		src:    &errorRecorder{r: r},
+	}
+}
+
+// IsCompression returns true if coding is a Content-Encoding coding supported by Decompressor.
+func IsCompression(coding string) bool {
+	switch strings.ToLower(coding) {
+	case "gzip", "x-gzip", "deflate":
+		return true
+	}
+	return false
+}
+
+// Read method for io.Reader interface.
+func (d *Decompressor) Read(p []byte) (int, error) {
+	if d.r == nil {
+		if err := d.init(); err != nil {
+			return 0, err
+		}
+	}
+	var probe [1]byte
+	exhausted := false
+	if d.MaxSize > 0 && int64(len(p)) > d.MaxSize-d.n {
+		if d.n >= d.MaxSize {
+			// Check for output beyond the limit
+			p = probe[:]
+			exhausted = true
+		} else {
+			p = p[:d.MaxSize-d.n]
+		}
+	}
+	n, err := d.r.Read(p)
+	if exhausted && n > 0 {
+		d.Err = fmt.Errorf("decompressed content exceeds %v bytes, truncated", d.MaxSize)
+		d.r = eofReader{}
+		return 0, io.EOF
+	}
+	d.n += int64(n)
+	if err != nil && err != io.EOF && err != d.src.err {
+		// Decompression failed, stop here
+		d.Err = err
+		d.r = eofReader{}
+		err = io.EOF
+	}
+	return n, err
+}
+
+// init examines the header of the compressed content to select a decompressing reader.
+func (d *Decompressor) init() error {
+	br := bufio.NewReader(d.src)
+	header, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	switch d.coding {
+	case "gzip", "x-gzip":
+		if string(header) != gzipMagic {
+			d.Err = fmt.Errorf("content is not %v compressed", d.coding)
+			d.r = br
+			return nil
+		}
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			if err == d.src.err {
+				return err
+			}
+			d.Err = err
+			d.r = eofReader{}
+			return nil
+		}
+		d.r = zr
+	case "deflate":
+		// Usually zlib wrapped, as the HTTP specification requires, but raw deflate is common
+		if len(header) == 2 && header[0]&0x0f == 8 && (int(header[0])<<8|int(header[1]))%31 == 0 {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				if err == d.src.err {
+					return err
+				}
+				d.Err = err
+				d.r = eofReader{}
+				return nil
+			}
+			d.r = zr
+		} else {
+			d.r = flate.NewReader(br)
+		}
+	default:
+		return errors.New("unsupported content coding: " + d.coding)
+	}
+	return nil
+}
+
+// errorRecorder remembers the last error returned by r, allowing it to be told apart from errors
+// generated by readers layered on top of it.
+type errorRecorder struct {
+	r   io.Reader
+	err error
+}
+
+func (e *errorRecorder) Read(p []byte) (int, error) {
+	n, err := e.r.Read(p)
+	if err != nil && err != io.EOF {
+		e.err = err
+	}
+	return n, err
+}
+
+// eofReader is always at EOF.
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) {
+	return 0, io.EOF
+}
@@ -0,0 +1,116 @@
+package coding_test
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/jhillyerd/enmime/internal/coding"
+)
+
+func TestDecompressor(t *testing.T) {
+	compress := func(w io.WriteCloser, buf *bytes.Buffer) []byte {
+		_, _ = w.Write([]byte("Hello, World!"))
+		_ = w.Close()
+		return buf.Bytes()
+	}
+	gzbuf := &bytes.Buffer{}
+	gz := compress(gzip.NewWriter(gzbuf), gzbuf)
+	zbuf := &bytes.Buffer{}
+	z := compress(zlib.NewWriter(zbuf), zbuf)
+	fbuf := &bytes.Buffer{}
+	fw, _ := flate.NewWriter(fbuf, flate.DefaultCompression)
+	f := compress(fw, fbuf)
+
+	ttable := []struct {
+		name    string
+		coding  string
+		input   []byte
+		want    string
+		wantErr bool
+	}{
+		{name: "gzip", coding: "gzip", input: gz, want: "Hello, World!"},
+		{name: "x-gzip", coding: "X-GZIP", input: gz, want: "Hello, World!"},
+		{name: "zlib", coding: "deflate", input: z, want: "Hello, World!"},
+		{name: "raw deflate", coding: "deflate", input: f, want: "Hello, World!"},
+		{name: "not gzip", coding: "gzip", input: []byte("Hello"), want: "Hello", wantErr: true},
+		{name: "truncated", coding: "gzip", input: gz[:len(gz)-10], wantErr: true},
+		{name: "bad checksum", coding: "gzip", input: append(gz[:len(gz)-8:len(gz)-8],
+			0, 0, 0, 0, 13, 0, 0, 0), want: "Hello, World!", wantErr: true},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			d := coding.NewDecompressor(bytes.NewReader(tt.input), tt.coding)
+			got, err := ioutil.ReadAll(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want != "" && string(got) != tt.want {
+				t.Errorf("got: %q, want: %q", got, tt.want)
+			}
+			if (d.Err != nil) != tt.wantErr {
+				t.Errorf("Err got: %v, want error: %v", d.Err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDecompressorSourceError(t *testing.T) {
+	want := errors.New("source failed")
+	r := io.MultiReader(bytes.NewReader([]byte{0x1f, 0x8b}), &errReader{err: want})
+	d := coding.NewDecompressor(r, "gzip")
+	_, err := ioutil.ReadAll(d)
+	if err != want {
+		t.Errorf("Read() error got: %v, want: %v", err, want)
+	}
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
+
+func TestDecompressorMaxSize(t *testing.T) {
+	// 1 MiB of zeros compresses to around 1 KiB
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, _ = gz.Write(make([]byte, 1<<20))
+	_ = gz.Close()
+
+	ttable := []struct {
+		name    string
+		maxSize int64
+		wantLen int
+		wantErr bool
+	}{
+		{name: "unlimited", maxSize: 0, wantLen: 1 << 20},
+		{name: "exact", maxSize: 1 << 20, wantLen: 1 << 20},
+		{name: "exceeded", maxSize: 1000, wantLen: 1000, wantErr: true},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			d := coding.NewDecompressor(bytes.NewReader(buf.Bytes()), "gzip")
+			d.MaxSize = tt.maxSize
+			got, err := ioutil.ReadAll(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != tt.wantLen {
+				t.Errorf("got %v bytes, want: %v", len(got), tt.wantLen)
+			}
+			if (d.Err != nil) != tt.wantErr {
+				t.Errorf("Err got: %v, want error: %v", d.Err, tt.wantErr)
+			}
+		})
+	}
+}
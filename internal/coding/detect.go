@@ -0,0 +1,48 @@
+package coding
+
+import (
+	"bytes"
+	stdutf8 "unicode/utf8"
+)
+
+// DetectCharset guesses the character set of a sample of text, returning an empty string if the
+// sample is plain ASCII and requires no conversion.  The sample may be truncated mid-character.
+//
+// Detection is limited to byte order marks, ISO-2022-JP escape sequences and UTF-8 validity; text
+// that is none of these is assumed to be windows-1252, the most common legacy charset in email.
+func DetectCharset(sample []byte) string {
+	switch {
+	case bytes.HasPrefix(sample, []byte{0xef, 0xbb, 0xbf}):
+		return utf8
+	case bytes.HasPrefix(sample, []byte{0xff, 0xfe}):
+		return "utf-16le"
+	case bytes.HasPrefix(sample, []byte{0xfe, 0xff}):
+		return "utf-16be"
+	}
+	ascii := true
+	for _, b := range sample {
+		if b >= stdutf8.RuneSelf {
+			ascii = false
+			break
+		}
+	}
+	if ascii {
+		if bytes.Contains(sample, []byte("\x1b$B")) || bytes.Contains(sample, []byte("\x1b$@")) {
+			return "iso-2022-jp"
+		}
+		return ""
+	}
+	// Drop a trailing partial character before validating.
+	for i := 1; i < stdutf8.UTFMax && i <= len(sample); i++ {
+		if stdutf8.RuneStart(sample[len(sample)-i]) {
+			if !stdutf8.FullRune(sample[len(sample)-i:]) {
+				sample = sample[:len(sample)-i]
+			}
+			break
+		}
+	}
+	if stdutf8.Valid(sample) {
+		return utf8
+	}
+	return "windows-1252"
+}
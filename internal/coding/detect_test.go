@@ -0,0 +1,33 @@
+package coding_test
+
+import (
+	"testing"
+
+	"github.com/jhillyerd/enmime/internal/coding"
+)
+
+func TestDetectCharset(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input []byte
+		want  string
+	}{
+		{"empty", []byte{}, ""},
+		{"ascii", []byte("plain text\r\n"), ""},
+		{"utf-8", []byte("Mirosław"), "utf-8"},
+		{"utf-8 truncated", []byte("Mirosław ł")[:11], "utf-8"},
+		{"utf-8 bom", []byte("\xef\xbb\xbfabc"), "utf-8"},
+		{"utf-16le bom", []byte("\xff\xfea\x00"), "utf-16le"},
+		{"utf-16be bom", []byte("\xfe\xff\x00a"), "utf-16be"},
+		{"iso-2022-jp", []byte("\x1b$B$3$s\x1b(B"), "iso-2022-jp"},
+		{"windows-1252", []byte("caf\xe9 \x93quoted\x94"), "windows-1252"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := coding.DetectCharset(tc.input)
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
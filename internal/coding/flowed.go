@@ -0,0 +1,100 @@
+package coding
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// FlowedReader decodes text/plain content sent with format=flowed (RFC 3676).  Soft line breaks
+// are joined into a single line, space-stuffing is removed, and quote depth is preserved by
+// prefixing each unwrapped line with its quote marks.
+type FlowedReader struct {
+	in    *bufio.Reader
+	delSp bool         // Delete the trailing space of flowed lines, from delsp=yes
+	out   bytes.Buffer // Decoded content waiting to be read
+	para  []byte       // Current paragraph, built from flowed lines
+	depth int          // Quote depth of current paragraph
+	open  bool         // True while para holds flowed lines awaiting continuation
+	eol   []byte       // Line ending of the most recent line in para
+	err   error
+}
+
+// Assert FlowedReader implements io.Reader.
+var _ io.Reader = &FlowedReader{}
+
+// NewFlowedReader returns a FlowedReader for the specified reader.  delSp should be true when the
+// Content-Type header included the delsp=yes parameter.
+func NewFlowedReader(r io.Reader, delSp bool) *FlowedReader {
+	return &FlowedReader{
+		in:    bufio.NewReader(r),
+		delSp: delSp,
+	}
+}
+
+// Read method for io.Reader interface.
+func (fr *FlowedReader) Read(p []byte) (n int, err error) {
+	for fr.out.Len() < len(p) && fr.err == nil {
+		fr.err = fr.readLine()
+	}
+	n, _ = fr.out.Read(p)
+	if fr.out.Len() == 0 {
+		return n, fr.err
+	}
+	return n, nil
+}
+
+// readLine consumes a single physical line from the input, flushing completed paragraphs to
+// fr.out.
+func (fr *FlowedReader) readLine() error {
+	line, err := fr.in.ReadBytes('\n')
+	if len(line) == 0 {
+		if fr.open {
+			fr.flush()
+		}
+		return err
+	}
+	// Split off the line ending.
+	text := bytes.TrimRight(line, "\r\n")
+	eol := line[len(text):]
+	// Determine quote depth, then remove space-stuffing.
+	depth := 0
+	for depth < len(text) && text[depth] == '>' {
+		depth++
+	}
+	text = text[depth:]
+	if len(text) > 0 && text[0] == ' ' {
+		text = text[1:]
+	}
+	if fr.open && depth != fr.depth {
+		// Quote depth changed mid-paragraph, the previous line was improperly flowed.
+		fr.flush()
+	}
+	flowed := len(text) > 0 && text[len(text)-1] == ' ' && !bytes.Equal(text, []byte("-- "))
+	if flowed && fr.delSp {
+		text = text[:len(text)-1]
+	}
+	fr.para = append(fr.para, text...)
+	fr.depth = depth
+	fr.eol = eol
+	fr.open = true
+	if !flowed || err != nil {
+		fr.flush()
+	}
+	return err
+}
+
+// flush writes the current paragraph to the output buffer, prefixed with its quote marks.
+func (fr *FlowedReader) flush() {
+	if fr.depth > 0 {
+		fr.out.Write(bytes.Repeat([]byte{'>'}, fr.depth))
+		if len(fr.para) > 0 {
+			fr.out.WriteByte(' ')
+		}
+	}
+	fr.out.Write(fr.para)
+	fr.out.Write(fr.eol)
+	fr.para = fr.para[:0]
+	fr.eol = nil
+	fr.open = false
+}
@@ -0,0 +1,66 @@
+package coding_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jhillyerd/enmime/internal/coding"
+)
+
+func TestFlowedReader(t *testing.T) {
+	ttable := []struct {
+		name  string
+		input string
+		delSp bool
+		want  string
+	}{
+		{"empty", "", false, ""},
+		{"fixed", "one\r\ntwo\r\n", false, "one\r\ntwo\r\n"},
+		{"flowed", "one \r\ntwo \r\nthree\r\n", false, "one two three\r\n"},
+		{"delsp", "oneé \r\ntwo\r\n", true, "oneétwo\r\n"},
+		{"stuffed", " From me\r\n", false, "From me\r\n"},
+		{"quoted", "> one \r\n> two\r\n", false, "> one two\r\n"},
+		{"nested quote", ">> one \r\n>>two\r\n>\r\n", false, ">> one two\r\n>\r\n"},
+		{"depth change", "> one \r\ntwo\r\n", false, "> one \r\ntwo\r\n"},
+		{"signature", "-- \r\nme\r\n", false, "-- \r\nme\r\n"},
+		{"no final eol", "one \r\ntwo", false, "one two"},
+		{"flowed at eof", "one \r\n", false, "one \r\n"},
+		{"bare lf", "one \ntwo\n", false, "one two\n"},
+	}
+
+	for _, tc := range ttable {
+		t.Run(tc.name, func(t *testing.T) {
+			r := coding.NewFlowedReader(strings.NewReader(tc.input), tc.delSp)
+			buf := new(bytes.Buffer)
+			_, err := buf.ReadFrom(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := buf.String()
+			if got != tc.want {
+				t.Errorf("Got: %q, want: %q", got, tc.want)
+			}
+		})
+	}
+}
+
+// TestFlowedReaderSmallReads ensures content is not lost when the caller reads in small chunks.
+func TestFlowedReaderSmallReads(t *testing.T) {
+	input := strings.Repeat("flowed \r\nfixed\r\n", 100)
+	want := strings.Repeat("flowed fixed\r\n", 100)
+	r := coding.NewFlowedReader(strings.NewReader(input), false)
+	buf := new(bytes.Buffer)
+	p := make([]byte, 3)
+	for {
+		n, err := r.Read(p)
+		buf.Write(p[:n])
+		if err != nil {
+			break
+		}
+	}
+	got := buf.String()
+	if got != want {
+		t.Errorf("Got: %q, want: %q", got, want)
+	}
+}
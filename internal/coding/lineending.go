@@ -0,0 +1,100 @@
+package coding
+
+import (
+	"io"
+)
+
+// LFReader converts CRLF and lone CR line endings into LF.
+type LFReader struct {
+	r  io.Reader
+	cr bool // The previous byte read was CR, an LF following it must be dropped
+}
+
+// Assert LFReader implements io.Reader.
+var _ io.Reader = &LFReader{}
+
+// NewLFReader returns an LFReader for the specified reader.
+func NewLFReader(r io.Reader) *LFReader {
+	return &LFReader{r: r}
+}
+
+// Read method for io.Reader interface.
+func (lr *LFReader) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// Read again if every byte read was dropped, returning 0, nil is discouraged
+	for n == 0 && err == nil {
+		var m int
+		m, err = lr.r.Read(p)
+		// Convert in place, the output is never longer than the input
+		for _, b := range p[:m] {
+			switch {
+			case b == '\r':
+				p[n] = '\n'
+				n++
+				lr.cr = true
+			case b == '\n' && lr.cr:
+				lr.cr = false
+			default:
+				p[n] = b
+				n++
+				lr.cr = false
+			}
+		}
+	}
+	return n, err
+}
+
+// LFWriter converts CRLF line endings written to it into LF, other CR bytes are passed through.
+// Flush must be called after the final Write, to pass on a trailing CR.
+type LFWriter struct {
+	w  io.Writer
+	cr bool // The last byte written was CR, held back until the next byte is known
+}
+
+// Assert LFWriter implements io.Writer.
+var _ io.Writer = &LFWriter{}
+
+// NewLFWriter returns an LFWriter for the specified writer.
+func NewLFWriter(w io.Writer) *LFWriter {
+	return &LFWriter{w: w}
+}
+
+// Write method for io.Writer interface.
+func (lw *LFWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	out := make([]byte, 0, len(p)+1)
+	if lw.cr && p[0] != '\n' {
+		out = append(out, '\r')
+	}
+	lw.cr = false
+	for i, b := range p {
+		if b == '\r' {
+			if i == len(p)-1 {
+				lw.cr = true
+				continue
+			}
+			if p[i+1] == '\n' {
+				continue
+			}
+		}
+		out = append(out, b)
+	}
+	if _, err := lw.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Flush writes a CR held back by the final Write.
+func (lw *LFWriter) Flush() error {
+	if !lw.cr {
+		return nil
+	}
+	lw.cr = false
+	_, err := lw.w.Write([]byte{'\r'})
+	return err
+}
@@ -0,0 +1,96 @@
+package coding_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/jhillyerd/enmime/internal/coding"
+)
+
+func TestLFReader(t *testing.T) {
+	ttable := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"empty", "", ""},
+		{"lf", "one\ntwo\n", "one\ntwo\n"},
+		{"crlf", "one\r\ntwo\r\n", "one\ntwo\n"},
+		{"cr", "one\rtwo\r", "one\ntwo\n"},
+		{"mixed", "one\r\ntwo\rthree\nfour", "one\ntwo\nthree\nfour"},
+		{"blank lines", "one\r\n\r\n\r\rtwo", "one\n\n\n\ntwo"},
+		{"lfcr", "one\n\rtwo", "one\n\ntwo"},
+		{"only crlf", "\r\n", "\n"},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ioutil.ReadAll(coding.NewLFReader(strings.NewReader(tt.input)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got: %q, want: %q", got, tt.want)
+			}
+
+			// CRLF split across reads
+			got, err = ioutil.ReadAll(
+				coding.NewLFReader(iotest.OneByteReader(strings.NewReader(tt.input))))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("one byte reads got: %q, want: %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLFWriter(t *testing.T) {
+	ttable := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"empty", "", ""},
+		{"lf", "one\ntwo\n", "one\ntwo\n"},
+		{"crlf", "one\r\ntwo\r\n", "one\ntwo\n"},
+		{"cr", "one\rtwo\r", "one\rtwo\r"},
+		{"mixed", "one\r\ntwo\rthree\nfour", "one\ntwo\rthree\nfour"},
+		{"blank lines", "one\r\n\r\n\r\rtwo", "one\n\n\r\rtwo"},
+		{"crcrlf", "one\r\r\ntwo", "one\r\ntwo"},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &bytes.Buffer{}
+			w := coding.NewLFWriter(b)
+			if _, err := w.Write([]byte(tt.input)); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("got: %q, want: %q", got, tt.want)
+			}
+
+			// CRLF split across writes
+			b.Reset()
+			for i := 0; i < len(tt.input); i++ {
+				if _, err := w.Write([]byte{tt.input[i]}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("one byte writes got: %q, want: %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,13 +2,22 @@ package coding
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 )
 
+// maxQPPeek is the number of bytes examined following an equals sign, enough to cover the
+// whitespace permitted before a soft line break on a line of maximum length.
+const maxQPPeek = 80
+
 // QPCleaner scans quoted printable content for invalid characters and encodes them so that
 // Go's quoted-printable decoder does not abort with an error.
 type QPCleaner struct {
+	// Count of equals signs not followed by two hex digits or a line break, which are passed
+	// through as literal text.
+	InvalidEscapes int
+
 	in *bufio.Reader
 }
 
@@ -34,15 +43,16 @@ func (qp *QPCleaner) Read(dest []byte) (n int, err error) {
 		}
 		switch {
 		case b == '=':
-			// Pass valid hex bytes through.
-			hexBytes, err := qp.in.Peek(2)
-			if err != nil && err != io.EOF {
+			// Pass valid hex bytes and soft line breaks through.
+			hexBytes, err := qp.in.Peek(maxQPPeek)
+			if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
 				return 0, err
 			}
 			if validHexBytes(hexBytes) {
 				dest[n] = b
 				n++
 			} else {
+				qp.InvalidEscapes++
 				s := fmt.Sprintf("=%02X", b)
 				n += copy(dest[n:], s)
 			}
@@ -68,6 +78,11 @@ func validHexByte(b byte) bool {
 }
 
 func validHexBytes(v []byte) bool {
+	if len(v) > 0 && (v[0] == ' ' || v[0] == '\t') {
+		// Transport padding is permitted before a soft line break, RFC 2045 section 6.7.
+		v = bytes.TrimLeft(v, " \t")
+		return len(v) > 0 && (v[0] == '\n' || len(v) > 1 && v[0] == '\r' && v[1] == '\n')
+	}
 	if len(v) < 1 {
 		return false
 	}
@@ -84,3 +99,35 @@ func validHexBytes(v []byte) bool {
 	}
 	return validHexByte(v[0]) && validHexByte(v[1])
 }
+
+// qpDensity is the greatest number of content bytes per quoted-printable escape sequence or soft
+// line break that LooksLikeQuotedPrintable accepts.
+const qpDensity = 100
+
+// LooksLikeQuotedPrintable returns true if b appears to be quoted-printable encoded: every equals
+// sign begins an escape sequence such as "=3D" or a soft line break, at least one soft line break
+// is present, and these sequences are dense enough that b is unlikely to be plain text that
+// happens to contain them.
+func LooksLikeQuotedPrintable(b []byte) bool {
+	sequences, softBreaks := 0, 0
+	for i := 0; i < len(b); i++ {
+		if b[i] != '=' {
+			continue
+		}
+		rest := b[i+1:]
+		switch {
+		case len(rest) >= 1 && rest[0] == '\n':
+			softBreaks++
+		case len(rest) >= 2 && rest[0] == '\r' && rest[1] == '\n':
+			softBreaks++
+			i++
+		case len(rest) >= 2 && validHexByte(rest[0]) && validHexByte(rest[1]):
+			i += 2
+		default:
+			// Plain text, such as "a = b" or "x==y"
+			return false
+		}
+		sequences++
+	}
+	return softBreaks > 0 && sequences*qpDensity >= len(b)
+}
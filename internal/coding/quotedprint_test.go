@@ -24,6 +24,11 @@ func TestQPCleaner(t *testing.T) {
 		{"Stuffs’s", "Stuffs=E2=80=99s"},
 		{"=", "=3D"},
 		{"=a", "=3Da"},
+		{"a=\r\nb", "a=\r\nb"},
+		{"a= \t\r\nb", "a= \t\r\nb"},
+		{"a= b", "a=3D b"},
+		{"=XY", "=3DXY"},
+		{"=4", "=3D4"},
 	}
 
 	for _, tc := range ttable {
@@ -42,6 +47,34 @@ func TestQPCleaner(t *testing.T) {
 	}
 }
 
+// TestQPCleanerInvalidEscapes checks the count of invalid escape sequences passed through
+func TestQPCleanerInvalidEscapes(t *testing.T) {
+	ttable := []struct {
+		input string
+		want  int
+	}{
+		{"", 0},
+		{"=5bSlack=5d=\r\n", 0},
+		{"line one=  \r\nline two=\n", 0},
+		{"pédagogues", 0},
+		{"=", 1},
+		{"cost = 5", 1},
+		{"=XY and =4G", 2},
+		{"ref=od_aui?ie=UTF8", 2},
+	}
+
+	for _, tc := range ttable {
+		cleaner := coding.NewQPCleaner(strings.NewReader(tc.input))
+		if _, err := new(bytes.Buffer).ReadFrom(cleaner); err != nil {
+			t.Fatal(err)
+		}
+		if cleaner.InvalidEscapes != tc.want {
+			t.Errorf("InvalidEscapes for %q got: %v, want: %v", tc.input, cleaner.InvalidEscapes,
+				tc.want)
+		}
+	}
+}
+
 // TestQPCleanerOverflow attempts to confuse the cleaner by issuing a smaller subsequent read
 func TestQPCleanerOverflow(t *testing.T) {
 	input := bytes.Repeat([]byte("pédagogues =\r\n"), 1000)
@@ -109,3 +142,32 @@ func BenchmarkQPCleaner(b *testing.B) {
 		}
 	}
 }
+
+func TestLooksLikeQuotedPrintable(t *testing.T) {
+	testCases := []struct {
+		input string
+		want  bool
+	}{
+		{"", false},
+		{"hello world\r\n", false},
+		{"caf=C3=A9 cr=C3=A8me=\r\nbr=C3=BBl=C3=A9e\r\n", true},
+		{"soft=\nbreak\n", true},
+		{"caf=c3=a9=\r\n", true},
+		// No soft line break
+		{"caf=C3=A9 cr=C3=A8me\r\n", false},
+		// Equals signs that are not escapes
+		{"x = 1=\r\n", false},
+		{"a==b=\r\n", false},
+		{"=XY=\r\n", false},
+		{"trailing=", false},
+		// Too sparse
+		{"A single soft line break in a long paragraph of plain text, where the only " +
+			"equals sign is the one that ends this line, which is not enough to decide=\r\n" +
+			"that the content is encoded.\r\n", false},
+	}
+	for _, tc := range testCases {
+		if got := coding.LooksLikeQuotedPrintable([]byte(tc.input)); got != tc.want {
+			t.Errorf("LooksLikeQuotedPrintable(%q) got: %v, want: %v", tc.input, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package coding
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// uuState tracks the position of the UUDecoder within the encoded data.
+type uuState int
+
+const (
+	uuBegin uuState = iota // Searching for the begin line
+	uuBody                 // Decoding body lines
+	uuDone                 // Found the end line
+)
+
+// UUDecoder decodes uuencoded content.  Lines preceding the "begin <mode> <filename>" line are
+// discarded.  Malformed data is decoded on a best-effort basis, problems are reported in Errors
+// rather than returned from Read.  Empty content is not an error.
+type UUDecoder struct {
+	// FileName and Mode, as declared by the begin line.
+	FileName string
+	Mode     string
+	// Report of problems encountered while decoding.
+	Errors []error
+
+	in    *bufio.Reader
+	out   bytes.Buffer
+	state uuState
+	err   error
+	seen  bool // Some input has been read
+}
+
+// Assert UUDecoder implements io.Reader.
+var _ io.Reader = &UUDecoder{}
+
+// NewUUDecoder returns a UUDecoder for the specified reader.
+func NewUUDecoder(r io.Reader) *UUDecoder {
+	return &UUDecoder{
+		Errors: make([]error, 0),
+		in:     bufio.NewReader(r),
+	}
+}
+
+// Read method for io.Reader interface.
+func (ud *UUDecoder) Read(p []byte) (n int, err error) {
+	for ud.out.Len() < len(p) && ud.err == nil {
+		ud.err = ud.readLine()
+	}
+	n, _ = ud.out.Read(p)
+	if ud.out.Len() == 0 {
+		return n, ud.err
+	}
+	return n, nil
+}
+
+// readLine consumes a single line of input, decoding it into ud.out.
+func (ud *UUDecoder) readLine() error {
+	line, err := ud.in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if line != "" {
+		ud.seen = true
+	}
+	line = strings.TrimRight(line, "\r\n")
+	switch ud.state {
+	case uuBegin:
+		if strings.HasPrefix(line, "begin ") {
+			fields := strings.SplitN(line, " ", 3)
+			ud.Mode = fields[1]
+			if len(fields) > 2 {
+				ud.FileName = fields[2]
+			}
+			ud.state = uuBody
+		}
+	case uuBody:
+		if strings.TrimSpace(line) == "end" {
+			ud.state = uuDone
+			break
+		}
+		ud.decodeLine(line)
+	case uuDone:
+		// Discard trailing data.
+	}
+	if err == io.EOF && ud.seen {
+		switch ud.state {
+		case uuBegin:
+			ud.Errors = append(ud.Errors, fmt.Errorf("No begin line in uuencoded data"))
+		case uuBody:
+			ud.Errors = append(ud.Errors, fmt.Errorf("No end line in uuencoded data"))
+		}
+	}
+	return err
+}
+
+// decodeLine decodes a single uuencoded body line into ud.out.
+func (ud *UUDecoder) decodeLine(line string) {
+	if line == "" {
+		// Tolerate blank lines.
+		return
+	}
+	length := int((line[0] - ' ') & 0x3f)
+	if length == 0 {
+		// Zero length line precedes the end line.
+		return
+	}
+	data := []byte(line[1:])
+	need := (length + 2) / 3 * 4
+	if len(data) < need {
+		// Some encoders strip trailing spaces, restore them.
+		if len(data) < need-2 {
+			ud.Errors = append(ud.Errors, fmt.Errorf("Short uuencoded line %q", line))
+		}
+		data = append(data, bytes.Repeat([]byte{' '}, need-len(data))...)
+	}
+	decoded := make([]byte, 0, need/4*3)
+	for i := 0; i < need; i += 4 {
+		var c [4]byte
+		for j := range c {
+			b := data[i+j]
+			if b < ' ' || '`' < b {
+				ud.Errors = append(ud.Errors, fmt.Errorf("Unexpected %q in uuencoded stream", b))
+			}
+			c[j] = (b - ' ') & 0x3f
+		}
+		decoded = append(decoded,
+			c[0]<<2|c[1]>>4,
+			c[1]<<4|c[2]>>2,
+			c[2]<<6|c[3])
+	}
+	ud.out.Write(decoded[:length])
+}
@@ -0,0 +1,110 @@
+package coding_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jhillyerd/enmime/internal/coding"
+)
+
+func TestUUDecoder(t *testing.T) {
+	ttable := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "simple",
+			input: "begin 644 hello.txt\r\n-2&5L;&\\L(%=O<FQD(0``\r\n`\r\nend\r\n",
+			want:  "Hello, World!",
+		},
+		{
+			name: "multiline",
+			input: "begin 600 fox.txt\n" +
+				"M5&AE('%U:6-K(&)R;W=N(&9O>\"!J=6UP<R!O=F5R('1H92!L87IY(&1O9RX@\n" +
+				"*,#$R,S0U-C<X.0``\n" +
+				"`\n" +
+				"end\n",
+			want: "The quick brown fox jumps over the lazy dog. 0123456789",
+		},
+		{
+			name:  "preamble",
+			input: "Some text\r\n\r\nbegin 644 hello.txt\r\n-2&5L;&\\L(%=O<FQD(0``\r\nend\r\n",
+			want:  "Hello, World!",
+		},
+		{
+			name:  "stripped spaces",
+			input: "begin 644 hello.txt\n-2&5L;&\\L(%=O<FQD(0\n \nend\n",
+			want:  "Hello, World!",
+		},
+	}
+
+	for _, tc := range ttable {
+		t.Run(tc.name, func(t *testing.T) {
+			ud := coding.NewUUDecoder(strings.NewReader(tc.input))
+			buf := new(bytes.Buffer)
+			_, err := buf.ReadFrom(ud)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range ud.Errors {
+				t.Error(e)
+			}
+			got := buf.String()
+			if got != tc.want {
+				t.Errorf("Got: %q, want: %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestUUDecoderBeginLine(t *testing.T) {
+	input := "begin 644 my file.txt\n-2&5L;&\\L(%=O<FQD(0``\nend\n"
+	ud := coding.NewUUDecoder(strings.NewReader(input))
+	if _, err := new(bytes.Buffer).ReadFrom(ud); err != nil {
+		t.Fatal(err)
+	}
+	if ud.Mode != "644" {
+		t.Errorf("Mode got: %q, want: %q", ud.Mode, "644")
+	}
+	if ud.FileName != "my file.txt" {
+		t.Errorf("FileName got: %q, want: %q", ud.FileName, "my file.txt")
+	}
+}
+
+func TestUUDecoderEmpty(t *testing.T) {
+	ud := coding.NewUUDecoder(strings.NewReader(""))
+	n, err := ud.Read(make([]byte, 10))
+	if n != 0 || err != io.EOF {
+		t.Errorf("Read() got: %v, %v, want: 0, %v", n, err, io.EOF)
+	}
+	if len(ud.Errors) != 0 {
+		t.Errorf("got %d Errors, wanted none: %v", len(ud.Errors), ud.Errors)
+	}
+}
+
+func TestUUDecoderErrors(t *testing.T) {
+	ttable := []struct {
+		name  string
+		input string
+	}{
+		{"no begin", "-2&5L;&\\L(%=O<FQD(0``\nend\n"},
+		{"no end", "begin 644 hello.txt\n-2&5L;&\\L(%=O<FQD(0``\n"},
+		{"bad char", "begin 644 hello.txt\n-2&5L;&\\L(%=O<FQDz0``\nend\n"},
+		{"short line", "begin 644 hello.txt\n-2&5L;&\\L(%=O\nend\n"},
+	}
+
+	for _, tc := range ttable {
+		t.Run(tc.name, func(t *testing.T) {
+			ud := coding.NewUUDecoder(strings.NewReader(tc.input))
+			if _, err := new(bytes.Buffer).ReadFrom(ud); err != nil {
+				t.Fatal(err)
+			}
+			if len(ud.Errors) != 1 {
+				t.Errorf("got %d Errors, wanted 1: %v", len(ud.Errors), ud.Errors)
+			}
+		})
+	}
+}
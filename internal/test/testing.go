@@ -92,6 +92,20 @@ func ComparePart(t *testing.T, got *enmime.Part, want *enmime.Part) (equal bool)
 		equal = false
 		t.Errorf("Part.FileName == %q, want: %q", got.FileName, want.FileName)
 	}
+	if got.ContentDescription != want.ContentDescription {
+		equal = false
+		t.Errorf("Part.ContentDescription == %q, want: %q", got.ContentDescription,
+			want.ContentDescription)
+	}
+	if got.ContentLocation != want.ContentLocation {
+		equal = false
+		t.Errorf("Part.ContentLocation == %q, want: %q", got.ContentLocation, want.ContentLocation)
+	}
+	if got.DetectedContentType != want.DetectedContentType {
+		equal = false
+		t.Errorf("Part.DetectedContentType == %q, want: %q", got.DetectedContentType,
+			want.DetectedContentType)
+	}
 	if got.Charset != want.Charset {
 		equal = false
 		t.Errorf("Part.Charset == %q, want: %q", got.Charset, want.Charset)
@@ -100,6 +114,10 @@ func ComparePart(t *testing.T, got *enmime.Part, want *enmime.Part) (equal bool)
 		equal = false
 		t.Errorf("Part.PartID == %q, want: %q", got.PartID, want.PartID)
 	}
+	if got.Encapsulated != want.Encapsulated {
+		equal = false
+		t.Errorf("Part.Encapsulated == %v, want: %v", got.Encapsulated, want.Encapsulated)
+	}
 
 	return
 }
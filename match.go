@@ -2,8 +2,15 @@ package enmime
 
 import (
 	"container/list"
+	"errors"
+	"path"
+	"strings"
 )
 
+// ErrStopWalk may be returned by the function passed to Walk to end the walk early.  Walk will
+// return nil in this case.
+var ErrStopWalk = errors.New("stop walk")
+
 // PartMatcher is a function type that you must implement to search for Parts using the
 // BreadthMatch* functions.  Implementators should inspect the provided Part and return true if it
 // matches your criteria.
@@ -71,7 +78,8 @@ func (p *Part) DepthMatchFirst(matcher PartMatcher) *Part {
 		if c != nil {
 			p = c
 		} else {
-			for p.NextSibling == nil {
+			// Climb until a sibling is found, without leaving the subtree rooted at root
+			for p == root || p.NextSibling == nil {
 				if p == root {
 					return nil
 				}
@@ -82,6 +90,16 @@ func (p *Part) DepthMatchFirst(matcher PartMatcher) *Part {
 	}
 }
 
+// FirstByContentType performs a depth first search of the Part tree and returns the first part
+// with the given content type, such as "text/html".  The content type is compared without regard
+// to case, and must not include parameters.  Returns nil if there is no match.  Use
+// DepthMatchFirst to search by other criteria.
+func (p *Part) FirstByContentType(contentType string) *Part {
+	return p.DepthMatchFirst(func(part *Part) bool {
+		return strings.EqualFold(part.ContentType, contentType)
+	})
+}
+
 // DepthMatchAll performs a depth first search of the Part tree and returns all parts that causes
 // the given matcher to return true
 func (p *Part) DepthMatchAll(matcher PartMatcher) []*Part {
@@ -95,7 +113,8 @@ func (p *Part) DepthMatchAll(matcher PartMatcher) []*Part {
 		if c != nil {
 			p = c
 		} else {
-			for p.NextSibling == nil {
+			// Climb until a sibling is found, without leaving the subtree rooted at root
+			for p == root || p.NextSibling == nil {
 				if p == root {
 					return matches
 				}
@@ -105,3 +124,195 @@ func (p *Part) DepthMatchAll(matcher PartMatcher) []*Part {
 		}
 	}
 }
+
+// SelectAll returns all parts of the Part tree rooted at p that cause the given matcher to return
+// true, in document order; the order of DepthMatchAll.  See MatchContentType, MatchDisposition and
+// MatchFilenameGlob for common matchers.
+func (p *Part) SelectAll(matcher PartMatcher) []*Part {
+	return p.DepthMatchAll(matcher)
+}
+
+// MatchContentType returns a PartMatcher that matches parts with the given content type, such as
+// "application/pdf".  The content type is compared without regard to case, and must not include
+// parameters.
+func MatchContentType(contentType string) PartMatcher {
+	return func(p *Part) bool {
+		return strings.EqualFold(p.ContentType, contentType)
+	}
+}
+
+// MatchDisposition returns a PartMatcher that matches parts with the given Content-Disposition,
+// such as "attachment".  The disposition is compared without regard to case.
+func MatchDisposition(disposition string) PartMatcher {
+	return func(p *Part) bool {
+		return strings.EqualFold(p.Disposition, disposition)
+	}
+}
+
+// MatchFilenameGlob returns a PartMatcher that matches parts with a FileName matching the shell
+// pattern, such as "*.pdf", using the syntax and case sensitive semantics of path.Match.  A
+// malformed pattern matches nothing.
+func MatchFilenameGlob(pattern string) PartMatcher {
+	return func(p *Part) bool {
+		if p.FileName == "" {
+			return false
+		}
+		matched, err := path.Match(pattern, p.FileName)
+		return err == nil && matched
+	}
+}
+
+// MatchMediaType reports whether the media type ct, such as the ContentType of a Part, matches
+// pattern.  A pattern is a type and subtype, either of which may be "*" to match any value; a
+// subtype of the form "*+suffix" matches subtypes with that structured syntax suffix, RFC 6839, and
+// the suffix itself.  For example "application/*+json" matches "application/vnd.api+json" and
+// "application/json", and "image/*" matches "image/svg+xml".  Parameters are ignored, and values
+// are compared without regard to case.
+func MatchMediaType(ct, pattern string) bool {
+	ctype, csub := splitMediaType(ct)
+	ptype, psub := splitMediaType(pattern)
+	if ctype == "" || csub == "" || ptype == "" {
+		return false
+	}
+	if ptype == "*" && psub == "" {
+		// A lone "*" matches all types
+		psub = "*"
+	}
+	if ptype != "*" && ptype != ctype {
+		return false
+	}
+	switch {
+	case psub == "*":
+		return true
+	case strings.HasPrefix(psub, "*+"):
+		suffix := psub[1:]
+		return csub == suffix[1:] || (len(csub) > len(suffix) && strings.HasSuffix(csub, suffix))
+	}
+	return csub == psub
+}
+
+// splitMediaType returns the lowercase type and subtype of the media type mediatype, discarding
+// any parameters.
+func splitMediaType(mediatype string) (mtype, subtype string) {
+	if i := strings.IndexByte(mediatype, ';'); i >= 0 {
+		mediatype = mediatype[:i]
+	}
+	mediatype = strings.ToLower(strings.TrimSpace(mediatype))
+	if i := strings.IndexByte(mediatype, '/'); i >= 0 {
+		return strings.TrimSpace(mediatype[:i]), strings.TrimSpace(mediatype[i+1:])
+	}
+	return mediatype, ""
+}
+
+// Walk performs a depth first, pre-order traversal of the Part tree rooted at p, calling fn for p
+// and each of its descendants.  Children are visited before siblings, and p's own siblings are not
+// visited.  If fn returns ErrStopWalk the walk ends and Walk returns nil, any other error ends the
+// walk and is returned.  Each Part is visited at most once, even if the tree contains a cycle.
+func (p *Part) Walk(fn func(*Part) error) error {
+	visited := make(map[*Part]bool)
+	stack := []*Part{p}
+	for len(stack) > 0 {
+		c := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if c == nil || visited[c] {
+			continue
+		}
+		visited[c] = true
+		if err := fn(c); err != nil {
+			if err == ErrStopWalk {
+				return nil
+			}
+			return err
+		}
+		// Push sibling before child, so that the child is popped first
+		if c != p {
+			stack = append(stack, c.NextSibling)
+		}
+		stack = append(stack, c.FirstChild)
+	}
+	return nil
+}
+
+// WalkBreadthFirst performs a breadth first traversal of the Part tree rooted at p, calling fn for
+// p and then each of its descendants level by level; all children of a Part are visited before any
+// grandchildren.  p's own siblings are not visited.  Errors, including ErrStopWalk, and cycles are
+// handled as in Walk.
+func (p *Part) WalkBreadthFirst(fn func(*Part) error) error {
+	visited := map[*Part]bool{p: true}
+	queue := []*Part{p}
+	for len(queue) > 0 {
+		c := queue[0]
+		queue = queue[1:]
+		if err := fn(c); err != nil {
+			if err == ErrStopWalk {
+				return nil
+			}
+			return err
+		}
+		// Mark children as they are queued, a cycle among siblings ends the sibling chain
+		for child := c.FirstChild; child != nil && !visited[child]; child = child.NextSibling {
+			visited[child] = true
+			queue = append(queue, child)
+		}
+	}
+	return nil
+}
+
+// CountDescendants returns the number of Parts in the tree below p, its children and their
+// descendants.  Each Part is counted once, even if the tree contains a cycle.
+func (p *Part) CountDescendants() int {
+	if p == nil {
+		return 0
+	}
+	n := 0
+	_ = p.WalkBreadthFirst(func(*Part) error {
+		n++
+		return nil
+	})
+	// Exclude p itself
+	return n - 1
+}
+
+// Depth returns the greatest nesting depth of the Part tree below p: zero if p has no children,
+// one if none of its children have children, and so on.  Cycles are handled as in
+// WalkBreadthFirst.
+func (p *Part) Depth() int {
+	if p == nil {
+		return 0
+	}
+	depth := 0
+	visited := map[*Part]bool{p: true}
+	level := []*Part{p}
+	for {
+		var next []*Part
+		for _, c := range level {
+			for child := c.FirstChild; child != nil && !visited[child]; child = child.NextSibling {
+				visited[child] = true
+				next = append(next, child)
+			}
+		}
+		if len(next) == 0 {
+			return depth
+		}
+		depth++
+		level = next
+	}
+}
+
+// Attachments calls yield for each attachment in the Part tree, in the breadth first order of
+// Envelope.Attachments, until yield returns false.  Attachments are the Parts of PartKindAttachment,
+// excluding those of encapsulated messages.  The tree is walked lazily, so this may be used to find
+// a single attachment without building a slice; with Go 1.23 or later it may be used with range:
+//
+//	for a := range part.Attachments {
+//		...
+//	}
+func (p *Part) Attachments(yield func(*Part) bool) {
+	p.BreadthMatchFirst(func(part *Part) bool {
+		if part.Kind() != PartKindAttachment || withinEncapsulated(p, part) {
+			return false
+		}
+		// Stop when yield returns false
+		return !yield(part)
+	})
+}
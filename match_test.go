@@ -1,6 +1,8 @@
 package enmime
 
 import (
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -133,6 +135,104 @@ func TestDepthMatchFirst(t *testing.T) {
 	}
 }
 
+func TestFirstByContentType(t *testing.T) {
+	// Setup test MIME tree:
+	//    root
+	//    ├── a1
+	//    │   ├── b1
+	//    │   └── b2
+	//    ├── a2
+	//    └── a3
+
+	root := &Part{ContentType: "multipart/alternative", FileName: "root"}
+	a1 := &Part{ContentType: "multipart/related", Parent: root, FileName: "a1"}
+	a2 := &Part{ContentType: "text/plain", Parent: root, FileName: "a2"}
+	a3 := &Part{ContentType: "image/png", Parent: root, FileName: "a3"}
+	b1 := &Part{ContentType: "text/plain", Parent: a1, FileName: "b1"}
+	b2 := &Part{ContentType: "text/html", Parent: a1, FileName: "b2"}
+	root.FirstChild = a1
+	a1.NextSibling = a2
+	a2.NextSibling = a3
+	a1.FirstChild = b1
+	b1.NextSibling = b2
+
+	testCases := []struct {
+		contentType string
+		want        *Part
+	}{
+		{"multipart/alternative", root},
+		{"text/plain", b1},
+		{"TEXT/HTML", b2},
+		{"image/png", a3},
+		{"image/gif", nil},
+		{"", nil},
+	}
+	for _, tc := range testCases {
+		got := root.FirstByContentType(tc.contentType)
+		if got != tc.want {
+			t.Errorf("FirstByContentType(%q) got: %v, want: %v", tc.contentType, got, tc.want)
+		}
+	}
+
+	if got := a1.FirstByContentType("image/png"); got != nil {
+		t.Error("FirstByContentType should not search siblings, got:", got.FileName)
+	}
+}
+
+func TestAttachments(t *testing.T) {
+	// Setup test MIME tree:
+	//    root
+	//    ├── a1
+	//    │   ├── b1 (attachment)
+	//    │   └── b2 (encapsulated)
+	//    │       └── c1 (attachment)
+	//    ├── a2 (attachment)
+	//    └── a3
+
+	root := &Part{ContentType: "multipart/mixed", FileName: "root"}
+	a1 := &Part{ContentType: "multipart/related", Parent: root, FileName: "a1"}
+	a2 := &Part{ContentType: "application/octet-stream", Parent: root, FileName: "a2"}
+	a3 := &Part{ContentType: "text/plain", Parent: root, FileName: "a3"}
+	b1 := &Part{ContentType: "image/png", Disposition: "attachment", Parent: a1, FileName: "b1"}
+	b2 := &Part{ContentType: "multipart/mixed", Encapsulated: true, Parent: a1, FileName: "b2"}
+	c1 := &Part{ContentType: "image/png", Disposition: "attachment", Parent: b2, FileName: "c1"}
+	root.FirstChild = a1
+	a1.NextSibling = a2
+	a2.NextSibling = a3
+	a1.FirstChild = b1
+	b1.NextSibling = b2
+	b2.FirstChild = c1
+
+	var got []string
+	root.Attachments(func(p *Part) bool {
+		got = append(got, p.FileName)
+		return true
+	})
+	if want := "a2,b1"; strings.Join(got, ",") != want {
+		t.Errorf("Attachments yielded: %v, want: %v", got, want)
+	}
+
+	// Stop early
+	got = nil
+	root.Attachments(func(p *Part) bool {
+		got = append(got, p.FileName)
+		return false
+	})
+	if want := "a2"; strings.Join(got, ",") != want {
+		t.Errorf("Attachments yielded: %v, want: %v", got, want)
+	}
+
+	// The encapsulated message has its own attachments
+	got = nil
+	b2.Attachments(func(p *Part) bool {
+		got = append(got, p.FileName)
+		return true
+	})
+	if want := "c1"; strings.Join(got, ",") != want {
+		t.Errorf("Attachments yielded: %v, want: %v", got, want)
+	}
+}
+
 func TestDepthMatchAll(t *testing.T) {
 	// Setup test MIME tree:
 	//    root
@@ -180,3 +280,323 @@ func TestDepthMatchAll(t *testing.T) {
 		t.Error("DepthMatchAll should have returned a3, got:", ps[1].FileName)
 	}
 }
+
+func TestSelectAll(t *testing.T) {
+	// Setup test MIME tree:
+	//    root
+	//    ├── a1
+	//    │   ├── b1
+	//    │   └── b2
+	//    ├── a2
+	//    └── a3
+
+	root := &Part{ContentType: "multipart/mixed"}
+	a1 := &Part{ContentType: "multipart/related", Parent: root}
+	a2 := &Part{ContentType: "application/pdf", Disposition: "attachment", Parent: root,
+		FileName: "report.pdf"}
+	a3 := &Part{ContentType: "Application/PDF", Disposition: "Attachment", Parent: root,
+		FileName: "summary.PDF"}
+	b1 := &Part{ContentType: "text/html", Disposition: "inline", Parent: a1}
+	b2 := &Part{ContentType: "application/pdf", Disposition: "inline", Parent: a1,
+		FileName: "chart.pdf"}
+	root.FirstChild = a1
+	a1.NextSibling = a2
+	a2.NextSibling = a3
+	a1.FirstChild = b1
+	b1.NextSibling = b2
+
+	ttable := []struct {
+		name    string
+		matcher PartMatcher
+		want    []*Part
+	}{
+		{"content type", MatchContentType("application/pdf"), []*Part{b2, a2, a3}},
+		{"disposition", MatchDisposition("attachment"), []*Part{a2, a3}},
+		{"glob", MatchFilenameGlob("*.pdf"), []*Part{b2, a2}},
+		{"glob all", MatchFilenameGlob("*"), []*Part{b2, a2, a3}},
+		{"glob malformed", MatchFilenameGlob("[.pdf"), []*Part{}},
+		{"none", func(p *Part) bool { return false }, []*Part{}},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			got := root.SelectAll(tt.matcher)
+			if len(got) != len(tt.want) {
+				t.Fatalf("SelectAll() got %v parts, want: %v", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("SelectAll()[%v] got: %+v, want: %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWalk(t *testing.T) {
+	// Setup test MIME tree:
+	//    root
+	//    ├── a1
+	//    │   ├── b1
+	//    │   └── b2
+	//    ├── a2
+	//    └── a3
+
+	root := &Part{ContentType: "multipart/alternative", FileName: "root"}
+	a1 := &Part{ContentType: "multipart/related", Parent: root, FileName: "a1"}
+	a2 := &Part{ContentType: "text/plain", Parent: root, FileName: "a2"}
+	a3 := &Part{ContentType: "text/html", Parent: root, FileName: "a3"}
+	b1 := &Part{ContentType: "text/plain", Parent: a1, FileName: "b1"}
+	b2 := &Part{ContentType: "text/html", Parent: a1, FileName: "b2"}
+	root.FirstChild = a1
+	a1.NextSibling = a2
+	a2.NextSibling = a3
+	a1.FirstChild = b1
+	b1.NextSibling = b2
+
+	var got []string
+	err := root.Walk(func(p *Part) error {
+		got = append(got, p.FileName)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "root a1 b1 b2 a2 a3"
+	if strings.Join(got, " ") != want {
+		t.Errorf("Walk visited: %v, want: %v", got, want)
+	}
+
+	// Walking a subtree must not visit its siblings
+	got = nil
+	_ = a1.Walk(func(p *Part) error {
+		got = append(got, p.FileName)
+		return nil
+	})
+	want = "a1 b1 b2"
+	if strings.Join(got, " ") != want {
+		t.Errorf("Walk visited: %v, want: %v", got, want)
+	}
+
+	// ErrStopWalk ends the walk without error
+	got = nil
+	err = root.Walk(func(p *Part) error {
+		got = append(got, p.FileName)
+		if p == b1 {
+			return ErrStopWalk
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Walk returned %v, want nil", err)
+	}
+	want = "root a1 b1"
+	if strings.Join(got, " ") != want {
+		t.Errorf("Walk visited: %v, want: %v", got, want)
+	}
+
+	// Other errors are returned
+	wantErr := errors.New("test error")
+	err = root.Walk(func(p *Part) error {
+		return wantErr
+	})
+	if err != wantErr {
+		t.Errorf("Walk returned %v, want %v", err, wantErr)
+	}
+}
+
+func TestWalkBreadthFirst(t *testing.T) {
+	// Setup test MIME tree:
+	//    root
+	//    ├── a1
+	//    │   ├── b1
+	//    │   └── b2
+	//    ├── a2
+	//    │   └── b3
+	//    └── a3
+
+	root := &Part{ContentType: "multipart/mixed", FileName: "root"}
+	a1 := &Part{ContentType: "multipart/related", Parent: root, FileName: "a1"}
+	a2 := &Part{ContentType: "multipart/related", Parent: root, FileName: "a2"}
+	a3 := &Part{ContentType: "text/html", Parent: root, FileName: "a3"}
+	b1 := &Part{ContentType: "text/plain", Parent: a1, FileName: "b1"}
+	b2 := &Part{ContentType: "text/html", Parent: a1, FileName: "b2"}
+	b3 := &Part{ContentType: "text/plain", Parent: a2, FileName: "b3"}
+	root.FirstChild = a1
+	a1.NextSibling = a2
+	a2.NextSibling = a3
+	a1.FirstChild = b1
+	b1.NextSibling = b2
+	a2.FirstChild = b3
+
+	var got []string
+	err := root.WalkBreadthFirst(func(p *Part) error {
+		got = append(got, p.FileName)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "root a1 a2 a3 b1 b2 b3"
+	if strings.Join(got, " ") != want {
+		t.Errorf("WalkBreadthFirst visited: %v, want: %v", got, want)
+	}
+
+	// Walking a subtree must not visit its siblings
+	got = nil
+	_ = a1.WalkBreadthFirst(func(p *Part) error {
+		got = append(got, p.FileName)
+		return nil
+	})
+	want = "a1 b1 b2"
+	if strings.Join(got, " ") != want {
+		t.Errorf("WalkBreadthFirst visited: %v, want: %v", got, want)
+	}
+
+	// ErrStopWalk ends the walk without error
+	got = nil
+	err = root.WalkBreadthFirst(func(p *Part) error {
+		got = append(got, p.FileName)
+		if p == a3 {
+			return ErrStopWalk
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("WalkBreadthFirst returned %v, want nil", err)
+	}
+	want = "root a1 a2 a3"
+	if strings.Join(got, " ") != want {
+		t.Errorf("WalkBreadthFirst visited: %v, want: %v", got, want)
+	}
+
+	// Other errors are returned
+	wantErr := errors.New("test error")
+	err = root.WalkBreadthFirst(func(p *Part) error {
+		return wantErr
+	})
+	if err != wantErr {
+		t.Errorf("WalkBreadthFirst returned %v, want %v", err, wantErr)
+	}
+}
+
+func TestWalkCycle(t *testing.T) {
+	root := &Part{FileName: "root"}
+	a1 := &Part{Parent: root, FileName: "a1"}
+	a2 := &Part{Parent: root, FileName: "a2"}
+	root.FirstChild = a1
+	a1.NextSibling = a2
+	a2.NextSibling = a1
+	a2.FirstChild = root
+
+	count := 0
+	_ = root.Walk(func(p *Part) error {
+		count++
+		return nil
+	})
+	if count != 3 {
+		t.Errorf("Walk visited %v parts, want 3", count)
+	}
+
+	count = 0
+	_ = root.WalkBreadthFirst(func(p *Part) error {
+		count++
+		return nil
+	})
+	if count != 3 {
+		t.Errorf("WalkBreadthFirst visited %v parts, want 3", count)
+	}
+}
+
+func TestMatchMediaType(t *testing.T) {
+	ttable := []struct {
+		ct, pattern string
+		want        bool
+	}{
+		{"application/json", "application/json", true},
+		{"Application/JSON", "application/json", true},
+		{"application/json; charset=utf-8", "application/json", true},
+		{"application/json", "application/xml", false},
+		{"image/png", "image/*", true},
+		{"image/svg+xml", "image/*", true},
+		{"text/plain", "image/*", false},
+		{"text/plain", "*/*", true},
+		{"text/plain", "*", true},
+		{"", "*/*", false},
+		{"application/vnd.api+json", "application/*+json", true},
+		{"application/VND.API+JSON", "application/*+json", true},
+		{"application/json", "application/*+json", true},
+		{"application/+json", "application/*+json", false},
+		{"application/vnd.api+json", "*/*+json", true},
+		{"image/svg+xml", "application/*+xml", false},
+		{"image/svg+xml", "*/*+xml", true},
+		{"application/xhtml+xml", "application/*+json", false},
+		{"application/jsonx", "application/*+json", false},
+		{"application/vnd.api+json", "application/json", false},
+		{"application", "application/*", false},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.ct+" "+tt.pattern, func(t *testing.T) {
+			if got := MatchMediaType(tt.ct, tt.pattern); got != tt.want {
+				t.Errorf("MatchMediaType(%q, %q) got: %v, want: %v", tt.ct, tt.pattern, got,
+					tt.want)
+			}
+		})
+	}
+}
+
+func TestCountDescendantsAndDepth(t *testing.T) {
+	// Setup test MIME tree:
+	//    root
+	//    ├── a1
+	//    │   ├── b1
+	//    │   │   └── c1
+	//    │   └── b2
+	//    └── a2
+
+	root := &Part{ContentType: "multipart/mixed"}
+	a1 := &Part{ContentType: "multipart/related", Parent: root}
+	a2 := &Part{ContentType: "application/pdf", Parent: root}
+	b1 := &Part{ContentType: "multipart/alternative", Parent: a1}
+	b2 := &Part{ContentType: "image/png", Parent: a1}
+	c1 := &Part{ContentType: "text/plain", Parent: b1}
+	root.FirstChild = a1
+	a1.NextSibling = a2
+	a1.FirstChild = b1
+	b1.NextSibling = b2
+	b1.FirstChild = c1
+
+	ttable := []struct {
+		name        string
+		part        *Part
+		descendants int
+		depth       int
+	}{
+		{"nil", nil, 0, 0},
+		{"root", root, 5, 3},
+		{"a1", a1, 3, 2},
+		{"b1", b1, 1, 1},
+		{"leaf", a2, 0, 0},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.part.CountDescendants(); got != tt.descendants {
+				t.Errorf("CountDescendants() got: %v, want: %v", got, tt.descendants)
+			}
+			if got := tt.part.Depth(); got != tt.depth {
+				t.Errorf("Depth() got: %v, want: %v", got, tt.depth)
+			}
+		})
+	}
+
+	// A cycle must not prevent either from returning
+	c1.FirstChild = root
+	if got := root.CountDescendants(); got != 5 {
+		t.Errorf("CountDescendants() with cycle got: %v, want: 5", got)
+	}
+	if got := root.Depth(); got != 3 {
+		t.Errorf("Depth() with cycle got: %v, want: 3", got)
+	}
+}
@@ -0,0 +1,121 @@
+package enmime
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// mboxFrom begins the separator line preceding each message in an mbox.
+var mboxFrom = []byte("From ")
+
+// ReadMbox returns a function that parses each message in the mbox read from r into an Envelope,
+// passing it to yield until yield returns false.  With Go 1.23 or later the result may be used
+// with range:
+//
+//	for e, err := range enmime.ReadMbox(r) {
+//		...
+//	}
+//
+// Messages are separated by lines beginning with "From ", at the start of the input or following
+// a blank line; the blank line is not part of the preceding message.  Lines escaped with a leading
+// ">", such as ">From " or ">>From ", have one ">" removed, as in the mboxrd format.  A message
+// that fails to parse is passed to yield as a nil Envelope and its error, and reading continues
+// with the next message.  An error reading r, or input not beginning with a "From " line, is
+// passed to yield and ends the reading.
+func ReadMbox(r io.Reader) func(yield func(*Envelope, error) bool) {
+	return defaultParser.ReadMbox(r)
+}
+
+// ReadMbox returns a function that parses each message in the mbox read from r into an Envelope,
+// using the options configured on the Parser, see the ReadMbox function for details.  Each message
+// is held in memory while it is parsed; a message larger than MaxBodySize is discarded as it is
+// read, and ErrMessageTooLarge passed to yield in its place.
+func (p *Parser) ReadMbox(r io.Reader) func(yield func(*Envelope, error) bool) {
+	return func(yield func(*Envelope, error) bool) {
+		br := bufio.NewReader(r)
+		var msg *bytes.Buffer
+		tooLarge := false // msg exceeded MaxBodySize and was discarded
+		blank := true     // The previous line was blank, or there was none
+		lineStart := true // The next read begins a line, rather than continuing a long one
+		emit := func() bool {
+			if tooLarge {
+				return yield(nil, ErrMessageTooLarge)
+			}
+			e, err := p.ReadEnvelopeBytes(trimMboxSeparator(msg.Bytes()))
+			return yield(e, err)
+		}
+		for {
+			// Lines longer than the buffer are read in pieces, so no line is held in full
+			line, err := br.ReadSlice('\n')
+			if err == bufio.ErrBufferFull {
+				err = nil
+			}
+			if len(line) > 0 {
+				switch {
+				case !lineStart:
+					if msg != nil && !tooLarge {
+						msg.Write(line)
+					}
+				case blank && bytes.HasPrefix(line, mboxFrom):
+					if msg != nil && !emit() {
+						return
+					}
+					msg = &bytes.Buffer{}
+					tooLarge = false
+				case msg == nil:
+					if !isBlankLine(line) {
+						yield(nil, fmt.Errorf("mbox does not begin with a From line"))
+						return
+					}
+				case !tooLarge:
+					msg.Write(unescapeMboxLine(line))
+				}
+				if msg != nil && !tooLarge && p.MaxBodySize > 0 &&
+					int64(len(trimMboxSeparator(msg.Bytes()))) > p.MaxBodySize {
+					tooLarge = true
+					msg = &bytes.Buffer{}
+				}
+				blank = lineStart && isBlankLine(line)
+				lineStart = line[len(line)-1] == '\n'
+			}
+			if err == io.EOF {
+				if msg != nil {
+					emit()
+				}
+				return
+			}
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+		}
+	}
+}
+
+// isBlankLine indicates whether line holds only a line ending.
+func isBlankLine(line []byte) bool {
+	return len(line) == 1 && line[0] == '\n' || len(line) == 2 && line[0] == '\r' && line[1] == '\n'
+}
+
+// unescapeMboxLine removes the ">" quoting a line that would otherwise be taken for, or be
+// confused with, an mbox separator.
+func unescapeMboxLine(line []byte) []byte {
+	unquoted := bytes.TrimLeft(line, ">")
+	if len(unquoted) < len(line) && bytes.HasPrefix(unquoted, mboxFrom) {
+		return line[1:]
+	}
+	return line
+}
+
+// trimMboxSeparator removes the blank line separating msg from the message following it.
+func trimMboxSeparator(msg []byte) []byte {
+	switch {
+	case bytes.HasSuffix(msg, []byte("\r\n\r\n")):
+		return msg[:len(msg)-2]
+	case bytes.HasSuffix(msg, []byte("\n\n")):
+		return msg[:len(msg)-1]
+	}
+	return msg
+}
@@ -0,0 +1,192 @@
+package enmime_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jhillyerd/enmime"
+	"github.com/jhillyerd/enmime/internal/test"
+)
+
+func TestReadMbox(t *testing.T) {
+	var got []*enmime.Envelope
+	enmime.ReadMbox(test.OpenTestData("mail", "messages.mbox"))(
+		func(e *enmime.Envelope, err error) bool {
+			if err != nil {
+				t.Error("Unexpected parse error:", err)
+			}
+			got = append(got, e)
+			return true
+		})
+	if len(got) != 3 {
+		t.Fatalf("ReadMbox() yielded %v messages, want: 3", len(got))
+	}
+
+	want := []struct {
+		subject, text, html string
+	}{
+		{
+			"First message",
+			"Plain text message\n" +
+				"From here on the line was escaped\n" +
+				">From a quoted escape\n" +
+				"From the middle of a paragraph\n" +
+				">Quoted text\n",
+			"",
+		},
+		{"Second message", "Second text\n", "<p>Second HTML</p>"},
+		{"Third message", "Third body\n", ""},
+	}
+	for i, w := range want {
+		e := got[i]
+		if s := e.GetHeader("Subject"); s != w.subject {
+			t.Errorf("Message %v Subject got: %q, want: %q", i, s, w.subject)
+		}
+		if e.Text != w.text {
+			t.Errorf("Message %v Text got: %q, want: %q", i, e.Text, w.text)
+		}
+		if e.HTML != w.html {
+			t.Errorf("Message %v HTML got: %q, want: %q", i, e.HTML, w.html)
+		}
+	}
+
+	// Reading stops when yield returns false
+	n := 0
+	enmime.ReadMbox(test.OpenTestData("mail", "messages.mbox"))(
+		func(e *enmime.Envelope, err error) bool {
+			n++
+			return false
+		})
+	if n != 1 {
+		t.Errorf("ReadMbox() yielded %v messages after stop, want: 1", n)
+	}
+}
+
+func TestReadMboxCRLF(t *testing.T) {
+	mbox := "\r\n" +
+		"From a@example.com Thu Oct 18 22:48:39 2012\r\n" +
+		"Subject: One\r\n" +
+		"\r\n" +
+		"One\r\n" +
+		"\r\n" +
+		"From b@example.com Thu Oct 18 22:48:39 2012\r\n" +
+		"Subject: Two\r\n" +
+		"\r\n" +
+		"Two\r\n"
+	var got []string
+	enmime.ReadMbox(strings.NewReader(mbox))(func(e *enmime.Envelope, err error) bool {
+		if err != nil {
+			t.Error("Unexpected parse error:", err)
+			return true
+		}
+		got = append(got, e.GetHeader("Subject")+":"+e.Text)
+		return true
+	})
+	want := "One:One\r\n,Two:Two\r\n"
+	if strings.Join(got, ",") != want {
+		t.Errorf("ReadMbox() got: %q, want: %q", strings.Join(got, ","), want)
+	}
+}
+
+func TestReadMboxErrors(t *testing.T) {
+	// Input must begin with a From line
+	var errs []error
+	enmime.ReadMbox(strings.NewReader("Subject: Hi\n\nHi\n"))(
+		func(e *enmime.Envelope, err error) bool {
+			errs = append(errs, err)
+			return true
+		})
+	if len(errs) != 1 || errs[0] == nil {
+		t.Errorf("ReadMbox() errors got: %v, want a single error", errs)
+	}
+
+	// Read errors are passed on
+	want := errors.New("read failed")
+	errs = nil
+	r := &mboxErrReader{data: "From a@example.com\nSubject: One\n\nOne\n", err: want}
+	enmime.ReadMbox(r)(func(e *enmime.Envelope, err error) bool {
+		errs = append(errs, err)
+		return true
+	})
+	if len(errs) != 1 || errs[0] != want {
+		t.Errorf("ReadMbox() errors got: %v, want: %v", errs, want)
+	}
+
+	// Empty input holds no messages
+	enmime.ReadMbox(strings.NewReader(""))(func(e *enmime.Envelope, err error) bool {
+		t.Errorf("ReadMbox() of empty input yielded: %v, %v", e, err)
+		return true
+	})
+}
+
+// mboxErrReader returns data followed by err.
+type mboxErrReader struct {
+	data string
+	err  error
+}
+
+func (r *mboxErrReader) Read(b []byte) (int, error) {
+	if r.data == "" {
+		return 0, r.err
+	}
+	n := copy(b, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestReadMboxMaxBodySize(t *testing.T) {
+	long := strings.Repeat("x", 10000)
+	mbox := "From a@example.com Thu Oct 18 22:48:39 2012\n" +
+		"Subject: One\n" +
+		"\n" +
+		"One\n" +
+		"\n" +
+		"From b@example.com Thu Oct 18 22:48:39 2012\n" +
+		"Subject: Two\n" +
+		"\n" +
+		long + "\n" +
+		"\n" +
+		"From c@example.com Thu Oct 18 22:48:39 2012\n" +
+		"Subject: Three\n" +
+		"\n" +
+		long[:100] + "\n"
+	var texts []string
+	read := func(parser *enmime.Parser) (subjects []string, errs []error) {
+		texts = nil
+		parser.ReadMbox(strings.NewReader(mbox))(func(e *enmime.Envelope, err error) bool {
+			errs = append(errs, err)
+			if e != nil {
+				subjects = append(subjects, e.GetHeader("Subject"))
+				texts = append(texts, e.Text)
+			}
+			return true
+		})
+		return subjects, errs
+	}
+
+	// Lines longer than the read buffer are kept intact
+	subjects, errs := read(enmime.NewParser())
+	if strings.Join(subjects, ",") != "One,Two,Three" {
+		t.Fatalf("Subjects got: %v, want: One,Two,Three", subjects)
+	}
+	if texts[1] != long+"\n" {
+		t.Errorf("Message 1 Text got %v bytes, want: %v", len(texts[1]), len(long)+1)
+	}
+	for _, err := range errs {
+		if err != nil {
+			t.Error("Unexpected parse error:", err)
+		}
+	}
+
+	// The oversized message is reported, reading continues with the next
+	parser := enmime.NewParser()
+	parser.MaxBodySize = 1000
+	subjects, errs = read(parser)
+	if strings.Join(subjects, ",") != "One,Three" {
+		t.Errorf("Subjects got: %v, want: One,Three", subjects)
+	}
+	if len(errs) != 3 || errs[0] != nil || errs[1] != enmime.ErrMessageTooLarge || errs[2] != nil {
+		t.Errorf("Errors got: %v, want: [<nil> %v <nil>]", errs, enmime.ErrMessageTooLarge)
+	}
+}
@@ -0,0 +1,296 @@
+package enmime
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jhillyerd/enmime/internal/coding"
+)
+
+// ErrMessageTooLarge is returned when a message exceeds Parser.MaxBodySize.
+var ErrMessageTooLarge = errors.New("message exceeds maximum size")
+
+// Parser parses MIME messages into a tree of Part objects, its fields control optional parsing
+// behavior.  Use NewParser to obtain a Parser with the default settings, which are the settings
+// used by the ReadParts and ReadEnvelope functions.  A Parser may be shared between goroutines as
+// long as its fields are not modified while it is in use.
+type Parser struct {
+	// DetectCharset enables guessing the character set of text parts that do not declare one.
+	// Each guess is recorded as a warning on the Part.
+	DetectCharset bool
+	// DefaultCharset is the character set assumed for text parts whose Content-Type does not
+	// declare one, such as "windows-1252" for a corpus known to use it.  When set it takes
+	// precedence over DetectCharset.  A message without a Content-Type header is us-ascii, RFC
+	// 2045, and is unaffected.
+	DefaultCharset string
+	// MaxDepth limits how deeply multipart Parts may be nested, protecting against stack
+	// exhaustion.  Multiparts beyond the limit are not parsed, their content is treated as data.
+	// Zero disables the limit.
+	MaxDepth int
+	// ValidateTransferEncoding enables checking content declared as 7bit or 8bit against the
+	// bytes actually present.  Violations are recorded as warnings on the Part.
+	ValidateTransferEncoding bool
+	// DetectBase64 enables decoding base64 content in non-text Parts that do not declare a
+	// Content-Transfer-Encoding, as sent by some broken mail software.  Content is treated as base64
+	// only if it contains nothing but base64 characters and line breaks.  Each detection is
+	// recorded as a warning on the Part.
+	DetectBase64 bool
+	// DetectQuotedPrintable enables decoding quoted-printable content in text Parts that declare
+	// a 7bit or 8bit Content-Transfer-Encoding, or none, as sent by some broken mail software.
+	// Content is treated as quoted-printable only if every equals sign in it begins an escape
+	// sequence or soft line break, there is at least one soft line break, and such sequences are
+	// frequent.  Each detection is recorded as a warning on the Part.
+	DetectQuotedPrintable bool
+	// LenientParsing enables recovery from structural problems, such as an unparseable
+	// Content-Type header, that would otherwise cause parsing to fail.  The affected Part is
+	// retained with its content treated as data, and a severe Error recorded on it.  Header lines
+	// that cannot be repaired, such as a first line without a colon, are skipped, and control
+	// characters are removed from header lines.  I/O errors are always returned.
+	LenientParsing bool
+	// ParseEncapsulated enables parsing the content of message/rfc822 Parts, such as forwarded
+	// messages, into a child Part tree.  The root of each encapsulated message has its
+	// Encapsulated field set.  Nesting counts towards MaxDepth.
+	ParseEncapsulated bool
+	// StreamContent enables streaming Part content rather than holding it in memory, for messages
+	// with very large attachments.  When set, StreamContent is called for each Part with content
+	// as soon as its header has been parsed, Read then returns the decoded content directly from
+	// the input.  Parts that follow are not yet present in the tree.  Content not read before
+	// StreamContent returns is discarded, and an error returned by StreamContent aborts parsing;
+	// ReadParts returns it wrapped in a ParseError.
+	//
+	// Streaming trades away everything that depends on retaining the content: Content and
+	// RawContent are nil and ContentLength returns -1, content may not be re-read after
+	// StreamContent returns, malformed base64 content is not replaced by the raw content,
+	// ValidateTransferEncoding, DetectBase64, DetectQuotedPrintable and ParseEncapsulated have no
+	// effect, and Envelopes built from the resulting Part tree have no Text or HTML.
+	StreamContent func(p *Part) error
+	// MaxBodySize limits the total number of bytes read from a message, including headers, to
+	// protect against excessive memory use.  ReadParts returns ErrMessageTooLarge if the message is
+	// larger, along with the portion of the Part tree parsed before the limit was reached; the
+	// Part being read at the time will be missing some or all of its content.  Zero disables the
+	// limit.
+	MaxBodySize int64
+	// DecodeContentEncoding enables decompressing Part content declared by a Content-Encoding
+	// header to be gzip or deflate compressed, as found in MIME-over-HTTP messages; it is not
+	// standard for email.  Decompression follows Content-Transfer-Encoding decoding.  Failures, and
+	// unsupported codings, are recorded as warnings on the Part.
+	DecodeContentEncoding bool
+	// MaxDecompressedSize limits the size of Part content decompressed due to
+	// DecodeContentEncoding, as a small compressed input may expand enormously.  Content beyond
+	// the limit is discarded and a warning recorded on the Part.  Zero applies MaxBodySize as the
+	// limit instead; if both are zero decompressed content is not limited.
+	MaxDecompressedSize int64
+	// NormalizeLineEndings enables converting CRLF and lone CR line endings to LF in the decoded
+	// content of text Parts.  Attachments and non-text Parts are not altered.
+	NormalizeLineEndings bool
+	// MaxParts limits the total number of Parts in the tree, including encapsulated messages, to
+	// protect against messages with huge numbers of tiny parts.  Parsing stops when the limit is
+	// reached, ReadParts returns the Parts parsed so far with a severe Error recorded on the root.
+	// Zero disables the limit.
+	MaxParts int
+	// StrictCharset guarantees the decoded content of Parts subject to character set conversion is
+	// valid UTF-8.  Bytes that cannot be converted, including those of Parts in a character set
+	// without a decoder, are replaced by U+FFFD rather than passed through; such Parts are still
+	// warned.
+	StrictCharset bool
+	// SniffContentType enables examining the decoded content of application/octet-stream Parts to
+	// guess their actual type, using http.DetectContentType.  The guess is stored in the Part's
+	// DetectedContentType field, ContentType is left as declared.  It has no effect when content is
+	// streamed.
+	SniffContentType bool
+	// AttachmentDispositions lists Content-Disposition values, in addition to attachment, that
+	// classify a Part as an attachment, such as "form-data" for multipart/form-data messages.
+	// Values are compared without regard to case.
+	AttachmentDispositions []string
+	// OnPart is called for each Part as soon as its header has been parsed, in document order and
+	// before its content is read, for progress reporting or to collect metadata.  It is called for
+	// multipart containers and the roots of encapsulated messages too.  The Part is already in the
+	// tree, but its content and children are not yet present.
+	OnPart func(p *Part)
+	// UnknownTransferEncodingAs8Bit treats content with an unrecognized Content-Transfer-Encoding
+	// as 8bit rather than leaving it undecoded, so that character set conversion is still applied.
+	// Such Parts are still warned.
+	UnknownTransferEncodingAs8Bit bool
+	// PreserveBOM leaves a byte order mark at the start of the decoded content of text Parts.  By
+	// default it is removed after character set conversion, for UTF-8 and UTF-16 alike.
+	PreserveBOM bool
+	// Observer, if set, is informed of each Part once it has been parsed and of statistics for
+	// each message, for monitoring.  It is called from the goroutine calling ReadParts or
+	// ReadEnvelope.
+	Observer Observer
+
+	partCount int // Parts created, only used by the per-message copy made in ReadParts
+}
+
+// Observer receives progress and statistics from the parsing of messages, see Parser.Observer.
+type Observer interface {
+	// PartParsed is called for each Part once its content, or for multipart and encapsulated
+	// message Parts their children, has been parsed.  Children are reported before their
+	// parent, so the root of the message is reported last.
+	PartParsed(p *Part)
+	// Done is called once parsing of a message has finished, whether or not it succeeded.
+	Done(stats ParseStats)
+}
+
+// ParseStats describes the parsing of a single message, see Observer.
+type ParseStats struct {
+	Duration  time.Duration // Time spent in ReadParts
+	BytesRead int64         // Bytes read from the input, including any not parsed
+	Parts     int           // Parts in the resulting tree, including the root
+	MaxDepth  int           // Nesting depth of the resulting tree, see Part.Depth
+	Errors    int           // Errors and warnings recorded on Parts of the tree
+	Err       error         // The error returned by ReadParts, if any
+}
+
+// defaultParser is used by the package level ReadParts and ReadEnvelope functions.
+var defaultParser = NewParser()
+
+// NewParser returns a Parser with the default settings.
+func NewParser() *Parser {
+	return &Parser{
+		DetectCharset: true,
+		MaxDepth:      100,
+		MaxParts:      10000,
+	}
+}
+
+// errMaxParts stops parsing once Parser.MaxParts has been reached.
+var errMaxParts = errors.New("maximum number of parts exceeded")
+
+// countPart records the creation of a Part, returning false if that would exceed MaxParts.
+func (p *Parser) countPart() bool {
+	if p.MaxParts > 0 && p.partCount >= p.MaxParts {
+		return false
+	}
+	p.partCount++
+	return true
+}
+
+// ReadEnvelope is a wrapper around ReadParts and EnvelopeFromPart, see the ReadEnvelope function
+// for details.
+func (p *Parser) ReadEnvelope(r io.Reader) (*Envelope, error) {
+	// Read MIME parts from reader
+	root, err := p.ReadParts(r)
+	if err != nil {
+		// ErrMessageTooLarge or a *ParseError, returned as is for callers to inspect
+		return nil, err
+	}
+	return EnvelopeFromPart(root)
+}
+
+// ReadEnvelopeBytes parses the message held in b into an Envelope, using the options configured on
+// the Parser, see the ReadEnvelope function for details.
+func (p *Parser) ReadEnvelopeBytes(b []byte) (*Envelope, error) {
+	return p.ReadEnvelope(bytes.NewReader(b))
+}
+
+// ReadEnvelopeTee parses the content of r into an Envelope, using the options configured on the
+// Parser, and also returns the complete raw message, see the ReadEnvelopeTee function for details.
+func (p *Parser) ReadEnvelopeTee(r io.Reader) (*Envelope, []byte, error) {
+	raw := &bytes.Buffer{}
+	e, err := p.ReadEnvelope(io.TeeReader(r, raw))
+	if err != nil {
+		return nil, nil, err
+	}
+	// Capture anything the parser left unread, such as trailing data
+	if p.MaxBodySize > 0 {
+		r = &sizeLimitReader{r: r, n: p.MaxBodySize - int64(raw.Len())}
+	}
+	if _, err := raw.ReadFrom(r); err != nil {
+		return nil, nil, err
+	}
+	return e, raw.Bytes(), nil
+}
+
+// sizeLimitReader reads from r until n bytes remain, after which it returns ErrMessageTooLarge
+// unless r is also exhausted.  Unlike io.LimitReader, it records that the limit was exceeded.
+type sizeLimitReader struct {
+	r        io.Reader
+	n        int64
+	exceeded bool
+}
+
+func (l *sizeLimitReader) Read(b []byte) (int, error) {
+	if l.n <= 0 {
+		// Only an error if there is more to read
+		var probe [1]byte
+		n, err := l.r.Read(probe[:])
+		if n == 0 {
+			return 0, err
+		}
+		l.exceeded = true
+		return 0, ErrMessageTooLarge
+	}
+	if int64(len(b)) > l.n {
+		b = b[:l.n]
+	}
+	n, err := l.r.Read(b)
+	l.n -= int64(n)
+	return n, err
+}
+
+// lineEndingReader counts the bytes, and the CRLF and bare LF line endings, read from r.
+type lineEndingReader struct {
+	r    io.Reader
+	n    int64
+	crlf int
+	lf   int
+	cr   bool // The previous byte read was CR
+}
+
+func (l *lineEndingReader) Read(b []byte) (int, error) {
+	n, err := l.r.Read(b)
+	l.n += int64(n)
+	if n > 0 {
+		b = b[:n]
+		crlf := bytes.Count(b, crnl)
+		if l.cr && b[0] == '\n' {
+			// CRLF split across reads
+			crlf++
+		}
+		l.crlf += crlf
+		l.lf += bytes.Count(b, []byte{'\n'}) - crlf
+		l.cr = b[n-1] == '\r'
+	}
+	return n, err
+}
+
+// RegisterCharsetReader registers a function to create readers converting the named character set
+// into UTF-8, for character sets enmime does not support, or to replace its built-in conversion.
+// The character set label is matched without regard to case, and aliases of supported character
+// sets, such as "latin1" for "iso-8859-1", are treated as equivalent.  Registering a nil fn
+// removes an earlier registration, restoring the built-in conversion.  RegisterCharsetReader is
+// safe to call concurrently with parsing.
+func RegisterCharsetReader(charset string, fn func(io.Reader) io.Reader) {
+	coding.RegisterCharsetReader(charset, fn)
+}
+
+// transferDecoders holds transfer decoder factories registered by RegisterTransferDecoder, keyed by
+// lowercase encoding name.
+var (
+	transferDecodersMu sync.RWMutex
+	transferDecoders   = make(map[string]func(io.Reader) io.Reader)
+)
+
+// RegisterTransferDecoder registers a function to create readers decoding the named
+// Content-Transfer-Encoding, such as "x-gzip64", for encodings enmime does not support.  The name
+// is matched without regard to case; built-in encodings cannot be replaced.  Content decoded by a
+// registered decoder then undergoes character set conversion as usual.  RegisterTransferDecoder is
+// safe to call concurrently with parsing.
+func RegisterTransferDecoder(name string, fn func(io.Reader) io.Reader) {
+	transferDecodersMu.Lock()
+	defer transferDecodersMu.Unlock()
+	transferDecoders[strings.ToLower(strings.TrimSpace(name))] = fn
+}
+
+// registeredTransferDecoder returns the decoder factory registered for the lowercase encoding
+// name, or nil.
+func registeredTransferDecoder(name string) func(io.Reader) io.Reader {
+	transferDecodersMu.RLock()
+	defer transferDecodersMu.RUnlock()
+	return transferDecoders[name]
+}
@@ -8,33 +8,54 @@ import (
 	"io"
 	"io/ioutil"
 	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
 	"net/textproto"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/jhillyerd/enmime/internal/coding"
 )
 
+// charsetSampleSize is the number of decoded bytes examined when detecting a character set.
+const charsetSampleSize = 1024
+
 // Part represents a node in the MIME multipart tree.  The Content-Type, Disposition and File Name
-// are parsed out of the header for easier access.
+// are parsed out of the header for easier access.  Attachments with no file name in their
+// Content-Disposition or Content-Type headers use their Content-Description as the FileName.
 type Part struct {
-	PartID      string               // PartID labels this parts position within the tree
-	Header      textproto.MIMEHeader // Header for this Part
-	Parent      *Part                // Parent of this part (can be nil)
-	FirstChild  *Part                // FirstChild is the top most child of this part
-	NextSibling *Part                // NextSibling of this part
-	Boundary    string               // Boundary marker used within this part
-	ContentID   string               // ContentID header for cid URL scheme
-	ContentType string               // ContentType header without parameters
-	Disposition string               // Content-Disposition header without parameters
-	FileName    string               // The file-name from disposition or type header
-	Charset     string               // The content charset encoding label
-	Errors      []Error              // Errors encountered while parsing this part
-	Content     []byte               // Content after decoding, UTF-8 conversion if applicable
-	Epilogue    []byte               // Epilogue contains data following the closing boundary marker
-	Utf8Reader  io.Reader            // DEPRECATED: The decoded content converted to UTF-8
-
-	rawReader     io.Reader // The raw Part content, no decoding or charset conversion
+	PartID              string               // PartID labels this parts position within the tree
+	Header              textproto.MIMEHeader // Header for this Part
+	Parent              *Part                // Parent of this part (can be nil)
+	FirstChild          *Part                // FirstChild is the top most child of this part
+	NextSibling         *Part                // NextSibling of this part
+	Boundary            string               // Boundary marker used within this part
+	ContentID           string               // ContentID header for cid URL scheme
+	ContentType         string               // ContentType header without parameters
+	ContentTypeParams   map[string]string    // Params from the Content-Type header, keys lowercased
+	Disposition         string               // Content-Disposition header without parameters
+	DispositionParams   map[string]string    // Params from Content-Disposition header, keys lowercased
+	FileName            string               // The file-name from disposition or type header
+	ContentDescription  string               // Content-Description header, RFC 2047 decoded
+	ContentLocation     string               // Content-Location header URL, whitespace removed
+	DetectedContentType string               // Sniffed type of octet-stream content, see Parser
+	Charset             string               // The content charset encoding label
+	TransferEncoding    string               // Content-Transfer-Encoding, lowercase, reused by Encode
+	Errors              []Error              // Errors encountered while parsing this part
+	Content             []byte               // Content after decoding, UTF-8 conversion if applicable
+	Preamble            []byte               // Preamble contains data preceding the first boundary marker
+	Epilogue            []byte               // Epilogue contains data following the closing boundary marker
+	Encapsulated        bool                 // Root of a message/rfc822 message nested in its Parent
+	LineEnding          string               // Dominant "\r\n" or "\n" line ending read, root only
+	Utf8Reader          io.Reader            // DEPRECATED: The decoded content converted to UTF-8
+
+	parser        *Parser   // Parser options used to build this Part
+	streamed      bool      // Content was streamed by Parser.StreamContent, not retained
+	rawContent    []byte    // The raw Part content, no decoding or charset conversion
+	rawEntity     []byte    // The raw headers and content of signed Parts, see RawSignedContent
+	rawHeader     []byte    // The header block exactly as it was read, see RawHeader
 	decodedReader io.Reader // The content decoded from quoted-printable or base64
 }
 
@@ -80,6 +101,248 @@ func (p *Part) AddChild(child *Part) {
 	}
 }
 
+// Replace puts newPart in the place of p within the Part tree, as a child of p's Parent and
+// between p's siblings.  newPart keeps its own children, and is first removed from any tree it
+// belongs to.  p is left detached, as by Remove.  A nil newPart removes p.  PartIDs are not
+// renumbered.  Safe to call on nil.
+func (p *Part) Replace(newPart *Part) {
+	if p == nil || newPart == p {
+		return
+	}
+	if newPart == nil {
+		p.Remove()
+		return
+	}
+	newPart.Remove()
+	newPart.Parent = p.Parent
+	newPart.NextSibling = p.NextSibling
+	p.splice(newPart)
+	p.Parent = nil
+	p.NextSibling = nil
+}
+
+// Remove detaches p from the Part tree, joining its preceding and following siblings.  p keeps
+// its children, so a subtree may be removed and added elsewhere with AddChild.  PartIDs are not
+// renumbered.  Safe to call on nil.
+func (p *Part) Remove() {
+	if p == nil {
+		return
+	}
+	p.splice(p.NextSibling)
+	p.Parent = nil
+	p.NextSibling = nil
+}
+
+// splice points the reference to p held by its Parent or preceding sibling at next.
+func (p *Part) splice(next *Part) {
+	if p.Parent == nil {
+		return
+	}
+	if p.Parent.FirstChild == p {
+		p.Parent.FirstChild = next
+		return
+	}
+	for c := p.Parent.FirstChild; c != nil; c = c.NextSibling {
+		if c.NextSibling == p {
+			c.NextSibling = next
+			return
+		}
+		if c == c.NextSibling {
+			// Prevent infinite loop
+			return
+		}
+	}
+}
+
+// ContentLength returns the length in bytes of the decoded Content, after transfer decoding and
+// character set conversion.  Content is held in memory, so this does not consume Read.  Use
+// RawContent to determine the length as it appeared in the message.  Returns -1 if the content was
+// streamed, see Parser.StreamContent.
+func (p *Part) ContentLength() int {
+	if p.streamed {
+		return -1
+	}
+	return len(p.Content)
+}
+
+// ContentReader returns a new io.ReadSeeker over the decoded Content, for use with functions such
+// as http.ServeContent.  Unlike Read, each call starts at the beginning of the Content.  The full
+// decoded content is held in memory for the lifetime of the Part; an error is returned if it was
+// streamed instead, see Parser.StreamContent.
+func (p *Part) ContentReader() (io.ReadSeeker, error) {
+	if p.streamed {
+		return nil, fmt.Errorf("Content of Part %v was streamed, it is not available", p.PartID)
+	}
+	return bytes.NewReader(p.Content), nil
+}
+
+// ContentInCharset returns Content re-encoded into the named character set, for example to quote
+// text in its original encoding.  Text Content has already been converted to UTF-8, which is the
+// assumed starting point.  Returns an error if the character set is not supported, or cannot
+// represent the content.
+func (p *Part) ContentInCharset(charset string) ([]byte, error) {
+	return coding.ConvertFromUTF8(charset, p.Content)
+}
+
+// SetContent replaces the content of this Part with b, which is taken to be already decoded, and
+// in UTF-8 if the Part is text.  Content, RawContent and Read reflect b afterwards; any unread
+// content is discarded.  The Content-Transfer-Encoding and Content-Encoding headers, and
+// TransferEncoding, are removed as b is not encoded; Encode selects a suitable transfer encoding.
+// The Charset of text Parts is set to UTF-8.  b is retained, not copied.
+func (p *Part) SetContent(b []byte) {
+	p.Content = b
+	p.rawContent = b
+	p.rawEntity = nil
+	p.streamed = false
+	p.decodedReader = bytes.NewReader(b)
+	p.Utf8Reader = bytes.NewReader(b)
+	p.TransferEncoding = ""
+	if p.Header != nil {
+		p.Header.Del(hnContentEncoding)
+		p.Header.Del(hnHTTPContentEncoding)
+	}
+	if p.TextContent() {
+		p.Charset = utf8
+	}
+}
+
+// Clone returns a deep copy of this Part and its descendants.  The Header, Content, Errors and other
+// fields are copied, so the clone may be modified without affecting the original.  Parent pointers
+// within the clone refer to the cloned tree; the clone itself has no Parent or NextSibling.
+// Content is fully read into memory during parsing, so there are no unread streams to materialize:
+// the clone's Utf8Reader starts at the beginning of Content regardless of how much of the
+// original's has been consumed.  Safe to call on nil.
+func (p *Part) Clone() *Part {
+	return p.clone(nil)
+}
+
+// clone recursively copies p and its children, attaching the copy to parent.
+func (p *Part) clone(parent *Part) *Part {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	c.Parent = parent
+	c.FirstChild = nil
+	c.NextSibling = nil
+	if p.Header != nil {
+		c.Header = make(textproto.MIMEHeader, len(p.Header))
+		for k, v := range p.Header {
+			c.Header[k] = append([]string(nil), v...)
+		}
+	}
+	c.ContentTypeParams = cloneParams(p.ContentTypeParams)
+	c.DispositionParams = cloneParams(p.DispositionParams)
+	c.Errors = append([]Error(nil), p.Errors...)
+	c.Content = append([]byte(nil), p.Content...)
+	c.Preamble = append([]byte(nil), p.Preamble...)
+	c.Epilogue = append([]byte(nil), p.Epilogue...)
+	c.rawContent = append([]byte(nil), p.rawContent...)
+	c.rawEntity = append([]byte(nil), p.rawEntity...)
+	c.rawHeader = append([]byte(nil), p.rawHeader...)
+	c.decodedReader = nil
+	if p.Utf8Reader != nil {
+		c.Utf8Reader = bytes.NewReader(c.Content)
+	}
+	var last *Part
+	for child := p.FirstChild; child != nil; child = child.NextSibling {
+		cc := child.clone(&c)
+		if last == nil {
+			c.FirstChild = cc
+		} else {
+			last.NextSibling = cc
+		}
+		last = cc
+	}
+	return &c
+}
+
+// cloneParams returns a copy of the header parameter map m, or nil if m is nil.
+func cloneParams(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	c := make(map[string]string, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// DispositionDate parses the named date parameter of the Content-Disposition header, one of
+// "creation-date", "modification-date" or "read-date" defined by RFC 2183.  Returns an error if the
+// parameter is not present, or is not a valid RFC 5322 date-time.
+func (p *Part) DispositionDate(name string) (time.Time, error) {
+	value, ok := p.DispositionParams[strings.ToLower(name)]
+	if !ok {
+		return time.Time{}, fmt.Errorf("Content-Disposition has no %s parameter", name)
+	}
+	return mail.ParseDate(value)
+}
+
+// String returns an indented outline of this Part and its descendants for debugging.  Each line
+// describes a Part's ID, content type, disposition, file name, character set and content length,
+// followed by any Errors.  Content readers are not consumed.
+func (p *Part) String() string {
+	if p == nil {
+		return "<nil>"
+	}
+	b := &bytes.Buffer{}
+	p.writeOutline(b, 0)
+	return b.String()
+}
+
+// writeOutline writes the outline of p and its descendants to b, indented by depth.
+func (p *Part) writeOutline(b *bytes.Buffer, depth int) {
+	indent := strings.Repeat("  ", depth)
+	b.WriteString(indent)
+	if p.PartID != "" {
+		b.WriteString(p.PartID + " ")
+	}
+	if p.ContentType != "" {
+		b.WriteString(p.ContentType)
+	} else {
+		b.WriteString("(no content type)")
+	}
+	if p.Disposition != "" {
+		fmt.Fprintf(b, " disposition=%s", p.Disposition)
+	}
+	if p.FileName != "" {
+		fmt.Fprintf(b, " filename=%q", p.FileName)
+	}
+	if p.Charset != "" {
+		fmt.Fprintf(b, " charset=%s", p.Charset)
+	}
+	if p.Encapsulated {
+		b.WriteString(" encapsulated")
+	}
+	fmt.Fprintf(b, " len=%d\n", len(p.Content))
+	for i := range p.Errors {
+		fmt.Fprintf(b, "%s  %s\n", indent, p.Errors[i].String())
+	}
+	for c := p.FirstChild; c != nil; c = c.NextSibling {
+		c.writeOutline(b, depth+1)
+	}
+}
+
+// GetHeader returns the value of the specified header, with folding removed and RFC 2047 encoded
+// words decoded to UTF-8.  Returns an empty string if the header is not present.
+func (p *Part) GetHeader(name string) string {
+	if p.Header == nil {
+		return ""
+	}
+	return decodeHeader(unfoldHeader(p.Header.Get(name)))
+}
+
+// SetHeader sets the specified header to value, replacing any existing values.  The value is
+// stored as given, GetHeader performs decoding when it is read.
+func (p *Part) SetHeader(name, value string) {
+	if p.Header == nil {
+		p.Header = make(textproto.MIMEHeader)
+	}
+	p.Header.Set(name, value)
+}
+
 // Read returns the decoded & UTF-8 converted content; implements io.Reader.
 func (p *Part) Read(b []byte) (n int, err error) {
 	if p.Utf8Reader == nil {
@@ -88,24 +351,204 @@ func (p *Part) Read(b []byte) (n int, err error) {
 	return p.Utf8Reader.Read(b)
 }
 
+// WriteTo writes the decoded & UTF-8 converted content to w; implements io.WriterTo, which io.Copy
+// prefers over Read.  WriteTo consumes the same stream as Read: content already consumed by Read
+// is not written, and a subsequent Read returns io.EOF.
+func (p *Part) WriteTo(w io.Writer) (n int64, err error) {
+	if p.Utf8Reader == nil {
+		return 0, nil
+	}
+	return io.Copy(w, p.Utf8Reader)
+}
+
+// RawContent returns the content of this Part exactly as it appeared in the message, prior to any
+// transfer decoding or character set conversion.  Multipart container Parts have no content of
+// their own, RawContent returns nil for them.
+func (p *Part) RawContent() ([]byte, error) {
+	return p.rawContent, nil
+}
+
+// PartKind classifies a Part by its role in a message, see Part.Kind.
+type PartKind int
+
+// PartKind values.
+const (
+	PartKindOther      PartKind = iota // Content that is neither text nor declared an attachment
+	PartKindMultipart                  // Container of other Parts
+	PartKindText                       // Plain text or HTML, candidates for the message body
+	PartKindAttachment                 // Attachments
+	PartKindInline                     // Inline content, such as images referenced by HTML
+)
+
+// String returns the name of the PartKind.
+func (k PartKind) String() string {
+	switch k {
+	case PartKindMultipart:
+		return "Multipart"
+	case PartKindText:
+		return "Text"
+	case PartKindAttachment:
+		return "Attachment"
+	case PartKindInline:
+		return "Inline"
+	}
+	return "Other"
+}
+
+// Kind classifies this Part from its ContentType, Disposition, FileName and ContentID.  The first
+// matching rule applies:
+//
+//   - multipart/* content types are PartKindMultipart
+//   - attachment dispositions, including Parser.AttachmentDispositions, and
+//     application/octet-stream content, are PartKindAttachment
+//   - inline dispositions are PartKindInline if the Part has a ContentID or ContentLocation by
+//     which the message may refer to it
+//   - other inline Parts that are not text/* are PartKindAttachment, as nothing can display them
+//     in place; mail clients mark text bodies inline too, with or without a file name
+//   - text/plain and text/html content, or no content type, is PartKindText
+//   - everything else is PartKindOther
+//
+// Envelope.Attachments and Envelope.Inlines hold the PartKindAttachment and PartKindInline Parts
+// of a message, PartKindText Parts are candidates for its Text and HTML bodies.
+func (p *Part) Kind() PartKind {
+	ctype := strings.ToLower(p.ContentType)
+	inline := strings.EqualFold(p.Disposition, cdInline)
+	text := ctype == "" || ctype == ctTextPlain || ctype == ctTextHTML
+	switch {
+	case strings.HasPrefix(ctype, ctMultipartPrefix):
+		return PartKindMultipart
+	case p.attachmentDisposition() || ctype == ctAppOctetStream:
+		return PartKindAttachment
+	case inline && (p.ContentID != "" || p.ContentLocation != ""):
+		return PartKindInline
+	case inline && !strings.HasPrefix(ctype, ctTextPrefix):
+		return PartKindAttachment
+	case text:
+		return PartKindText
+	}
+	return PartKindOther
+}
+
+// attachmentDisposition returns true if the Disposition of this Part is attachment, or one of the
+// Parser.AttachmentDispositions.  Dispositions are compared without regard to case.
+func (p *Part) attachmentDisposition() bool {
+	if strings.EqualFold(p.Disposition, cdAttachment) {
+		return true
+	}
+	if p.parser != nil {
+		for _, d := range p.parser.AttachmentDispositions {
+			if strings.EqualFold(p.Disposition, d) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsSigned indicates whether this is a multipart/signed Part, RFC 1847.  Its protocol parameter,
+// ContentTypeParams["protocol"], identifies the signature mechanism, such as
+// "application/pgp-signature" or "application/pkcs7-signature".
+func (p *Part) IsSigned() bool {
+	return p.ContentType == ctMultipartSigned
+}
+
+// SignedContent returns the first child of a multipart/signed Part, which holds the content covered
+// by the signature.  Returns nil if this Part is not signed.  Verify the signature against
+// RawSignedContent, not the decoded Content.
+func (p *Part) SignedContent() *Part {
+	if !p.IsSigned() {
+		return nil
+	}
+	return p.FirstChild
+}
+
+// Signature returns the second child of a multipart/signed Part, which holds the signature.  Its
+// ContentType should match the protocol parameter of this Part.  Returns nil if this Part is not
+// signed, or the signature is missing.
+func (p *Part) Signature() *Part {
+	if c := p.SignedContent(); c != nil {
+		return c.NextSibling
+	}
+	return nil
+}
+
+// RawSignedContent returns the headers and content of the signed content Part exactly as they
+// appeared in the message, byte-for-byte, for use in signature verification.  The line break
+// preceding the boundary that follows is excluded, per RFC 1847.  Returns an error if this Part is
+// not signed, or the signed content was streamed, see Parser.StreamContent.
+func (p *Part) RawSignedContent() ([]byte, error) {
+	c := p.SignedContent()
+	if c == nil {
+		return nil, fmt.Errorf("Part %v is not %v", p.PartID, ctMultipartSigned)
+	}
+	if c.rawEntity == nil {
+		return nil, fmt.Errorf("Signed content of Part %v was not retained", p.PartID)
+	}
+	return c.rawEntity, nil
+}
+
+// IsEncrypted indicates whether this is a multipart/encrypted Part, RFC 1847.  Its first child
+// holds control information for the mechanism identified by the protocol parameter,
+// ContentTypeParams["protocol"]; its second child, returned by EncryptedContent, holds the
+// encrypted data.
+func (p *Part) IsEncrypted() bool {
+	return p.ContentType == ctMultipartEncrypted
+}
+
+// EncryptedContent returns the second child of a multipart/encrypted Part, which holds the
+// encrypted data.  Returns nil if this Part is not encrypted, or the data is missing.
+func (p *Part) EncryptedContent() *Part {
+	if !p.IsEncrypted() || p.FirstChild == nil {
+		return nil
+	}
+	return p.FirstChild.NextSibling
+}
+
+// RawHeader returns the header block of this Part exactly as it appeared in the message, with the
+// original folding, case and order of fields, for DKIM and ARC verification.  The blank line that
+// ends the header block is excluded.  Returns nil for Parts that were not parsed.
+func (p *Part) RawHeader() []byte {
+	return p.rawHeader
+}
+
 // TextContent indicates whether the content is text based on its content type.  This value
 // determines what content transfer encoding scheme to use.
 func (p *Part) TextContent() bool {
-	if p.ContentType == "" {
+	return textContentType(p.ContentType)
+}
+
+// textContentType indicates whether the content type ctype is text, see TextContent.
+func textContentType(ctype string) bool {
+	if ctype == "" {
 		// RFC 2045: no CT is equivalent to "text/plain; charset=us-ascii"
 		return true
 	}
-	return strings.HasPrefix(p.ContentType, "text/") ||
-		strings.HasPrefix(p.ContentType, ctMultipartPrefix)
+	return strings.HasPrefix(ctype, "text/") || strings.HasPrefix(ctype, ctMultipartPrefix)
+}
+
+// IsBinary indicates whether the Content-Transfer-Encoding of this Part is binary, meaning its
+// content is unencoded 8-bit data without line length limits.  Such parts are often large; see
+// Parser.StreamContent to avoid holding their content in memory.
+func (p *Part) IsBinary() bool {
+	return parseTransferEncoding(p.Header.Get(hnContentEncoding)) == cteBinary
 }
 
 // setupHeaders reads the header, then populates the MIME header values for this Part.
 func (p *Part) setupHeaders(r *bufio.Reader, defaultContentType string) error {
 	header, err := readHeader(r, p)
 	if err != nil {
+		if _, ok := err.(textproto.ProtocolError); ok && p.parser.LenientParsing {
+			// Keep the portion of the header that was parsed, treat the content as data.
+			p.addError(ErrorMalformedHeader, "Failed to parse header: %v", err)
+			p.Header = header
+			return nil
+		}
 		return err
 	}
 	p.Header = header
+	p.checkHeaderDecoding()
+	p.checkDuplicateHeaders()
+	p.TransferEncoding = parseTransferEncoding(header.Get(hnContentEncoding))
 	ctype := header.Get(hnContentType)
 	if ctype == "" {
 		if defaultContentType == "" {
@@ -117,35 +560,146 @@ func (p *Part) setupHeaders(r *bufio.Reader, defaultContentType string) error {
 	// Parse Content-Type header
 	mtype, mparams, err := parseMediaType(ctype)
 	if err != nil {
+		if p.parser.LenientParsing {
+			// Treat the content as data.
+			p.addError(ErrorMalformedContentType, "Failed to parse Content-Type %q: %v", ctype, err)
+			return nil
+		}
 		return err
 	}
+	if names := valuelessParams(ctype); len(names) > 0 {
+		p.addWarning(
+			ErrorMalformedContentType,
+			"Content-Type %q has parameters without a value %q, using %q",
+			ctype, names, mtype)
+	}
+	if !strings.Contains(mtype, "/") {
+		defaultType := defaultSubtype(mtype)
+		p.addWarning(
+			ErrorMalformedContentType,
+			"Content-Type %q has no subtype, using %q",
+			mtype, defaultType)
+		mtype = defaultType
+	}
 	p.ContentType = mtype
 	// Set disposition, filename, charset if available
 	p.setupContentHeaders(mparams)
 	p.Boundary = mparams[hpBoundary]
+	if boundary := cleanBoundary(p.Boundary); boundary != p.Boundary {
+		p.addWarning(
+			ErrorMalformedContentType,
+			"Boundary %q was malformed, using %q",
+			p.Boundary, boundary)
+		p.Boundary = boundary
+	}
+	if p.Boundary == "" && strings.HasPrefix(p.ContentType, ctMultipartPrefix) {
+		// The content follows the header in r
+		p.Boundary = sniffBoundary(r)
+		if p.Boundary != "" {
+			p.addWarning(
+				ErrorMissingBoundary,
+				"Content-Type %v has no boundary parameter, using %q found in content",
+				p.ContentType, p.Boundary)
+		} else {
+			p.addWarning(
+				ErrorMissingBoundary,
+				"Content-Type %v has no boundary parameter, content treated as a single part",
+				p.ContentType)
+		}
+	}
 	p.ContentID = coding.FromIDHeader(header.Get(hnContentID))
+	// URLs may be folded anywhere, RFC 2557
+	p.ContentLocation = strings.Join(strings.Fields(header.Get(hnContentLocation)), "")
 	return nil
 }
 
+// checkDuplicateHeaders adds a warning for each header that determines how the content is parsed,
+// but appears more than once.  Only the first occurrence is used.
+func (p *Part) checkDuplicateHeaders() {
+	for _, name := range []string{hnContentType, hnContentEncoding} {
+		if values := p.Header[name]; len(values) > 1 {
+			p.addWarning(
+				ErrorDuplicateHeader,
+				"Found %v %v headers, using the first: %q",
+				len(values), name, values[0])
+		}
+	}
+}
+
 // setupContentHeaders uses Content-Type media params and Content-Disposition headers to populate
 // the disposition, filename, and charset fields.
 func (p *Part) setupContentHeaders(mediaParams map[string]string) {
+	p.ContentTypeParams = mediaParams
 	// Determine content disposition, filename, character set
-	disposition, dparams, err := parseMediaType(p.Header.Get(hnContentDisposition))
+	cdisp := p.Header.Get(hnContentDisposition)
+	disposition, dparams, err := parseMediaType(cdisp)
 	if err == nil {
 		// Disposition is optional
 		p.Disposition = disposition
-		p.FileName = decodeHeader(dparams[hpFilename])
+		p.DispositionParams = dparams
+		p.FileName = p.decodeFileName(dparams[hpFilename])
+		if names := valuelessParams(cdisp); len(names) > 0 {
+			p.addWarning(
+				ErrorMalformedDisposition,
+				"Content-Disposition %q has parameters without a value %q, using %q",
+				cdisp, names, disposition)
+		}
+	} else if cdisp != "" {
+		p.addWarning(ErrorMalformedDisposition, "Failed to parse Content-Disposition %q: %v",
+			cdisp, err)
 	}
 	if p.FileName == "" && mediaParams[hpName] != "" {
-		p.FileName = decodeHeader(mediaParams[hpName])
+		p.FileName = p.decodeFileName(mediaParams[hpName])
 	}
 	if p.FileName == "" && mediaParams[hpFile] != "" {
-		p.FileName = decodeHeader(mediaParams[hpFile])
+		p.FileName = p.decodeFileName(mediaParams[hpFile])
+	}
+	if desc := p.Header.Get(hnContentDescription); desc != "" {
+		decoded, err := decodeHeaderErr(unfoldHeader(desc))
+		if err != nil {
+			p.addWarning(ErrorHeaderDecode, "Failed to decode Content-Description %q: %v", desc, err)
+		}
+		p.ContentDescription = decoded
+		if p.FileName == "" && p.attachmentDisposition() {
+			// Some clients name attachments only by their description
+			p.FileName = decoded
+		}
 	}
 	if p.Charset == "" {
-		p.Charset = mediaParams[hpCharset]
+		p.Charset = coding.NormalizeCharset(mediaParams[hpCharset])
+	}
+}
+
+// checkHeaderDecoding adds a warning for each header value with encoded-words that cannot be
+// decoded, or only without character set conversion.  Content-Description and the parameters of
+// Content-Type and Content-Disposition are checked as they are parsed.
+func (p *Part) checkHeaderDecoding() {
+	names := make([]string, 0, len(p.Header))
+	for name := range p.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch name {
+		case hnContentDescription, hnContentType, hnContentDisposition:
+			continue
+		}
+		for _, v := range p.Header[name] {
+			if _, err := decodeHeaderErr(unfoldHeader(v)); err != nil {
+				p.addWarning(ErrorHeaderDecode, "Failed to decode %v header %q: %v", name, v, err)
+			}
+		}
+	}
+}
+
+// decodeFileName decodes RFC 2047 encoded words in a file name parameter, adding a warning if
+// decoding fails.
+func (p *Part) decodeFileName(name string) string {
+	decoded, err := decodeHeaderErr(name)
+	if err != nil {
+		p.addWarning(ErrorHeaderDecode, "Failed to decode file name %q: %v", name, err)
 	}
+	return decoded
 }
 
 // buildContentReaders sets up the decodedReader and utf8Reader based on the Part headers.  If no
@@ -153,43 +707,147 @@ func (p *Part) setupContentHeaders(mediaParams map[string]string) {
 // If the content encoding type is not recognized, no effort will be made to do character set
 // conversion.
 func (p *Part) buildContentReaders(r io.Reader) error {
-	// Read raw content into buffer
-	buf := new(bytes.Buffer)
-	if _, err := buf.ReadFrom(r); err != nil {
-		return err
-	}
+	var contentReader io.Reader
+	if p.parser.StreamContent != nil {
+		// Decode directly from the input
+		p.streamed = true
+		contentReader = r
+	} else {
+		// Read raw content into buffer
+		buf := new(bytes.Buffer)
+		if _, err := buf.ReadFrom(r); err != nil {
+			if err != io.ErrUnexpectedEOF {
+				return err
+			}
+			// Message was truncated; keep what we have.
+			p.addWarning(ErrorUnexpectedEOF, "Content ended before the closing boundary was found")
+		}
 
-	var contentReader io.Reader = buf
+		// Retain raw content; reading buf does not modify the underlying bytes
+		p.rawContent = buf.Bytes()
+		contentReader = buf
+	}
 	valid := true
 
-	// Raw content reader
-	p.rawReader = contentReader
-
-	// Allow later access to Base64 errors
+	// Allow later access to quoted-printable and Base64 errors
+	var qpcleaner *coding.QPCleaner
 	var b64cleaner *coding.Base64Cleaner
+	// Allow later access to uuencode file name and errors
+	var uudecoder *coding.UUDecoder
 
 	// Build content decoding reader
 	encoding := p.Header.Get(hnContentEncoding)
-	switch strings.ToLower(encoding) {
-	case cteQuotedPrintable:
-		contentReader = coding.NewQPCleaner(contentReader)
-		contentReader = quotedprintable.NewReader(contentReader)
-	case cteBase64:
+	cte := parseTransferEncoding(encoding)
+	if cte == "" && p.parser.DetectBase64 && !p.streamed && !p.TextContent() &&
+		coding.LooksLikeBase64(p.rawContent) {
+		cte = cteBase64
+		p.addWarning(
+			ErrorContentEncoding,
+			"Content-Transfer-Encoding was not declared, detected base64")
+	}
+	if (cte == "" || cte == cte7Bit || cte == cte8Bit) && p.parser.DetectQuotedPrintable &&
+		!p.streamed && p.TextContent() && coding.LooksLikeQuotedPrintable(p.rawContent) {
+		if cte == "" {
+			p.addWarning(
+				ErrorContentEncoding,
+				"Content-Transfer-Encoding was not declared, detected quoted-printable")
+		} else {
+			p.addWarning(
+				ErrorContentEncoding,
+				"Content-Transfer-Encoding was declared as %q, detected quoted-printable",
+				encoding)
+		}
+		cte = cteQuotedPrintable
+	}
+	switch cte {
+	case cteQuotedPrintable, cteXQuotedPrintable:
+		qpcleaner = coding.NewQPCleaner(contentReader)
+		contentReader = quotedprintable.NewReader(qpcleaner)
+	case cteBase64, cteXBase64:
 		b64cleaner = coding.NewBase64Cleaner(contentReader)
 		contentReader = base64.NewDecoder(base64.RawStdEncoding, b64cleaner)
-	case cte8Bit, cte7Bit, cteBinary, "":
+	case cteUUEncode, cteXUUEncode, cteXUUE:
+		uudecoder = coding.NewUUDecoder(contentReader)
+		contentReader = uudecoder
+	case cte8Bit, cte7Bit:
+		// No decoding required
+		if p.parser.ValidateTransferEncoding && !p.streamed {
+			p.checkTransferEncoding(cte)
+		}
+	case cteBinary, "":
 		// No decoding required
 	default:
+		if decoder := registeredTransferDecoder(cte); decoder != nil {
+			contentReader = decoder(contentReader)
+			break
+		}
+		if cte == cteXGzip64 {
+			// Known, but not supported
+			valid = false
+			p.addWarning(
+				ErrorContentEncoding,
+				"Content-Transfer-Encoding type %q is not supported, content was not decoded",
+				encoding)
+			break
+		}
 		// Unknown encoding
+		if p.parser.UnknownTransferEncodingAs8Bit {
+			cte = cte8Bit
+			p.addWarning(
+				ErrorContentEncoding,
+				"Unrecognized Content-Transfer-Encoding type %q, treated as 8bit",
+				encoding)
+			break
+		}
 		valid = false
 		p.addWarning(
 			ErrorContentEncoding,
 			"Unrecognized Content-Transfer-Encoding type %q",
 			encoding)
 	}
+	if valid && cte != "" && cte != cte7Bit && cte != cte8Bit && cte != cteBinary &&
+		requiresIdentityEncoding(p.ContentType) {
+		// Decoded before any parsing of the encapsulated message, see parseEncapsulated
+		p.addWarning(
+			ErrorContentEncoding,
+			"Content-Type %v may not have Content-Transfer-Encoding %q, decoded it",
+			p.ContentType, encoding)
+	}
 	p.decodedReader = contentReader
 
+	var decompressor *coding.Decompressor
+	if valid && p.parser.DecodeContentEncoding {
+		switch cenc := strings.TrimSpace(p.Header.Get(hnHTTPContentEncoding)); {
+		case coding.IsCompression(cenc):
+			decompressor = coding.NewDecompressor(contentReader, cenc)
+			decompressor.MaxSize = p.parser.MaxDecompressedSize
+			if decompressor.MaxSize == 0 {
+				decompressor.MaxSize = p.parser.MaxBodySize
+			}
+			contentReader = decompressor
+		case cenc != "" && !strings.EqualFold(cenc, "identity"):
+			valid = false
+			p.addWarning(ErrorContentEncoding, "Unsupported Content-Encoding type %q", cenc)
+		}
+	}
+
 	if valid && !detectAttachmentHeader(p.Header) {
+		if p.Charset == "" && p.parser.DefaultCharset != "" && p.TextContent() {
+			p.Charset = coding.NormalizeCharset(p.parser.DefaultCharset)
+		}
+		if p.Charset == "" && p.parser.DetectCharset && p.TextContent() {
+			// Guess the character set from the start of the decoded content
+			br := bufio.NewReader(contentReader)
+			contentReader = br
+			sample, _ := br.Peek(charsetSampleSize)
+			if charset := coding.DetectCharset(sample); charset != "" {
+				p.Charset = charset
+				p.addWarning(
+					ErrorCharsetDeclaration,
+					"Character set was not declared, detected %q",
+					charset)
+			}
+		}
 		// decodedReader is good; build character set conversion reader
 		if p.Charset != "" {
 			if reader, err := coding.NewCharsetReader(p.Charset, contentReader); err == nil {
@@ -199,7 +857,7 @@ func (p *Part) buildContentReaders(r io.Reader) error {
 				// like charset="charset=utf-8"
 				charsetp := strings.Split(p.Charset, "=")
 				if strings.ToLower(charsetp[0]) == "charset" && len(charsetp) > 1 {
-					p.Charset = charsetp[1]
+					p.Charset = coding.NormalizeCharset(charsetp[1])
 					if reader, err := coding.NewCharsetReader(p.Charset, contentReader); err == nil {
 						contentReader = reader
 					} else {
@@ -212,70 +870,430 @@ func (p *Part) buildContentReaders(r io.Reader) error {
 				}
 			}
 		}
+		if p.parser.StrictCharset && (p.Charset != "" || p.TextContent()) {
+			contentReader = coding.NewUTF8Reader(contentReader)
+		}
+		if !p.parser.PreserveBOM && p.TextContent() {
+			// Converted UTF-16 content begins with U+FEFF in UTF-8 too
+			contentReader = coding.NewBOMReader(contentReader)
+		}
+	}
+	if valid && p.ContentType == ctTextPlain &&
+		strings.EqualFold(p.ContentTypeParams[hpFormat], "flowed") {
+		// Unwrap RFC 3676 soft line breaks
+		delSp := strings.EqualFold(p.ContentTypeParams[hpDelSp], "yes")
+		contentReader = coding.NewFlowedReader(contentReader, delSp)
+	}
+	if valid && p.parser.NormalizeLineEndings && !detectAttachmentHeader(p.Header) &&
+		(p.ContentType == "" || strings.HasPrefix(p.ContentType, ctTextPrefix)) {
+		contentReader = coding.NewLFReader(contentReader)
+	}
+	if p.streamed {
+		if err := p.streamContent(contentReader, r); err != nil {
+			return err
+		}
+		p.summarizeDecoding(qpcleaner, b64cleaner, uudecoder)
+		p.summarizeDecompression(decompressor)
+		return nil
 	}
 	// Messy until Utf8Reader is removed
 	content, err := ioutil.ReadAll(contentReader)
+	_, fallback := err.(base64.CorruptInputError)
+	if fallback {
+		// Content was likely not base64 encoded, despite the header; use raw content
+		p.addWarning(
+			ErrorMalformedBase64,
+			"Failed to decode base64 content, using raw content instead: %v",
+			err)
+		content = append([]byte(nil), p.rawContent...)
+		err = nil
+		// Decoding anomalies are irrelevant to the raw content
+		b64cleaner = nil
+	}
 	p.Utf8Reader = bytes.NewReader(content)
 	p.Content = content
+	if p.parser.SniffContentType && p.ContentType == ctAppOctetStream {
+		p.DetectedContentType = sniffContentType(content)
+	}
+	p.summarizeDecoding(qpcleaner, b64cleaner, uudecoder)
+	if !fallback {
+		p.summarizeDecompression(decompressor)
+	}
+	return err
+}
+
+// sniffContentType returns the media type of content as determined by http.DetectContentType,
+// without parameters, or an empty string if the type could not be determined.
+func sniffContentType(content []byte) string {
+	if len(content) == 0 {
+		return ""
+	}
+	mediatype := http.DetectContentType(content)
+	if i := strings.IndexByte(mediatype, ';'); i >= 0 {
+		mediatype = mediatype[:i]
+	}
+	mediatype = strings.TrimSpace(mediatype)
+	if mediatype == ctAppOctetStream {
+		return ""
+	}
+	return mediatype
+}
+
+// streamContent passes the decoded content reader to the Parser.StreamContent callback, then
+// discards whatever remains of the raw input r.
+func (p *Part) streamContent(contentReader, r io.Reader) error {
+	p.Utf8Reader = contentReader
+	err := p.parser.StreamContent(p)
+	p.Utf8Reader = nil
+	p.decodedReader = nil
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(ioutil.Discard, r); err != nil {
+		if err != io.ErrUnexpectedEOF {
+			return err
+		}
+		p.addWarning(ErrorUnexpectedEOF, "Content ended before the closing boundary was found")
+	}
+	return nil
+}
+
+// summarizeDecoding adds warnings for problems encountered by the transfer decoders, which are
+// available once the content has been read.  Any of the decoders may be nil.
+func (p *Part) summarizeDecoding(
+	qpcleaner *coding.QPCleaner,
+	b64cleaner *coding.Base64Cleaner,
+	uudecoder *coding.UUDecoder) {
+	if qpcleaner != nil && qpcleaner.InvalidEscapes > 0 {
+		p.addWarning(
+			ErrorContentEncoding,
+			"Quoted-printable content was malformed: %v invalid escape sequences passed through",
+			qpcleaner.InvalidEscapes)
+	}
 	if b64cleaner != nil {
-		for _, err := range b64cleaner.Errors {
-			p.Errors = append(p.Errors, Error{
-				Name:   ErrorMalformedBase64,
-				Detail: err.Error(),
-				Severe: false,
-			})
+		// Summarize non-conformant input, decoding was best-effort
+		var anomalies []string
+		if n := b64cleaner.IllegalChars; n > 0 {
+			anomalies = append(anomalies, fmt.Sprintf("%v illegal characters skipped", n))
+		}
+		if n := b64cleaner.LongLines; n > 0 {
+			anomalies = append(anomalies, fmt.Sprintf("%v lines longer than 76 characters", n))
+		}
+		if b64cleaner.MissingPadding() {
+			anomalies = append(anomalies, "missing padding")
+		}
+		if len(anomalies) > 0 {
+			p.addWarning(
+				ErrorMalformedBase64,
+				"Base64 content was malformed: %v",
+				strings.Join(anomalies, ", "))
+		}
+	}
+	if uudecoder != nil {
+		if p.FileName == "" {
+			p.FileName = uudecoder.FileName
+		}
+		for _, err := range uudecoder.Errors {
+			p.addWarning(ErrorContentEncoding, "%v", err)
 		}
 	}
-	return err
+}
+
+// summarizeDecompression adds a warning if Content-Encoding decompression failed.
+func (p *Part) summarizeDecompression(decompressor *coding.Decompressor) {
+	if decompressor != nil && decompressor.Err != nil {
+		p.addWarning(
+			ErrorContentEncoding,
+			"Failed to decompress %v content: %v",
+			p.Header.Get(hnHTTPContentEncoding),
+			decompressor.Err)
+	}
+}
+
+// checkTransferEncoding adds a warning if the raw content contains bytes not permitted by the
+// declared 7bit or 8bit Content-Transfer-Encoding.
+func (p *Part) checkTransferEncoding(cte string) {
+	var high, nul int
+	for _, b := range p.rawContent {
+		switch {
+		case b == 0:
+			nul++
+		case b > 127:
+			high++
+		}
+	}
+	if cte == cte7Bit && high > 0 {
+		p.addWarning(
+			ErrorContentEncoding,
+			"Content declared as 7bit contains %v bytes above 127",
+			high)
+	}
+	if nul > 0 {
+		p.addWarning(
+			ErrorContentEncoding,
+			"Content declared as %v contains %v NUL bytes",
+			cte, nul)
+	}
 }
 
 // ReadParts reads a MIME document from the provided reader and parses it into tree of Part objects.
 func ReadParts(r io.Reader) (*Part, error) {
-	br := bufio.NewReader(r)
-	root := &Part{PartID: "0"}
+	return defaultParser.ReadParts(r)
+}
+
+// ReadPartsBytes parses the MIME document held in b into a tree of Part objects, see ReadParts.
+func ReadPartsBytes(b []byte) (*Part, error) {
+	return defaultParser.ReadPartsBytes(b)
+}
+
+// ReadPartsBytes parses the MIME document held in b into a tree of Part objects, using the options
+// configured on the Parser, see ReadParts.
+func (p *Parser) ReadPartsBytes(b []byte) (*Part, error) {
+	return p.ReadParts(bytes.NewReader(b))
+}
+
+// ReadParts reads a MIME document from the provided reader and parses it into tree of Part objects,
+// using the options configured on the Parser.  Errors that prevent parsing are returned as a
+// *ParseError.
+func (p *Parser) ReadParts(r io.Reader) (*Part, error) {
+	start := time.Now()
+	var limiter *sizeLimitReader
+	if p.MaxBodySize > 0 {
+		limiter = &sizeLimitReader{r: r, n: p.MaxBodySize}
+		r = limiter
+	}
+	endings := &lineEndingReader{r: r}
+	br := bufio.NewReader(endings)
+	// Parts share a copy of the Parser, which counts them for this message alone
+	state := *p
+	state.partCount = 0
+	state.countPart()
+	root := &Part{PartID: "0", parser: &state}
+	err := parseMessage(root, br, 0)
+	if err == errMaxParts {
+		// Recorded on root
+		err = nil
+	}
+	root.setLineEnding(endings)
+	if limiter != nil && limiter.exceeded {
+		// The limit may surface as a different error, or none at all if it was hit while
+		// discarding content; return what was parsed so that headers may be salvaged.
+		err = ErrMessageTooLarge
+	} else if err != nil {
+		root = nil
+	}
+	if p.Observer != nil {
+		stats := ParseStats{Duration: time.Since(start), BytesRead: endings.n, Err: err}
+		if root != nil {
+			stats.Parts = root.CountDescendants() + 1
+			stats.MaxDepth = root.Depth()
+			stats.Errors = len(root.AllErrors())
+		}
+		p.Observer.Done(stats)
+	}
+	return root, err
+}
+
+// setLineEnding records the dominant line ending counted by endings on the root Part p, warning
+// if the message mixed CRLF and LF line endings.
+func (p *Part) setLineEnding(endings *lineEndingReader) {
+	switch {
+	case endings.crlf == 0 && endings.lf == 0:
+		return
+	case endings.crlf >= endings.lf:
+		p.LineEnding = "\r\n"
+	default:
+		p.LineEnding = "\n"
+	}
+	if endings.crlf > 0 && endings.lf > 0 {
+		p.addWarning(ErrorMixedLineEndings, "Message has %v CRLF and %v LF line endings, using %q",
+			endings.crlf, endings.lf, p.LineEnding)
+	}
+}
+
+// parseMessage reads the header and content of a message into root, which sits at the specified
+// nesting depth.
+func parseMessage(root *Part, br *bufio.Reader, depth int) error {
 	// Read header; top-level default CT is text/plain us-ascii according to RFC 822.
 	err := root.setupHeaders(br, `text/plain; charset="us-ascii"`)
 	if err != nil {
-		return nil, err
+		return parseError(StageHeader, "", err)
 	}
-	if strings.HasPrefix(root.ContentType, ctMultipartPrefix) {
+	root.headerParsed()
+	if strings.HasPrefix(root.ContentType, ctMultipartPrefix) && root.Boundary != "" {
 		// Content is multipart, parse it.
-		err = parseParts(root, br)
-		if err != nil {
-			return nil, err
-		}
+		err = parseParts(root, br, depth)
 	} else {
 		// Content is text or data, build content reader pipeline.
-		if err := root.buildContentReaders(br); err != nil {
-			return nil, err
+		err = parseError(StageContent, "", root.buildContentReaders(br))
+	}
+	if err == nil {
+		root.partParsed()
+	}
+	return err
+}
+
+// parseEncapsulated parses the content of a message/rfc822 Part at the specified nesting depth
+// into a child Part tree.  Problems are recorded as warnings on p.
+func (p *Part) parseEncapsulated(depth int) {
+	if p.parser.MaxDepth > 0 && depth+1 >= p.parser.MaxDepth {
+		p.addWarning(ErrorMaxDepth, "Encapsulated message exceeded maximum depth of %v",
+			p.parser.MaxDepth)
+		return
+	}
+	if !p.parser.countPart() {
+		p.maxPartsExceeded()
+		return
+	}
+	// Encapsulated multipart children are numbered from p, as in IMAP.
+	root := &Part{PartID: p.PartID, Encapsulated: true, parser: p.parser}
+	p.AddChild(root)
+	err := parseMessage(root, bufio.NewReader(bytes.NewReader(p.Content)), depth+1)
+	if err == errMaxParts {
+		// Keep the Parts parsed before the limit was reached
+		return
+	}
+	if err != nil {
+		p.FirstChild = nil
+		p.addWarning(ErrorMalformedHeader, "Failed to parse encapsulated message: %v", err)
+		return
+	}
+	if root.FirstChild == nil {
+		root.PartID += ".1"
+	}
+}
+
+// headerParsed calls Parser.OnPart for p, if set.
+func (p *Part) headerParsed() {
+	if p.parser.OnPart != nil {
+		p.parser.OnPart(p)
+	}
+}
+
+// partParsed calls Parser.Observer.PartParsed for p, if set.
+func (p *Part) partParsed() {
+	if p.parser.Observer != nil {
+		p.parser.Observer.PartParsed(p)
+	}
+}
+
+// maxPartsExceeded records that Parser.MaxParts stopped parsing on the root of the Part tree.
+func (p *Part) maxPartsExceeded() {
+	root := p
+	for root.Parent != nil {
+		root = root.Parent
+	}
+	for _, e := range root.Errors {
+		if e.Name == ErrorMaxParts {
+			return
+		}
+	}
+	root.addError(ErrorMaxParts, "Message exceeded maximum of %v parts, parsing stopped",
+		p.parser.MaxParts)
+}
+
+// decodeMultipart returns a reader for the body of multipart Part p, decoding the base64 or
+// quoted-printable Content-Transfer-Encoding some broken mail software applies to multipart
+// content, though RFC 2045 forbids it.  If decoding fails, the body is parsed as-is.
+func (p *Part) decodeMultipart(r *bufio.Reader) (*bufio.Reader, error) {
+	encoding := p.Header.Get(hnContentEncoding)
+	var newDecoder func(r io.Reader) io.Reader
+	switch parseTransferEncoding(encoding) {
+	case cteBase64, cteXBase64:
+		newDecoder = func(r io.Reader) io.Reader {
+			return base64.NewDecoder(base64.RawStdEncoding, coding.NewBase64Cleaner(r))
+		}
+	case cteQuotedPrintable, cteXQuotedPrintable:
+		newDecoder = func(r io.Reader) io.Reader {
+			return quotedprintable.NewReader(coding.NewQPCleaner(r))
 		}
+	default:
+		return r, nil
+	}
+	raw, err := ioutil.ReadAll(r)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	decoded, err := ioutil.ReadAll(newDecoder(bytes.NewReader(raw)))
+	if err != nil {
+		p.addWarning(
+			ErrorContentEncoding,
+			"Failed to decode multipart content with Content-Transfer-Encoding %q: %v",
+			encoding, err)
+		return bufio.NewReader(bytes.NewReader(raw)), nil
 	}
-	return root, nil
+	p.addWarning(
+		ErrorContentEncoding,
+		"Multipart content may not have Content-Transfer-Encoding %q, decoded it",
+		encoding)
+	return bufio.NewReader(bytes.NewReader(decoded)), nil
 }
 
-// parseParts recursively parses a MIME multipart document and sets each Parts PartID.
-func parseParts(parent *Part, reader *bufio.Reader) error {
+// parseParts recursively parses a MIME multipart document and sets each Parts PartID.  depth is
+// the number of multipart Parts enclosing parent.
+func parseParts(parent *Part, reader *bufio.Reader, depth int) error {
+	reader, err := parent.decodeMultipart(reader)
+	if err != nil {
+		return parseError(StageContent, parent.Boundary, err)
+	}
 	firstRecursion := parent.Parent == nil
+	// Parts of a digest are messages unless declared otherwise, RFC 2046 section 5.1.5.
+	defaultContentType := ""
+	if parent.ContentType == ctMultipartDigest {
+		defaultContentType = ctMessageRFC822
+	}
+	// Set once Parser.MaxParts has been reached, the remaining Parts are skipped
+	limited := false
 	// Loop over MIME boundaries.
 	br := newBoundaryReader(reader, parent.Boundary)
 	for indexPartID := 1; true; indexPartID++ {
 		next, err := br.Next()
+		if err == io.ErrUnexpectedEOF {
+			// Content ended before the closing boundary, either the input was truncated or this
+			// multipart was nested within another and never closed.  The last Part has been
+			// warned.
+			parent.addWarning(ErrorMissingBoundary, "Boundary %q was not closed correctly",
+				parent.Boundary)
+			break
+		}
 		if err != nil && err != io.EOF {
-			return err
+			return parseError(StageBoundary, parent.Boundary, err)
 		}
 		if !next {
 			break
 		}
-		p := &Part{}
+		if !parent.parser.countPart() {
+			// Keep reading to the closing boundary, so this multipart is completed as usual
+			parent.maxPartsExceeded()
+			limited = true
+			continue
+		}
+		p := &Part{parser: parent.parser}
 		// Set this Part's PartID, indicating its position within the MIME Part tree.
 		if firstRecursion {
 			p.PartID = strconv.Itoa(indexPartID)
 		} else {
 			p.PartID = parent.PartID + "." + strconv.Itoa(indexPartID)
 		}
+		var bbr *bufio.Reader
+		if indexPartID == 1 && parent.IsSigned() && parent.parser.StreamContent == nil {
+			// Retain the signed content exactly as it appeared for signature verification
+			raw, err := ioutil.ReadAll(br)
+			if err != nil && err != io.ErrUnexpectedEOF {
+				return parseError(StageContent, parent.Boundary, err)
+			}
+			p.rawEntity = raw
+			var rr io.Reader = bytes.NewReader(raw)
+			if err != nil {
+				// Let the Part be warned of the truncation as usual
+				rr = io.MultiReader(rr, &errorReader{err: err})
+			}
+			bbr = bufio.NewReader(rr)
+		} else {
+			bbr = bufio.NewReader(br)
+		}
 		// Look for part header.
-		bbr := bufio.NewReader(br)
-		err = p.setupHeaders(bbr, "")
+		err = p.setupHeaders(bbr, defaultContentType)
 		if err == errEmptyHeaderBlock {
 			// Empty header probably means the part didn't use the correct trailing "--" syntax to
 			// close its boundary.
@@ -287,30 +1305,50 @@ func parseParts(parent *Part, reader *bufio.Reader) error {
 						parent.Boundary)
 					break
 				}
-				return fmt.Errorf("error at boundary %v: %v", parent.Boundary, err)
+				return parseError(StageBoundary, parent.Boundary, err)
 			}
 		} else if err != nil {
-			return err
+			return parseError(StageHeader, parent.Boundary, err)
 		}
 		// Insert this Part into the MIME tree.
 		parent.AddChild(p)
+		p.headerParsed()
+		if p.Boundary != "" && p.parser.MaxDepth > 0 && depth+1 >= p.parser.MaxDepth {
+			// Stop descending; the nested multipart will be treated as data.
+			p.addWarning(ErrorMaxDepth, "Multipart nesting exceeded maximum depth of %v",
+				p.parser.MaxDepth)
+			p.Boundary = ""
+		}
 		if p.Boundary == "" {
 			// Content is text or data; build content reader pipeline.
 			if err := p.buildContentReaders(bbr); err != nil {
-				return err
+				return parseError(StageContent, parent.Boundary, err)
+			}
+			if p.ContentType == ctMessageRFC822 && p.parser.ParseEncapsulated && !p.streamed {
+				p.parseEncapsulated(depth + 1)
 			}
 		} else {
 			// Content is another multipart.
-			err = parseParts(p, bbr)
-			if err != nil {
+			err = parseParts(p, bbr, depth+1)
+			if err == errMaxParts {
+				limited = true
+			} else if err != nil {
 				return err
 			}
 		}
+		p.partParsed()
+	}
+	// Store any content preceding the first boundary marker into the preamble, less the line break
+	// that belongs to the boundary marker.
+	preamble := bytes.TrimSuffix(br.preamble, []byte("\n"))
+	preamble = bytes.TrimSuffix(preamble, []byte("\r"))
+	if len(preamble) > 0 {
+		parent.Preamble = preamble
 	}
 	// Store any content following the closing boundary marker into the epilogue.
 	epilogue, err := ioutil.ReadAll(reader)
-	if err != nil {
-		return err
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return parseError(StageContent, parent.Boundary, err)
 	}
 	parent.Epilogue = epilogue
 	// If a Part is "multipart/" Content-Type, it will have .0 appended to its PartID
@@ -318,5 +1356,17 @@ func parseParts(parent *Part, reader *bufio.Reader) error {
 	if !firstRecursion {
 		parent.PartID += ".0"
 	}
+	if limited {
+		return errMaxParts
+	}
 	return nil
 }
+
+// errorReader returns err from every Read.
+type errorReader struct {
+	err error
+}
+
+func (r *errorReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -1,7 +1,16 @@
 package enmime_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/jhillyerd/enmime"
 	"github.com/jhillyerd/enmime/internal/test"
@@ -724,3 +733,2722 @@ func TestBadBoundaryTerm(t *testing.T) {
 	want = "An HTML section"
 	test.ContentContainsString(t, p.Content, want)
 }
+
+func TestBoundaryQuotes(t *testing.T) {
+	r := test.OpenTestData("parts", "boundary-quotes.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	if got, want := p.Boundary, "----=_Part_0_12345"; got != want {
+		t.Errorf("Boundary got: %q, want: %q", got, want)
+	}
+	want := "[W] Malformed Content-Type: Boundary \"\\\"----=_Part_0_12345\\\" \" was malformed, " +
+		"using \"----=_Part_0_12345\""
+	if len(p.Errors) != 1 || p.Errors[0].String() != want {
+		t.Errorf("Errors got: %v, want: %v", p.Errors, want)
+	}
+
+	p = p.FirstChild
+	if p == nil {
+		t.Fatal("Part 1 should exist")
+	}
+	test.ContentEqualsString(t, p.Content, "First part")
+	p = p.NextSibling
+	if p == nil {
+		t.Fatal("Part 2 should exist")
+	}
+	test.ContentEqualsString(t, p.Content, "Second part")
+}
+
+func TestContentTypeParams(t *testing.T) {
+	r := test.OpenTestData("parts", "textplain-flowed.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	if p == nil {
+		t.Fatal("Root node should not be nil")
+	}
+
+	want := map[string]string{
+		"charset": "us-ascii",
+		"format":  "Flowed",
+		"delsp":   "no",
+	}
+	for k, v := range want {
+		if got := p.ContentTypeParams[k]; got != v {
+			t.Errorf("ContentTypeParams[%q] got: %q, want: %q", k, got, v)
+		}
+	}
+	if len(p.ContentTypeParams) != len(want) {
+		t.Errorf("len(ContentTypeParams) got: %v, want: %v", len(p.ContentTypeParams), len(want))
+	}
+}
+
+func TestDispositionParams(t *testing.T) {
+	r := test.OpenTestData("parts", "disposition-params.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	p = p.FirstChild
+
+	want := map[string]string{
+		"filename":          "report.bin",
+		"size":              "4",
+		"creation-date":     "Thu, 18 Oct 2012 22:48:39 -0700",
+		"modification-date": "Fri, 19 Oct 2012 08:15:00 +0000",
+		"read-date":         "not a date",
+	}
+	for k, v := range want {
+		if got := p.DispositionParams[k]; got != v {
+			t.Errorf("DispositionParams[%q] got: %q, want: %q", k, got, v)
+		}
+	}
+	if len(p.DispositionParams) != len(want) {
+		t.Errorf("len(DispositionParams) got: %v, want: %v", len(p.DispositionParams), len(want))
+	}
+
+	dates := []struct {
+		name string
+		want time.Time
+	}{
+		{"creation-date", time.Date(2012, 10, 19, 5, 48, 39, 0, time.UTC)},
+		{"Modification-Date", time.Date(2012, 10, 19, 8, 15, 0, 0, time.UTC)},
+	}
+	for _, d := range dates {
+		got, err := p.DispositionDate(d.name)
+		if err != nil {
+			t.Errorf("DispositionDate(%q) returned error: %v", d.name, err)
+			continue
+		}
+		if !got.Equal(d.want) {
+			t.Errorf("DispositionDate(%q) got: %v, want: %v", d.name, got, d.want)
+		}
+	}
+	for _, name := range []string{"read-date", "size", "missing-date"} {
+		if _, err := p.DispositionDate(name); err == nil {
+			t.Errorf("DispositionDate(%q) should have returned an error", name)
+		}
+	}
+}
+
+func TestRFC2231FileNames(t *testing.T) {
+	r := test.OpenTestData("parts", "attach-rfc2231.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	if p == nil {
+		t.Fatal("Root node should not be nil")
+	}
+
+	p = p.FirstChild.NextSibling
+	want := "日本語テスト.txt"
+	if p.FileName != want {
+		t.Errorf("FileName got: %q, want: %q", p.FileName, want)
+	}
+
+	p = p.NextSibling
+	want = "日本語.txt"
+	if p.FileName != want {
+		t.Errorf("FileName got: %q, want: %q", p.FileName, want)
+	}
+}
+
+func TestFlowedTextPart(t *testing.T) {
+	r := test.OpenTestData("parts", "textplain-flowed.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	if p == nil {
+		t.Fatal("Root node should not be nil")
+	}
+
+	want := "This paragraph is long enough that the sending client decided to wrap it at the " +
+		"seventy-eighth column, leaving a trailing space at the soft break.\r\n" +
+		"> A quoted line that was also wrapped by the sender.\r\n" +
+		"Plain fixed line.\r\n" +
+		"\r\n" +
+		"-- \r\n" +
+		"Signature line\r\n"
+	test.ContentEqualsString(t, p.Content, want)
+}
+
+func TestUUEncodedPart(t *testing.T) {
+	r := test.OpenTestData("parts", "uuencode.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	if p == nil {
+		t.Fatal("Root node should not be nil")
+	}
+
+	wantp := &enmime.Part{
+		ContentType: "application/octet-stream",
+		FileName:    "hello.txt",
+		PartID:      "0",
+	}
+	test.ComparePart(t, p, wantp)
+
+	test.ContentEqualsString(t, p.Content, "Hello, World!")
+	for _, e := range p.Errors {
+		t.Error(e.String())
+	}
+}
+
+func TestDetectMissingCharset(t *testing.T) {
+	r := test.OpenTestData("parts", "missing-charset.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	wantp := &enmime.Part{
+		ContentType: "text/plain",
+		Charset:     "windows-1252",
+		PartID:      "0",
+	}
+	test.ComparePart(t, p, wantp)
+
+	test.ContentEqualsString(t, p.Content, "Café crème\r\n")
+	if len(p.Errors) != 1 || p.Errors[0].Name != enmime.ErrorCharsetDeclaration {
+		t.Errorf("Errors got: %v, want a single %q warning", p.Errors, enmime.ErrorCharsetDeclaration)
+	}
+}
+
+func TestDetectMissingCharsetDisabled(t *testing.T) {
+	r := test.OpenTestData("parts", "missing-charset.raw")
+	parser := enmime.NewParser()
+	parser.DetectCharset = false
+	p, err := parser.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	wantp := &enmime.Part{
+		ContentType: "text/plain",
+		PartID:      "0",
+	}
+	test.ComparePart(t, p, wantp)
+
+	test.ContentEqualsString(t, p.Content, "Caf\xe9 cr\xe8me\r\n")
+	if len(p.Errors) != 0 {
+		t.Errorf("Errors got: %v, want none", p.Errors)
+	}
+}
+
+func TestDefaultCharset(t *testing.T) {
+	r := test.OpenTestData("parts", "missing-charset.raw")
+	parser := enmime.NewParser()
+	parser.DefaultCharset = "iso-8859-1"
+	p, err := parser.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	// The default takes precedence over detection, which would choose windows-1252
+	wantp := &enmime.Part{
+		ContentType: "text/plain",
+		Charset:     "iso-8859-1",
+		PartID:      "0",
+	}
+	test.ComparePart(t, p, wantp)
+
+	test.ContentEqualsString(t, p.Content, "Café crème\r\n")
+	if len(p.Errors) != 0 {
+		t.Errorf("Errors got: %v, want none", p.Errors)
+	}
+
+	// A declared charset is used as is
+	r = strings.NewReader("Content-Type: text/plain; charset=utf-8\r\n\r\nCaf\u00e9\r\n")
+	p, err = parser.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	if p.Charset != "utf-8" {
+		t.Errorf("Charset got: %q, want: %q", p.Charset, "utf-8")
+	}
+	test.ContentEqualsString(t, p.Content, "Café\r\n")
+}
+
+// nestedMultipart builds a message with depth levels of nested multipart/mixed parts
+func nestedMultipart(depth int) string {
+	msg := "Content-Type: text/plain\r\n\r\nInnermost\r\n"
+	for i := depth; i > 0; i-- {
+		b := fmt.Sprintf("level-%d", i)
+		msg = "Content-Type: multipart/mixed; boundary=" + b + "\r\n\r\n" +
+			"--" + b + "\r\n" + msg + "--" + b + "--\r\n"
+	}
+	return msg
+}
+
+func TestMaxDepth(t *testing.T) {
+	parser := enmime.NewParser()
+	parser.MaxDepth = 3
+	root, err := parser.ReadParts(strings.NewReader(nestedMultipart(5)))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	// Levels 1 through 3 are parsed, level 4 becomes data.
+	p := root.FirstChild.FirstChild.FirstChild
+	wantp := &enmime.Part{
+		Parent:      test.PartExists,
+		ContentType: "multipart/mixed",
+		PartID:      "1.1.1",
+	}
+	test.ComparePart(t, p, wantp)
+	test.ContentContainsString(t, p.Content, "Innermost")
+	if len(p.Errors) != 1 || p.Errors[0].Name != enmime.ErrorMaxDepth {
+		t.Errorf("Errors got: %v, want a single %q warning", p.Errors, enmime.ErrorMaxDepth)
+	}
+}
+
+func TestMaxDepthDefault(t *testing.T) {
+	root, err := enmime.ReadParts(strings.NewReader(nestedMultipart(1000)))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	p := root.DepthMatchFirst(func(p *enmime.Part) bool {
+		return len(p.Errors) > 0
+	})
+	if p == nil || p.Errors[0].Name != enmime.ErrorMaxDepth {
+		t.Errorf("Expected a part with a %q warning", enmime.ErrorMaxDepth)
+	}
+}
+
+func TestRawContent(t *testing.T) {
+	r := test.OpenTestData("parts", "multibase64.raw")
+	root, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	raw, err := root.RawContent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw != nil {
+		t.Errorf("Multipart RawContent got: %q, want nil", raw)
+	}
+
+	p := root.FirstChild.NextSibling
+	raw, err = p.RawContent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ContentEqualsString(t, raw, "PGh0bWw+Cg==\n")
+	test.ContentEqualsString(t, p.Content, "<html>\n")
+}
+
+func TestBase64PlainTextPart(t *testing.T) {
+	r := test.OpenTestData("parts", "base64-plaintext.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	test.ContentEqualsString(t, p.Content, "This was not encoded\r\n")
+	if len(p.Errors) != 1 || p.Errors[0].Name != enmime.ErrorMalformedBase64 {
+		t.Errorf("Errors got: %v, want a single %q warning", p.Errors, enmime.ErrorMalformedBase64)
+	}
+}
+
+func TestBase64AnomaliesPart(t *testing.T) {
+	r := test.OpenTestData("parts", "base64-anomalies.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	want := "This base64 content was written on a single long line and lost its padding"
+	test.ContentEqualsString(t, p.Content, want)
+	if len(p.Errors) != 1 || p.Errors[0].Name != enmime.ErrorMalformedBase64 {
+		t.Fatalf("Errors got: %v, want a single %q warning", p.Errors, enmime.ErrorMalformedBase64)
+	}
+	want = "1 illegal characters skipped, 1 lines longer than 76 characters, missing padding"
+	if !strings.Contains(p.Errors[0].Detail, want) {
+		t.Errorf("Detail got: %q, want it to contain: %q", p.Errors[0].Detail, want)
+	}
+}
+
+func TestValidateTransferEncoding(t *testing.T) {
+	r := test.OpenTestData("parts", "7bit-violation.raw")
+	parser := enmime.NewParser()
+	parser.ValidateTransferEncoding = true
+	p, err := parser.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	test.ContentEqualsString(t, p.Content, "Café crème \x00\r\n")
+	want := []string{
+		"Content declared as 7bit contains 2 bytes above 127",
+		"Content declared as 7bit contains 1 NUL bytes",
+	}
+	if len(p.Errors) != len(want) {
+		t.Fatalf("Errors got: %v, want %v warnings", p.Errors, len(want))
+	}
+	for i, w := range want {
+		if p.Errors[i].Name != enmime.ErrorContentEncoding || p.Errors[i].Detail != w {
+			t.Errorf("Errors[%v] got: %v, want: %q", i, p.Errors[i], w)
+		}
+	}
+}
+
+func TestValidateTransferEncodingDefault(t *testing.T) {
+	r := test.OpenTestData("parts", "7bit-violation.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	if len(p.Errors) != 0 {
+		t.Errorf("Errors got: %v, want none", p.Errors)
+	}
+}
+
+func TestClone(t *testing.T) {
+	r := test.OpenTestData("parts", "nestedmulti.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	// Consume some of the original content
+	orig := p.FirstChild.NextSibling.FirstChild
+	if _, err := orig.Read(make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+
+	c := p.Clone()
+	if c == p {
+		t.Fatal("Clone returned the original")
+	}
+
+	// Compare tree structure and parent pointers
+	var walk func(o, c, parent *enmime.Part)
+	walk = func(o, c, parent *enmime.Part) {
+		for ; o != nil; o, c = o.NextSibling, c.NextSibling {
+			if c == nil {
+				t.Fatalf("Clone missing part %v", o.PartID)
+			}
+			if c == o {
+				t.Fatalf("Clone of part %v is the original", o.PartID)
+			}
+			if c.Parent != parent {
+				t.Errorf("Clone of part %v has Parent %p, want %p", o.PartID, c.Parent, parent)
+			}
+			if c.PartID != o.PartID || c.ContentType != o.ContentType || c.Charset != o.Charset {
+				t.Errorf("Clone of part %v does not match original", o.PartID)
+			}
+			test.ContentEqualsBytes(t, c.Content, o.Content)
+			walk(o.FirstChild, c.FirstChild, c)
+		}
+		if c != nil {
+			t.Errorf("Clone has extra part %v", c.PartID)
+		}
+	}
+	walk(p, c, nil)
+
+	// Clone reader should start from the beginning
+	cloned := c.FirstChild.NextSibling.FirstChild
+	content, err := ioutil.ReadAll(cloned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ContentEqualsBytes(t, content, orig.Content)
+
+	// Modifying the clone must not affect the original
+	cloned.Header.Set("X-Redacted", "yes")
+	cloned.Content[0] = 'X'
+	cloned.FileName = "redacted.txt"
+	if orig.Header.Get("X-Redacted") != "" {
+		t.Error("Header modification leaked into original")
+	}
+	if orig.Content[0] == 'X' {
+		t.Error("Content modification leaked into original")
+	}
+	if orig.FileName == "redacted.txt" {
+		t.Error("FileName modification leaked into original")
+	}
+}
+
+func TestCloneNil(t *testing.T) {
+	var p *enmime.Part
+	if c := p.Clone(); c != nil {
+		t.Errorf("Clone of nil got: %v, want nil", c)
+	}
+}
+
+// replaceTestTree builds a multipart root with children named a, b and c, where b has a child
+// named b1.  Parts are named by FileName.
+func replaceTestTree() (root, a, b, c, b1 *enmime.Part) {
+	root = enmime.NewPart(nil, "multipart/mixed")
+	a = &enmime.Part{FileName: "a"}
+	b = &enmime.Part{FileName: "b"}
+	c = &enmime.Part{FileName: "c"}
+	b1 = &enmime.Part{FileName: "b1"}
+	root.AddChild(a)
+	root.AddChild(b)
+	root.AddChild(c)
+	b.AddChild(b1)
+	return
+}
+
+// childNames returns the FileNames of the children of p, checking their Parent pointers.
+func childNames(t *testing.T, p *enmime.Part) string {
+	t.Helper()
+	var names []string
+	for c := p.FirstChild; c != nil; c = c.NextSibling {
+		if c.Parent != p {
+			t.Errorf("Part %q Parent got: %p, want: %p", c.FileName, c.Parent, p)
+		}
+		names = append(names, c.FileName)
+	}
+	return strings.Join(names, " ")
+}
+
+func TestPartReplace(t *testing.T) {
+	ttable := []struct {
+		name   string
+		target func(a, b, c *enmime.Part) *enmime.Part
+		want   string
+	}{
+		{"first", func(a, b, c *enmime.Part) *enmime.Part { return a }, "new b c"},
+		{"middle", func(a, b, c *enmime.Part) *enmime.Part { return b }, "a new c"},
+		{"last", func(a, b, c *enmime.Part) *enmime.Part { return c }, "a b new"},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			root, a, b, c, _ := replaceTestTree()
+			newPart := &enmime.Part{FileName: "new"}
+			newPart.AddChild(&enmime.Part{FileName: "new1"})
+			old := tt.target(a, b, c)
+			old.Replace(newPart)
+			if got := childNames(t, root); got != tt.want {
+				t.Errorf("children got: %q, want: %q", got, tt.want)
+			}
+			if got := childNames(t, newPart); got != "new1" {
+				t.Errorf("new children got: %q, want: %q", got, "new1")
+			}
+			if old.Parent != nil || old.NextSibling != nil {
+				t.Errorf("replaced Part was not detached")
+			}
+		})
+	}
+
+	// A Part already in the tree is moved
+	root, a, b, c, b1 := replaceTestTree()
+	a.Replace(c)
+	if got := childNames(t, root); got != "c b" {
+		t.Errorf("children got: %q, want: %q", got, "c b")
+	}
+	b.Replace(b1)
+	if got := childNames(t, root); got != "c b1" {
+		t.Errorf("children got: %q, want: %q", got, "c b1")
+	}
+
+	// Replacing with nil removes
+	c.Replace(nil)
+	if got := childNames(t, root); got != "b1" {
+		t.Errorf("children got: %q, want: %q", got, "b1")
+	}
+
+	var p *enmime.Part
+	p.Replace(a)
+}
+
+func TestPartRemove(t *testing.T) {
+	root, a, b, c, b1 := replaceTestTree()
+	b.Remove()
+	if got := childNames(t, root); got != "a c" {
+		t.Errorf("children got: %q, want: %q", got, "a c")
+	}
+	if b.Parent != nil || b.NextSibling != nil {
+		t.Error("removed Part was not detached")
+	}
+	if got := childNames(t, b); got != "b1" {
+		t.Errorf("removed Part children got: %q, want: %q", got, "b1")
+	}
+	a.Remove()
+	c.Remove()
+	if root.FirstChild != nil {
+		t.Errorf("FirstChild got: %v, want nil", root.FirstChild)
+	}
+
+	// Detached Parts may be removed again
+	b1.Remove()
+	b1.Remove()
+	if b.FirstChild != nil {
+		t.Errorf("FirstChild got: %v, want nil", b.FirstChild)
+	}
+
+	var p *enmime.Part
+	p.Remove()
+}
+
+func TestPartString(t *testing.T) {
+	r := test.OpenTestData("parts", "nestedmulti.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	p.FirstChild.Errors = append(p.FirstChild.Errors, enmime.Error{
+		Name:   "Test Warning",
+		Detail: "Test detail",
+	})
+
+	want := `0 multipart/alternative len=0
+  1 text/plain charset=us-ascii len=14
+    [W] Test Warning: Test detail
+  2.0 multipart/related len=0
+    2.1 text/html charset=us-ascii len=15
+    2.2 text/plain disposition=inline filename="attach.txt" len=25
+    2.3 text/plain disposition=inline filename="attach2.txt" len=30
+`
+	if got := p.String(); got != want {
+		t.Errorf("String() got:\n%s\nwant:\n%s", got, want)
+	}
+
+	var nilPart *enmime.Part
+	if got := nilPart.String(); got != "<nil>" {
+		t.Errorf("String() on nil got: %q, want: %q", got, "<nil>")
+	}
+}
+
+func TestLenientParsing(t *testing.T) {
+	r := test.OpenTestData("parts", "bad-ctype.raw")
+	_, err := enmime.ReadParts(r)
+	if err == nil {
+		t.Fatal("Expected parse error without LenientParsing")
+	}
+
+	r = test.OpenTestData("parts", "bad-ctype.raw")
+	parser := enmime.NewParser()
+	parser.LenientParsing = true
+	p, err := parser.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	p = p.FirstChild
+	wantp := &enmime.Part{
+		Parent:      test.PartExists,
+		NextSibling: test.PartExists,
+		ContentType: "text/plain",
+		Charset:     "us-ascii",
+		PartID:      "1",
+	}
+	test.ComparePart(t, p, wantp)
+	test.ContentEqualsString(t, p.Content, "First part")
+
+	p = p.NextSibling
+	wantp = &enmime.Part{
+		Parent:      test.PartExists,
+		NextSibling: test.PartExists,
+		PartID:      "2",
+	}
+	test.ComparePart(t, p, wantp)
+	test.ContentEqualsString(t, p.Content, "Second part")
+	if len(p.Errors) != 1 || p.Errors[0].Name != enmime.ErrorMalformedContentType || !p.Errors[0].Severe {
+		t.Errorf("Errors got: %v, want a single severe %q error", p.Errors, enmime.ErrorMalformedContentType)
+	}
+
+	p = p.NextSibling
+	wantp = &enmime.Part{
+		Parent:      test.PartExists,
+		ContentType: "text/plain",
+		Charset:     "us-ascii",
+		PartID:      "3",
+	}
+	test.ComparePart(t, p, wantp)
+	test.ContentEqualsString(t, p.Content, "Third part")
+}
+
+func TestLenientParsingJunkHeader(t *testing.T) {
+	r := test.OpenTestData("parts", "junk-header.raw")
+	_, err := enmime.ReadParts(r)
+	if err == nil {
+		t.Fatal("Expected parse error without LenientParsing")
+	}
+
+	r = test.OpenTestData("parts", "junk-header.raw")
+	parser := enmime.NewParser()
+	parser.LenientParsing = true
+	p, err := parser.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	wantp := &enmime.Part{
+		ContentType: "text/plain",
+		Charset:     "us-ascii",
+		PartID:      "0",
+	}
+	test.ComparePart(t, p, wantp)
+	test.ContentEqualsString(t, p.Content, "Body text\r\n")
+
+	wantHeaders := map[string]string{
+		"From":    "Sender <sender@example.com>",
+		"Subject": "Junk header",
+		"X-Spam":  "5",
+		"X-Junk":  "",
+	}
+	for k, want := range wantHeaders {
+		if got := p.Header.Get(k); got != want {
+			t.Errorf("Header %q got: %q, want: %q", k, got, want)
+		}
+	}
+
+	if len(p.Errors) != 2 {
+		t.Fatalf("len(p.Errors) == %v, want: 2: %v", len(p.Errors), p.Errors)
+	}
+	for _, e := range p.Errors {
+		if e.Name != enmime.ErrorMalformedHeader || e.Severe {
+			t.Errorf("Error got: %v, want a %q warning", e, enmime.ErrorMalformedHeader)
+		}
+	}
+}
+
+func TestTruncatedNestedPart(t *testing.T) {
+	r := test.OpenTestData("parts", "truncated-nested.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	p = p.FirstChild.FirstChild.NextSibling
+	wantp := &enmime.Part{
+		Parent:      test.PartExists,
+		ContentType: "text/html",
+		Charset:     "us-ascii",
+		PartID:      "1.2",
+	}
+	test.ComparePart(t, p, wantp)
+	test.ContentEqualsString(t, p.Content, "An HTML section that was cut short\r\n")
+	if len(p.Errors) != 1 || p.Errors[0].Name != enmime.ErrorUnexpectedEOF {
+		t.Errorf("Errors got: %v, want a single %q warning", p.Errors, enmime.ErrorUnexpectedEOF)
+	}
+}
+
+func TestContentInCharset(t *testing.T) {
+	r := test.OpenTestData("parts", "missing-charset.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	got, err := p.ContentInCharset(p.Charset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	test.ContentEqualsString(t, got, "Caf\xe9 cr\xe8me\r\n")
+
+	if _, err = p.ContentInCharset("INVALIDcharsetZZZ"); err == nil {
+		t.Error("Unsupported charset should return an error")
+	}
+}
+
+func TestEncapsulatedMessage(t *testing.T) {
+	r := test.OpenTestData("mail", "attached-message.raw")
+	parser := enmime.NewParser()
+	parser.ParseEncapsulated = true
+	p, err := parser.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	p = p.FirstChild.NextSibling
+	wantp := &enmime.Part{
+		Parent:      test.PartExists,
+		FirstChild:  test.PartExists,
+		ContentType: "message/rfc822",
+		Disposition: "attachment",
+		FileName:    "inner.eml",
+		PartID:      "2",
+	}
+	test.ComparePart(t, p, wantp)
+	test.ContentContainsString(t, p.Content, "Subject: Inner message")
+
+	p = p.FirstChild
+	wantp = &enmime.Part{
+		Parent:       test.PartExists,
+		FirstChild:   test.PartExists,
+		ContentType:  "multipart/mixed",
+		PartID:       "2.0",
+		Encapsulated: true,
+	}
+	test.ComparePart(t, p, wantp)
+	if got, want := p.Header.Get("Subject"), "Inner message"; got != want {
+		t.Errorf("Subject got: %q, want: %q", got, want)
+	}
+
+	p = p.FirstChild
+	wantp = &enmime.Part{
+		Parent:      test.PartExists,
+		NextSibling: test.PartExists,
+		ContentType: "text/plain",
+		Charset:     "us-ascii",
+		PartID:      "2.1",
+	}
+	test.ComparePart(t, p, wantp)
+	test.ContentEqualsString(t, p.Content, "Inner text section")
+
+	p = p.NextSibling
+	wantp = &enmime.Part{
+		Parent:      test.PartExists,
+		ContentType: "application/octet-stream",
+		Disposition: "attachment",
+		FileName:    "inner.bin",
+		PartID:      "2.2",
+	}
+	test.ComparePart(t, p, wantp)
+	test.ContentEqualsString(t, p.Content, "Inner attachment")
+}
+
+func TestEncapsulatedMessageDefault(t *testing.T) {
+	r := test.OpenTestData("mail", "attached-message.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	p = p.FirstChild.NextSibling
+	if p.FirstChild != nil {
+		t.Errorf("message/rfc822 FirstChild got: %v, want nil", p.FirstChild)
+	}
+}
+
+func TestEncapsulatedMessageMaxDepth(t *testing.T) {
+	r := test.OpenTestData("mail", "attached-message.raw")
+	parser := enmime.NewParser()
+	parser.ParseEncapsulated = true
+	parser.MaxDepth = 2
+	p, err := parser.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	p = p.FirstChild.NextSibling
+	if p.FirstChild != nil {
+		t.Errorf("message/rfc822 FirstChild got: %v, want nil", p.FirstChild)
+	}
+	if len(p.Errors) != 1 || p.Errors[0].Name != enmime.ErrorMaxDepth {
+		t.Errorf("Errors got: %v, want a single %q warning", p.Errors, enmime.ErrorMaxDepth)
+	}
+}
+
+func TestContentLength(t *testing.T) {
+	r := test.OpenTestData("parts", "multibase64.raw")
+	root, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	if got := root.ContentLength(); got != 0 {
+		t.Errorf("Multipart ContentLength got: %v, want: 0", got)
+	}
+
+	p := root.FirstChild.NextSibling
+	if got, want := p.ContentLength(), len("<html>\n"); got != want {
+		t.Errorf("ContentLength got: %v, want: %v", got, want)
+	}
+	raw, _ := p.RawContent()
+	if len(raw) == p.ContentLength() {
+		t.Errorf("Raw length should differ from decoded length, both: %v", len(raw))
+	}
+}
+
+func TestUnclosedInnerBoundary(t *testing.T) {
+	r := test.OpenTestData("parts", "unclosed-inner.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	wantp := &enmime.Part{
+		FirstChild:  test.PartExists,
+		ContentType: "multipart/mixed",
+		PartID:      "0",
+	}
+	test.ComparePart(t, p, wantp)
+	if len(p.Errors) != 0 {
+		t.Errorf("Root Errors got: %v, want none", p.Errors)
+	}
+
+	// Unclosed multipart should be warned
+	p = p.FirstChild
+	wantp = &enmime.Part{
+		Parent:      test.PartExists,
+		FirstChild:  test.PartExists,
+		NextSibling: test.PartExists,
+		ContentType: "multipart/alternative",
+		PartID:      "1.0",
+	}
+	test.ComparePart(t, p, wantp)
+	if len(p.Errors) != 1 || p.Errors[0].Name != enmime.ErrorMissingBoundary {
+		t.Errorf("Errors got: %v, want a single %q warning", p.Errors, enmime.ErrorMissingBoundary)
+	}
+
+	p = p.FirstChild.NextSibling
+	wantp = &enmime.Part{
+		Parent:      test.PartExists,
+		ContentType: "text/html",
+		Charset:     "us-ascii",
+		PartID:      "1.2",
+	}
+	test.ComparePart(t, p, wantp)
+	test.ContentEqualsString(t, p.Content, "An HTML section")
+
+	// Attachment following the unclosed multipart should be intact
+	p = p.Parent.NextSibling
+	wantp = &enmime.Part{
+		Parent:      test.PartExists,
+		ContentType: "application/octet-stream",
+		Disposition: "attachment",
+		FileName:    "attach.bin",
+		PartID:      "2",
+	}
+	test.ComparePart(t, p, wantp)
+	test.ContentEqualsString(t, p.Content, "An attachment")
+	if len(p.Errors) != 0 {
+		t.Errorf("Attachment Errors got: %v, want none", p.Errors)
+	}
+}
+
+func TestTransferEncodingComment(t *testing.T) {
+	r := test.OpenTestData("parts", "base64-cte-comment.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	test.ContentEqualsString(t, p.Content, "Hello world")
+	if len(p.Errors) != 0 {
+		t.Errorf("Errors got: %v, want none", p.Errors)
+	}
+}
+
+func TestPartGetHeader(t *testing.T) {
+	p := &enmime.Part{}
+	if got := p.GetHeader("Subject"); got != "" {
+		t.Errorf("GetHeader on empty Part got: %q, want empty", got)
+	}
+
+	testCases := []struct {
+		value, want string
+	}{
+		{"Plain subject", "Plain subject"},
+		{"=?UTF-8?Q?Caf=C3=A9?=", "Café"},
+		{"=?UTF-8?Q?Caf=C3=A9?=\r\n =?UTF-8?Q?cr=C3=A8me?=", "Cafécrème"},
+		{"Folded\r\n\tsubject", "Folded\tsubject"},
+	}
+	for _, tc := range testCases {
+		p.SetHeader("Subject", tc.value)
+		if got := p.Header.Get("Subject"); got != tc.value {
+			t.Errorf("SetHeader stored: %q, want raw value: %q", got, tc.value)
+		}
+		if got := p.GetHeader("Subject"); got != tc.want {
+			t.Errorf("GetHeader got: %q, want: %q", got, tc.want)
+		}
+	}
+}
+
+func TestRegisterCharsetReader(t *testing.T) {
+	enmime.RegisterCharsetReader("X-Enmime-ROT13", func(r io.Reader) io.Reader {
+		b, _ := ioutil.ReadAll(r)
+		for i, c := range b {
+			switch {
+			case 'a' <= c && c <= 'z':
+				b[i] = 'a' + (c-'a'+13)%26
+			case 'A' <= c && c <= 'Z':
+				b[i] = 'A' + (c-'A'+13)%26
+			}
+		}
+		return bytes.NewReader(b)
+	})
+	defer enmime.RegisterCharsetReader("X-Enmime-ROT13", nil)
+
+	r := test.OpenTestData("parts", "custom-charset.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	test.ContentEqualsString(t, p.Content, "Hello world\r\n")
+	if len(p.Errors) != 0 {
+		t.Errorf("Errors got: %v, want none", p.Errors)
+	}
+
+	// Registered charsets also apply to encoded-words in headers
+	p.Header.Set("Subject", "=?X-Enmime-ROT13?B?VXJ5eWI=?= world")
+	if got, want := p.GetHeader("Subject"), "Hello world"; got != want {
+		t.Errorf("GetHeader got: %q, want: %q", got, want)
+	}
+}
+
+func TestCharsetAliases(t *testing.T) {
+	r := test.OpenTestData("parts", "charset-alias.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	wantp := &enmime.Part{
+		Parent:      test.PartExists,
+		NextSibling: test.PartExists,
+		ContentType: "text/plain",
+		Charset:     "utf-8",
+		PartID:      "1",
+	}
+	test.ComparePart(t, p.FirstChild, wantp)
+	test.ContentEqualsString(t, p.FirstChild.Content, "Café")
+
+	wantp = &enmime.Part{
+		Parent:      test.PartExists,
+		ContentType: "text/plain",
+		Charset:     "windows-1252",
+		PartID:      "2",
+	}
+	test.ComparePart(t, p.FirstChild.NextSibling, wantp)
+	test.ContentEqualsString(t, p.FirstChild.NextSibling.Content, "Pages 1–3")
+
+	for _, c := range []*enmime.Part{p.FirstChild, p.FirstChild.NextSibling} {
+		if len(c.Errors) != 0 {
+			t.Errorf("Part %s errors got: %v, want none", c.PartID, c.Errors)
+		}
+	}
+}
+
+func TestStreamContent(t *testing.T) {
+	// Parse normally for comparison
+	want, err := enmime.ReadParts(test.OpenTestData("parts", "nestedmulti.raw"))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	streamed := make(map[string]string)
+	parser := enmime.NewParser()
+	parser.StreamContent = func(p *enmime.Part) error {
+		b, err := ioutil.ReadAll(p)
+		if err != nil {
+			return err
+		}
+		streamed[p.PartID] = string(b)
+		return nil
+	}
+	root, err := parser.ReadParts(test.OpenTestData("parts", "nestedmulti.raw"))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	count := 0
+	_ = want.DepthMatchAll(func(wp *enmime.Part) bool {
+		if wp.FirstChild != nil {
+			return false
+		}
+		count++
+		got, ok := streamed[wp.PartID]
+		if !ok {
+			t.Errorf("Part %s was not streamed", wp.PartID)
+			return false
+		}
+		if got != string(wp.Content) {
+			t.Errorf("Part %s streamed content got: %q, want: %q", wp.PartID, got, wp.Content)
+		}
+		return false
+	})
+	if len(streamed) != count {
+		t.Errorf("Streamed %v parts, want: %v", len(streamed), count)
+	}
+
+	_ = root.DepthMatchAll(func(p *enmime.Part) bool {
+		if p.FirstChild != nil {
+			return false
+		}
+		if p.Content != nil {
+			t.Errorf("Part %s Content got: %q, want nil", p.PartID, p.Content)
+		}
+		if raw, _ := p.RawContent(); raw != nil {
+			t.Errorf("Part %s RawContent got: %q, want nil", p.PartID, raw)
+		}
+		if got := p.ContentLength(); got != -1 {
+			t.Errorf("Part %s ContentLength() got: %v, want: -1", p.PartID, got)
+		}
+		if n, err := p.Read(make([]byte, 10)); n != 0 || err != io.EOF {
+			t.Errorf("Part %s Read() got: %v, %v, want: 0, EOF", p.PartID, n, err)
+		}
+		return false
+	})
+}
+
+func TestStreamContentUnread(t *testing.T) {
+	var ids []string
+	parser := enmime.NewParser()
+	parser.StreamContent = func(p *enmime.Part) error {
+		// Unread content must be skipped
+		ids = append(ids, p.PartID)
+		return nil
+	}
+	root, err := parser.ReadParts(test.OpenTestData("parts", "multimixed.raw"))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	if got, want := strings.Join(ids, ","), "1,2"; got != want {
+		t.Errorf("Streamed parts got: %q, want: %q", got, want)
+	}
+	if root.FirstChild == nil || root.FirstChild.NextSibling == nil {
+		t.Fatal("Expected two child parts")
+	}
+	if got, want := root.FirstChild.NextSibling.PartID, "2"; got != want {
+		t.Errorf("Second part PartID got: %q, want: %q", got, want)
+	}
+}
+
+func TestStreamContentError(t *testing.T) {
+	errStop := fmt.Errorf("stop")
+	parser := enmime.NewParser()
+	parser.StreamContent = func(p *enmime.Part) error {
+		return errStop
+	}
+	_, err := parser.ReadParts(test.OpenTestData("parts", "multimixed.raw"))
+	perr, ok := err.(*enmime.ParseError)
+	if !ok {
+		t.Fatalf("ReadParts() error got: %#v, want: *ParseError", err)
+	}
+	if perr.Err != errStop {
+		t.Errorf("ParseError.Err got: %v, want: %v", perr.Err, errStop)
+	}
+}
+
+func TestStreamContentBase64Anomalies(t *testing.T) {
+	parser := enmime.NewParser()
+	var content []byte
+	parser.StreamContent = func(p *enmime.Part) error {
+		var err error
+		content, err = ioutil.ReadAll(p)
+		return err
+	}
+	p, err := parser.ReadParts(test.OpenTestData("parts", "base64-anomalies.raw"))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	want, err := enmime.ReadParts(test.OpenTestData("parts", "base64-anomalies.raw"))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	test.ContentEqualsBytes(t, content, want.Content)
+	if got, want := fmt.Sprint(p.Errors), fmt.Sprint(want.Errors); got != want {
+		t.Errorf("Errors got: %v, want: %v", got, want)
+	}
+}
+
+func TestDuplicateHeaders(t *testing.T) {
+	r := test.OpenTestData("parts", "duplicate-headers.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	// The first of each header is used
+	wantp := &enmime.Part{
+		Parent:      test.PartExists,
+		ContentType: "text/plain",
+		Charset:     "utf-8",
+		PartID:      "1",
+	}
+	test.ComparePart(t, p.FirstChild, wantp)
+	test.ContentEqualsString(t, p.FirstChild.Content, "Café")
+
+	want := []string{
+		`[W] Duplicate Header: Found 2 Content-Type headers, using the first: ` +
+			`"text/plain; charset=utf-8"`,
+		`[W] Duplicate Header: Found 2 Content-Transfer-Encoding headers, using the first: ` +
+			`"quoted-printable"`,
+	}
+	if len(p.FirstChild.Errors) != len(want) {
+		t.Fatalf("Errors got: %v, want: %v", p.FirstChild.Errors, want)
+	}
+	for i, w := range want {
+		if got := p.FirstChild.Errors[i].String(); got != w {
+			t.Errorf("Errors[%v] got: %q, want: %q", i, got, w)
+		}
+	}
+}
+
+func TestMultipartDigest(t *testing.T) {
+	r := test.OpenTestData("mail", "digest.raw")
+	parser := enmime.NewParser()
+	parser.ParseEncapsulated = true
+	p, err := parser.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	digest := p.FirstChild.NextSibling
+	wantp := &enmime.Part{
+		Parent:      test.PartExists,
+		FirstChild:  test.PartExists,
+		NextSibling: test.PartExists,
+		ContentType: "multipart/digest",
+		PartID:      "2.0",
+	}
+	test.ComparePart(t, digest, wantp)
+
+	// Parts without a Content-Type default to message/rfc822
+	p = digest.FirstChild
+	wantp = &enmime.Part{
+		Parent:      test.PartExists,
+		FirstChild:  test.PartExists,
+		NextSibling: test.PartExists,
+		ContentType: "message/rfc822",
+		PartID:      "2.1",
+	}
+	test.ComparePart(t, p, wantp)
+	wantp = &enmime.Part{
+		Parent:       test.PartExists,
+		ContentType:  "text/plain",
+		Charset:      "us-ascii",
+		PartID:       "2.1.1",
+		Encapsulated: true,
+	}
+	test.ComparePart(t, p.FirstChild, wantp)
+	if got, want := p.FirstChild.Header.Get("Subject"), "First topic"; got != want {
+		t.Errorf("Subject got: %q, want: %q", got, want)
+	}
+	test.ContentEqualsString(t, p.FirstChild.Content, "First message body")
+
+	p = p.NextSibling
+	wantp = &enmime.Part{
+		Parent:      test.PartExists,
+		FirstChild:  test.PartExists,
+		NextSibling: test.PartExists,
+		ContentType: "message/rfc822",
+		PartID:      "2.2",
+	}
+	test.ComparePart(t, p, wantp)
+	wantp = &enmime.Part{
+		Parent:       test.PartExists,
+		FirstChild:   test.PartExists,
+		ContentType:  "multipart/alternative",
+		PartID:       "2.2.0",
+		Encapsulated: true,
+	}
+	test.ComparePart(t, p.FirstChild, wantp)
+	if got, want := p.FirstChild.Header.Get("Subject"), "Second topic"; got != want {
+		t.Errorf("Subject got: %q, want: %q", got, want)
+	}
+	test.ContentEqualsString(t, p.FirstChild.FirstChild.Content, "Second message body")
+
+	// A declared Content-Type is respected
+	p = p.NextSibling
+	wantp = &enmime.Part{
+		Parent:      test.PartExists,
+		ContentType: "text/plain",
+		Charset:     "us-ascii",
+		PartID:      "2.3",
+	}
+	test.ComparePart(t, p, wantp)
+	test.ContentEqualsString(t, p.Content, "Typed digest part")
+
+	_ = digest.DepthMatchAll(func(p *enmime.Part) bool {
+		if len(p.Errors) > 0 {
+			t.Errorf("Part %s errors got: %v, want none", p.PartID, p.Errors)
+		}
+		return false
+	})
+}
+
+func TestPartWriteTo(t *testing.T) {
+	r := test.OpenTestData("parts", "textplain.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	want := string(p.Content)
+
+	// Read and WriteTo share a stream
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(p, head); err != nil {
+		t.Fatal("Unexpected read error:", err)
+	}
+	buf := &bytes.Buffer{}
+	n, err := p.WriteTo(buf)
+	if err != nil {
+		t.Fatal("Unexpected WriteTo error:", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo() returned %v, but wrote %v bytes", n, buf.Len())
+	}
+	if got := string(head) + buf.String(); got != want {
+		t.Errorf("Content got: %q, want: %q", got, want)
+	}
+
+	n, err = p.WriteTo(buf)
+	if n != 0 || err != nil {
+		t.Errorf("Second WriteTo() got: %v, %v, want: 0, nil", n, err)
+	}
+	if n, err := p.Read(head); n != 0 || err != io.EOF {
+		t.Errorf("Read() after WriteTo() got: %v, %v, want: 0, EOF", n, err)
+	}
+}
+
+func TestPartWriteToStream(t *testing.T) {
+	want, err := enmime.ReadParts(test.OpenTestData("parts", "bin-attach.raw"))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	buf := &bytes.Buffer{}
+	parser := enmime.NewParser()
+	parser.StreamContent = func(p *enmime.Part) error {
+		if p.FileName == "" {
+			return nil
+		}
+		_, err := io.Copy(buf, p)
+		return err
+	}
+	if _, err := parser.ReadParts(test.OpenTestData("parts", "bin-attach.raw")); err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	wantp := want.DepthMatchFirst(func(p *enmime.Part) bool { return p.FileName != "" })
+	test.ContentEqualsBytes(t, buf.Bytes(), wantp.Content)
+}
+
+func TestPreamble(t *testing.T) {
+	r := test.OpenTestData("parts", "preamble.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	want := "This is a multi-part message in MIME format.\r\n" +
+		"Parts are separated by --Enmime-Test-100 lines.\r\n"
+	if got := string(p.Preamble); got != want {
+		t.Errorf("Preamble got: %q, want: %q", got, want)
+	}
+	if got, want := string(p.Epilogue), "This is the epilogue.\r\n"; got != want {
+		t.Errorf("Epilogue got: %q, want: %q", got, want)
+	}
+	if len(p.Errors) != 0 {
+		t.Errorf("Errors got: %v, want none", p.Errors)
+	}
+
+	wantp := &enmime.Part{
+		Parent:      test.PartExists,
+		NextSibling: test.PartExists,
+		ContentType: "text/plain",
+		Charset:     "us-ascii",
+		PartID:      "1",
+	}
+	test.ComparePart(t, p.FirstChild, wantp)
+	test.ContentEqualsString(t, p.FirstChild.Content, "Section one")
+	if p.FirstChild.Preamble != nil {
+		t.Errorf("Leaf Preamble got: %q, want nil", p.FirstChild.Preamble)
+	}
+}
+
+func TestPartIsBinary(t *testing.T) {
+	testCases := []struct {
+		cte  string
+		want bool
+	}{
+		{"", false},
+		{"7bit", false},
+		{"8bit", false},
+		{"base64", false},
+		{"quoted-printable", false},
+		{"binary", true},
+		{"BINARY", true},
+		{" binary (raw octets)", true},
+	}
+	for _, tc := range testCases {
+		p := enmime.NewPart(nil, "application/octet-stream")
+		if tc.cte != "" {
+			p.SetHeader("Content-Transfer-Encoding", tc.cte)
+		}
+		if got := p.IsBinary(); got != tc.want {
+			t.Errorf("IsBinary() with CTE %q got: %v, want: %v", tc.cte, got, tc.want)
+		}
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	raw, err := ioutil.ReadAll(test.OpenTestData("mail", "attachment.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parser := enmime.NewParser()
+	parser.MaxBodySize = int64(len(raw))
+	if _, err := parser.ReadParts(bytes.NewReader(raw)); err != nil {
+		t.Fatal("Unexpected parse error at exact size:", err)
+	}
+
+	// Exceed the limit within the content of the second part
+	parser.MaxBodySize = int64(bytes.Index(raw, []byte("PGh0bWw+")) + 2)
+	p, err := parser.ReadParts(bytes.NewReader(raw))
+	if err != enmime.ErrMessageTooLarge {
+		t.Fatalf("ReadParts() error got: %v, want: %v", err, enmime.ErrMessageTooLarge)
+	}
+	if p == nil {
+		t.Fatal("ReadParts() should return the partial Part tree")
+	}
+	if got, want := p.Header.Get("Subject"), "Attachment"; got != want {
+		t.Errorf("Subject got: %q, want: %q", got, want)
+	}
+	test.ContentEqualsString(t, p.FirstChild.Content, "A text section")
+	if p.FirstChild.NextSibling == nil {
+		t.Fatal("Second part should be present")
+	}
+	if got, want := p.FirstChild.NextSibling.FileName, "test.html"; got != want {
+		t.Errorf("FileName got: %q, want: %q", got, want)
+	}
+
+	// Exceed the limit within the header
+	parser.MaxBodySize = 10
+	p, err = parser.ReadParts(bytes.NewReader(raw))
+	if err != enmime.ErrMessageTooLarge {
+		t.Fatalf("ReadParts() error got: %v, want: %v", err, enmime.ErrMessageTooLarge)
+	}
+	if p == nil {
+		t.Fatal("ReadParts() should return the partial Part tree")
+	}
+
+	if _, err := parser.ReadEnvelope(bytes.NewReader(raw)); err != enmime.ErrMessageTooLarge {
+		t.Errorf("ReadEnvelope() error got: %v, want: %v", err, enmime.ErrMessageTooLarge)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	r := test.OpenTestData("parts", "bad-ctype.raw")
+	_, err := enmime.ReadParts(r)
+	perr, ok := err.(*enmime.ParseError)
+	if !ok {
+		t.Fatalf("ReadParts() error got: %#v, want: *ParseError", err)
+	}
+	if perr.Stage != enmime.StageHeader {
+		t.Errorf("Stage got: %q, want: %q", perr.Stage, enmime.StageHeader)
+	}
+	if got, want := perr.Boundary, "Enmime-Test-100"; got != want {
+		t.Errorf("Boundary got: %q, want: %q", got, want)
+	}
+	if perr.Err == nil || perr.Unwrap() != perr.Err {
+		t.Errorf("Unwrap() got: %v, want: %v", perr.Unwrap(), perr.Err)
+	}
+	want := "error at boundary Enmime-Test-100: " + perr.Err.Error()
+	if got := perr.Error(); got != want {
+		t.Errorf("Error() got: %q, want: %q", got, want)
+	}
+
+	// Top level errors have no boundary
+	_, err = enmime.ReadParts(strings.NewReader("Content-Type: /plain\r\n\r\nbody"))
+	perr, ok = err.(*enmime.ParseError)
+	if !ok {
+		t.Fatalf("ReadParts() error got: %#v, want: *ParseError", err)
+	}
+	if perr.Stage != enmime.StageHeader || perr.Boundary != "" {
+		t.Errorf("ParseError got: %+v, want header stage without boundary", perr)
+	}
+	if got, want := perr.Error(), perr.Err.Error(); got != want {
+		t.Errorf("Error() got: %q, want: %q", got, want)
+	}
+}
+
+func TestContentTypeNoSubtype(t *testing.T) {
+	r := test.OpenTestData("parts", "ctype-no-subtype.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	p = p.FirstChild
+	wantp := &enmime.Part{
+		Parent:      test.PartExists,
+		NextSibling: test.PartExists,
+		ContentType: "text/plain",
+		Charset:     "iso-8859-1",
+		PartID:      "1",
+	}
+	test.ComparePart(t, p, wantp)
+	test.ContentEqualsString(t, p.Content, "Café")
+	want := `[W] Malformed Content-Type: Content-Type "text" has no subtype, using "text/plain"`
+	if len(p.Errors) != 1 || p.Errors[0].String() != want {
+		t.Errorf("Errors got: %v, want: %v", p.Errors, want)
+	}
+
+	p = p.NextSibling
+	wantp = &enmime.Part{
+		Parent:      test.PartExists,
+		ContentType: "application/octet-stream",
+		FileName:    "logo.png",
+		PartID:      "2",
+	}
+	test.ComparePart(t, p, wantp)
+	test.ContentEqualsBytes(t, p.Content, []byte("\x89PNG\r\n"))
+	want = `[W] Malformed Content-Type: Content-Type "image" has no subtype, ` +
+		`using "application/octet-stream"`
+	if len(p.Errors) != 1 || p.Errors[0].String() != want {
+		t.Errorf("Errors got: %v, want: %v", p.Errors, want)
+	}
+}
+
+func TestDetectBase64(t *testing.T) {
+	r := test.OpenTestData("parts", "base64-no-cte.raw")
+	parser := enmime.NewParser()
+	parser.DetectBase64 = true
+	p, err := parser.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	// Text parts are left alone
+	p = p.FirstChild
+	test.ContentEqualsString(t, p.Content, "dGVzdA==")
+	if len(p.Errors) != 0 {
+		t.Errorf("Part 1 errors got: %v, want none", p.Errors)
+	}
+
+	p = p.NextSibling
+	test.ContentEqualsString(t, p.Content, "%PDF-1.4\n")
+	want := "[W] Content Encoding: Content-Transfer-Encoding was not declared, detected base64"
+	if len(p.Errors) != 1 || p.Errors[0].String() != want {
+		t.Errorf("Part 2 errors got: %v, want: %v", p.Errors, want)
+	}
+
+	p = p.NextSibling
+	test.ContentEqualsString(t, p.Content, "not base64 data")
+	if len(p.Errors) != 0 {
+		t.Errorf("Part 3 errors got: %v, want none", p.Errors)
+	}
+}
+
+func TestDetectBase64Default(t *testing.T) {
+	r := test.OpenTestData("parts", "base64-no-cte.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	p = p.FirstChild.NextSibling
+	test.ContentEqualsString(t, p.Content, "JVBERi0xLjQK")
+	if len(p.Errors) != 0 {
+		t.Errorf("Errors got: %v, want none", p.Errors)
+	}
+}
+
+func TestDetectQuotedPrintable(t *testing.T) {
+	r := test.OpenTestData("parts", "qp-declared-7bit.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	// Disabled by default
+	test.ContentContainsString(t, p.Content, "Caf=C3=A9")
+
+	r = test.OpenTestData("parts", "qp-declared-7bit.raw")
+	parser := enmime.NewParser()
+	parser.DetectQuotedPrintable = true
+	p, err = parser.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	test.ContentEqualsString(t, p.Content, "Café crème brûlée, served at the café on the corner. "+
+		"Price €5.\r\n")
+	want := "[W] Content Encoding: Content-Transfer-Encoding was declared as \"7bit\", " +
+		"detected quoted-printable"
+	if len(p.Errors) != 1 || p.Errors[0].String() != want {
+		t.Errorf("Errors got: %v, want: %v", p.Errors, want)
+	}
+
+	// Text that merely contains equals signs is left alone
+	msg := "Content-Type: text/plain; charset=us-ascii\r\n" +
+		"\r\n" +
+		"Set x = 1 and y==2, then =\r\n" +
+		"compare.\r\n"
+	p, err = parser.ReadParts(strings.NewReader(msg))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	test.ContentEqualsString(t, p.Content, "Set x = 1 and y==2, then =\r\ncompare.\r\n")
+	if len(p.Errors) != 0 {
+		t.Errorf("Errors got: %v, want none", p.Errors)
+	}
+}
+
+func TestPartContentReader(t *testing.T) {
+	r := test.OpenTestData("parts", "textplain.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	cr, err := p.ContentReader()
+	if err != nil {
+		t.Fatal("Unexpected ContentReader error:", err)
+	}
+	if _, err := cr.Seek(-5, io.SeekEnd); err != nil {
+		t.Fatal("Unexpected Seek error:", err)
+	}
+	got, err := ioutil.ReadAll(cr)
+	if err != nil {
+		t.Fatal("Unexpected read error:", err)
+	}
+	test.ContentEqualsBytes(t, got, p.Content[len(p.Content)-5:])
+
+	// Independent of Read and other ContentReaders
+	if _, err := ioutil.ReadAll(p); err != nil {
+		t.Fatal("Unexpected read error:", err)
+	}
+	cr, _ = p.ContentReader()
+	got, _ = ioutil.ReadAll(cr)
+	test.ContentEqualsBytes(t, got, p.Content)
+
+	parser := enmime.NewParser()
+	parser.StreamContent = func(p *enmime.Part) error { return nil }
+	p, err = parser.ReadParts(test.OpenTestData("parts", "textplain.raw"))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	if _, err := p.ContentReader(); err == nil {
+		t.Error("ContentReader() should return an error for streamed content")
+	}
+}
+
+func TestQuotedPrintableSloppy(t *testing.T) {
+	r := test.OpenTestData("parts", "quoted-printable-sloppy.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	want := "Lone = sign, bad =XY escape, half =4 escape, soft break with paddingcontinues here, " +
+		"café ends with ="
+	test.ContentEqualsString(t, p.Content, want)
+	wantErr := "[W] Content Encoding: Quoted-printable content was malformed: " +
+		"4 invalid escape sequences passed through"
+	if len(p.Errors) != 1 || p.Errors[0].String() != wantErr {
+		t.Errorf("Errors got: %v, want: %v", p.Errors, wantErr)
+	}
+}
+
+func TestTransferEncodingAliases(t *testing.T) {
+	enmime.RegisterTransferDecoder("X-Enmime-Upper", func(r io.Reader) io.Reader {
+		b, _ := ioutil.ReadAll(r)
+		return bytes.NewReader(bytes.ToUpper(b))
+	})
+
+	r := test.OpenTestData("parts", "x-encodings.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	p = p.FirstChild
+	test.ContentEqualsString(t, p.Content, "Base64 text")
+	if len(p.Errors) != 0 {
+		t.Errorf("Part 1 errors got: %v, want none", p.Errors)
+	}
+
+	p = p.NextSibling
+	test.ContentEqualsString(t, p.Content, "Quoted=printable text")
+	if len(p.Errors) != 0 {
+		t.Errorf("Part 2 errors got: %v, want none", p.Errors)
+	}
+
+	p = p.NextSibling
+	test.ContentEqualsString(t, p.Content, "H4sIAAAAAAAA/0tJLEkEAEIwMLEEAAAA")
+	want := "[W] Content Encoding: Content-Transfer-Encoding type \"x-gzip64\" is not supported, " +
+		"content was not decoded"
+	if len(p.Errors) != 1 || p.Errors[0].String() != want {
+		t.Errorf("Part 3 errors got: %v, want: %v", p.Errors, want)
+	}
+
+	p = p.NextSibling
+	test.ContentEqualsString(t, p.Content, "REGISTERED DECODER TEXT")
+	if len(p.Errors) != 0 {
+		t.Errorf("Part 4 errors got: %v, want none", p.Errors)
+	}
+}
+
+func TestDecodeContentEncoding(t *testing.T) {
+	r := test.OpenTestData("parts", "content-encoding.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	if string(p.FirstChild.Content) == "Compressed text" {
+		t.Error("Content should not be decompressed by default")
+	}
+
+	r = test.OpenTestData("parts", "content-encoding.raw")
+	parser := enmime.NewParser()
+	parser.DecodeContentEncoding = true
+	p, err = parser.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	p = p.FirstChild
+	test.ContentEqualsString(t, p.Content, "Compressed text")
+	if len(p.Errors) != 0 {
+		t.Errorf("Part 1 errors got: %v, want none", p.Errors)
+	}
+
+	p = p.NextSibling
+	test.ContentEqualsString(t, p.Content, "Deflated text")
+	if len(p.Errors) != 0 {
+		t.Errorf("Part 2 errors got: %v, want none", p.Errors)
+	}
+
+	p = p.NextSibling
+	want := "[W] Content Encoding: Failed to decompress gzip content: unexpected EOF"
+	if len(p.Errors) != 1 || p.Errors[0].String() != want {
+		t.Errorf("Part 3 errors got: %v, want: %v", p.Errors, want)
+	}
+
+	p = p.NextSibling
+	test.ContentEqualsString(t, p.Content, "Not compressed")
+	want = "[W] Content Encoding: Unsupported Content-Encoding type \"br\""
+	if len(p.Errors) != 1 || p.Errors[0].String() != want {
+		t.Errorf("Part 4 errors got: %v, want: %v", p.Errors, want)
+	}
+}
+
+func TestMaxDecompressedSize(t *testing.T) {
+	// 1 MiB of zeros compresses to around 1 KiB
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	_, _ = gz.Write(make([]byte, 1<<20))
+	_ = gz.Close()
+	msg := "Content-Type: application/octet-stream\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"Content-Encoding: gzip\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString(buf.Bytes()) + "\r\n"
+
+	parser := enmime.NewParser()
+	parser.DecodeContentEncoding = true
+	parser.MaxDecompressedSize = 1000
+	p, err := parser.ReadParts(strings.NewReader(msg))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	test.ContentEqualsBytes(t, p.Content, make([]byte, 1000))
+	want := "[W] Content Encoding: Failed to decompress gzip content: decompressed content exceeds " +
+		"1000 bytes, truncated"
+	if len(p.Errors) != 1 || p.Errors[0].String() != want {
+		t.Errorf("Errors got: %v, want: %v", p.Errors, want)
+	}
+
+	// MaxBodySize applies when MaxDecompressedSize is not set
+	parser.MaxDecompressedSize = 0
+	parser.MaxBodySize = 10000
+	p, err = parser.ReadParts(strings.NewReader(msg))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	if len(p.Content) != 10000 {
+		t.Errorf("Content length got: %v, want: %v", len(p.Content), 10000)
+	}
+}
+
+func TestSignedParts(t *testing.T) {
+	r := test.OpenTestData("parts", "signed.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	if !p.IsSigned() {
+		t.Fatal("IsSigned() got false, want true")
+	}
+	if p.IsEncrypted() {
+		t.Error("IsEncrypted() got true, want false")
+	}
+	if got, want := p.ContentTypeParams["protocol"], "application/pgp-signature"; got != want {
+		t.Errorf("protocol got: %q, want: %q", got, want)
+	}
+
+	signed := p.SignedContent()
+	if signed != p.FirstChild {
+		t.Fatal("SignedContent() should return the first child")
+	}
+	test.ContentEqualsString(t, signed.Content, "Signed text with trailing space\r\nCafé")
+	sig := p.Signature()
+	if sig == nil || sig.ContentType != "application/pgp-signature" {
+		t.Fatalf("Signature() got: %v, want application/pgp-signature Part", sig)
+	}
+
+	raw, err := p.RawSignedContent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"Signed text with trailing space \r\n" +
+		"Caf=C3=A9"
+	test.ContentEqualsString(t, raw, want)
+
+	// Children are not signed
+	if signed.SignedContent() != nil || signed.Signature() != nil {
+		t.Error("SignedContent() and Signature() should return nil for unsigned Parts")
+	}
+	if _, err := signed.RawSignedContent(); err == nil {
+		t.Error("RawSignedContent() should return an error for unsigned Parts")
+	}
+
+	// Streamed content is not retained
+	parser := enmime.NewParser()
+	parser.StreamContent = func(p *enmime.Part) error { return nil }
+	p, err = parser.ReadParts(test.OpenTestData("parts", "signed.raw"))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	if _, err := p.RawSignedContent(); err == nil {
+		t.Error("RawSignedContent() should return an error for streamed content")
+	}
+}
+
+func TestNormalizeLineEndings(t *testing.T) {
+	r := test.OpenTestData("parts", "line-endings.raw")
+	parser := enmime.NewParser()
+	parser.NormalizeLineEndings = true
+	p, err := parser.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	p = p.FirstChild
+	test.ContentEqualsString(t, p.Content, "Line one\nLine two")
+
+	// Attachments are not altered
+	p = p.NextSibling
+	test.ContentEqualsString(t, p.Content, "Note one\r\nNote two")
+	p = p.NextSibling
+	test.ContentEqualsBytes(t, p.Content, []byte{1, 2, '\r', '\n', 3, '\r'})
+}
+
+func TestAdjacentEncodedWordsFileName(t *testing.T) {
+	ttable := []struct {
+		name, header, want string
+	}{
+		{
+			name: "quoted",
+			header: "Content-Type: application/pdf;\r\n" +
+				" name=\"=?utf-8?B?w6lw?=\r\n =?utf-8?B?w6kucGRm?=\"\r\n",
+			want: "\u00e9p\u00e9.pdf",
+		},
+		{
+			name: "unquoted",
+			header: "Content-Type: application/pdf;\r\n" +
+				" name==?utf-8?B?w6lw?=\r\n =?utf-8?B?w6kucGRm?=\r\n",
+			want: "\u00e9p\u00e9.pdf",
+		},
+		{
+			name: "split character",
+			header: "Content-Type: application/pdf;\r\n" +
+				" name=\"=?shift_jis?B?k/qW?=\r\n =?shift_jis?B?ey5wZGY=?=\"\r\n",
+			want: "\u65e5\u672c.pdf",
+		},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := tt.header + "Content-Transfer-Encoding: base64\r\n\r\nJVBERi0xLjQK\r\n"
+			p, err := enmime.ReadParts(strings.NewReader(msg))
+			if err != nil {
+				t.Fatal("Unexpected parse error:", err)
+			}
+			if p.FileName != tt.want {
+				t.Errorf("FileName got: %q, want: %q", p.FileName, tt.want)
+			}
+			if len(p.Errors) != 0 {
+				t.Errorf("Errors got: %v, want none", p.Errors)
+			}
+		})
+	}
+}
+
+func TestContentDescription(t *testing.T) {
+	r := test.OpenTestData("parts", "content-description.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	p = p.FirstChild
+	wantp := &enmime.Part{
+		Parent:             test.PartExists,
+		NextSibling:        test.PartExists,
+		ContentType:        "text/plain",
+		ContentDescription: "Café menu",
+		Charset:            "us-ascii",
+		PartID:             "1",
+	}
+	test.ComparePart(t, p, wantp)
+
+	// Attachment without a file name uses the description
+	p = p.NextSibling
+	wantp = &enmime.Part{
+		Parent:             test.PartExists,
+		NextSibling:        test.PartExists,
+		ContentType:        "application/pdf",
+		Disposition:        "attachment",
+		FileName:           "Quarterly report.pdf",
+		ContentDescription: "Quarterly report.pdf",
+		PartID:             "2",
+	}
+	test.ComparePart(t, p, wantp)
+
+	p = p.NextSibling
+	wantp = &enmime.Part{
+		Parent:             test.PartExists,
+		ContentType:        "application/pgp-signature",
+		FileName:           "signature.asc",
+		ContentDescription: "Digital signature",
+		PartID:             "3",
+	}
+	test.ComparePart(t, p, wantp)
+}
+
+func TestPartSetContent(t *testing.T) {
+	r := test.OpenTestData("parts", "quoted-printable.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	// Partially consume the original content
+	if _, err := p.Read(make([]byte, 4)); err != nil {
+		t.Fatal("Unexpected read error:", err)
+	}
+
+	want := "Redacted ¡señor!"
+	p.SetContent([]byte(want))
+	test.ContentEqualsString(t, p.Content, want)
+	raw, _ := p.RawContent()
+	test.ContentEqualsString(t, raw, want)
+	got, err := ioutil.ReadAll(p)
+	if err != nil {
+		t.Fatal("Unexpected read error:", err)
+	}
+	test.ContentEqualsString(t, got, want)
+	if p.Charset != "utf-8" {
+		t.Errorf("Charset got: %q, want: %q", p.Charset, "utf-8")
+	}
+	if cte := p.Header.Get("Content-Transfer-Encoding"); cte != "" {
+		t.Errorf("Content-Transfer-Encoding got: %q, want it removed", cte)
+	}
+
+	// Encode selects a new transfer encoding
+	buf := &bytes.Buffer{}
+	if err := p.Encode(buf); err != nil {
+		t.Fatal("Unexpected encode error:", err)
+	}
+	p, err = enmime.ReadParts(buf)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	test.ContentEqualsString(t, p.Content, want)
+}
+
+func TestPartKind(t *testing.T) {
+	ttable := []struct {
+		name string
+		part *enmime.Part
+		want enmime.PartKind
+	}{
+		{"empty", &enmime.Part{}, enmime.PartKindText},
+		{"plain", &enmime.Part{ContentType: "text/plain"}, enmime.PartKindText},
+		{"html inline", &enmime.Part{ContentType: "text/html", Disposition: "inline"},
+			enmime.PartKindText},
+		{"html inline cid", &enmime.Part{ContentType: "text/html", Disposition: "inline",
+			ContentID: "part1"}, enmime.PartKindInline},
+		{"html inline filename", &enmime.Part{ContentType: "text/html", Disposition: "inline",
+			FileName: "body.html"}, enmime.PartKindText},
+		{"html inline location", &enmime.Part{ContentType: "text/html", Disposition: "inline",
+			ContentLocation: "http://example.com/body.html"}, enmime.PartKindInline},
+		{"image inline", &enmime.Part{ContentType: "image/png", Disposition: "inline"},
+			enmime.PartKindAttachment},
+		{"image inline cid", &enmime.Part{ContentType: "image/png", Disposition: "inline",
+			ContentID: "image1"}, enmime.PartKindInline},
+		{"plain attachment", &enmime.Part{ContentType: "text/plain", Disposition: "attachment"},
+			enmime.PartKindAttachment},
+		{"upper case attachment", &enmime.Part{ContentType: "text/plain", Disposition: "ATTACHMENT"},
+			enmime.PartKindAttachment},
+		{"mixed case inline", &enmime.Part{ContentType: "image/png", Disposition: "Inline",
+			ContentID: "image1"}, enmime.PartKindInline},
+		{"mixed case inline html", &enmime.Part{ContentType: "text/html", Disposition: "Inline"},
+			enmime.PartKindText},
+		{"unknown disposition", &enmime.Part{ContentType: "text/plain", Disposition: "x-attachment"},
+			enmime.PartKindText},
+		{"octet stream", &enmime.Part{ContentType: "application/octet-stream"},
+			enmime.PartKindAttachment},
+		{"octet stream inline", &enmime.Part{ContentType: "application/octet-stream",
+			Disposition: "inline", ContentID: "part1"}, enmime.PartKindAttachment},
+		{"mixed", &enmime.Part{ContentType: "multipart/mixed"}, enmime.PartKindMultipart},
+		{"mixed attachment", &enmime.Part{ContentType: "Multipart/Mixed", Disposition: "attachment"},
+			enmime.PartKindMultipart},
+		{"calendar", &enmime.Part{ContentType: "text/calendar"}, enmime.PartKindOther},
+		{"calendar inline", &enmime.Part{ContentType: "text/calendar", Disposition: "inline"},
+			enmime.PartKindOther},
+		{"markdown inline", &enmime.Part{ContentType: "text/markdown", Disposition: "inline"},
+			enmime.PartKindOther},
+		{"image", &enmime.Part{ContentType: "image/png"}, enmime.PartKindOther},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.part.Kind(); got != tt.want {
+				t.Errorf("Kind() got: %v, want: %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOnPart(t *testing.T) {
+	for _, tt := range []struct {
+		dir, filename string
+	}{
+		{"parts", "nestedmulti.raw"},
+		{"mail", "attached-message.raw"},
+	} {
+		t.Run(tt.filename, func(t *testing.T) {
+			var seen []*enmime.Part
+			parser := enmime.NewParser()
+			parser.ParseEncapsulated = true
+			parser.OnPart = func(p *enmime.Part) {
+				if p.ContentType == "" {
+					t.Errorf("Part %v header was not parsed", p.PartID)
+				}
+				if p.Content != nil || p.FirstChild != nil {
+					t.Errorf("Part %v content was already read", p.PartID)
+				}
+				seen = append(seen, p)
+			}
+			root, err := parser.ReadParts(test.OpenTestData(tt.dir, tt.filename))
+			if err != nil {
+				t.Fatal("Unexpected parse error:", err)
+			}
+
+			// Called for every Part, containers included, in document order
+			want := root.DepthMatchAll(func(p *enmime.Part) bool { return true })
+			if len(seen) != len(want) {
+				t.Fatalf("OnPart called for %v parts, want: %v", len(seen), len(want))
+			}
+			for i := range want {
+				if seen[i] != want[i] {
+					t.Errorf("OnPart call %v got Part %v, want Part %v", i, seen[i].PartID,
+						want[i].PartID)
+				}
+			}
+		})
+	}
+}
+
+func TestMaxParts(t *testing.T) {
+	// nestedmulti.raw has 6 Parts, including the root
+	parser := enmime.NewParser()
+	parser.MaxParts = 6
+	p, err := parser.ReadParts(test.OpenTestData("parts", "nestedmulti.raw"))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	if len(p.Errors) != 0 {
+		t.Errorf("Errors got: %v, want none", p.Errors)
+	}
+
+	parser.MaxParts = 3
+	p, err = parser.ReadParts(test.OpenTestData("parts", "nestedmulti.raw"))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	count := len(p.DepthMatchAll(func(*enmime.Part) bool { return true }))
+	if count != 3 {
+		t.Errorf("Part count got: %v, want: 3", count)
+	}
+	want := "[E] Maximum Parts Exceeded: Message exceeded maximum of 3 parts, parsing stopped"
+	if len(p.Errors) != 1 || p.Errors[0].String() != want {
+		t.Errorf("Errors got: %v, want: %v", p.Errors, want)
+	}
+
+	// The count is per message
+	p, err = parser.ReadParts(test.OpenTestData("parts", "multimixed.raw"))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	if len(p.Errors) != 0 {
+		t.Errorf("Errors got: %v, want none", p.Errors)
+	}
+}
+
+func TestMaxPartsTruncatedTree(t *testing.T) {
+	parser := enmime.NewParser()
+	parser.MaxParts = 4
+	p, err := parser.ReadParts(test.OpenTestData("parts", "nested-epilogue.raw"))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	want := "[E] Maximum Parts Exceeded: Message exceeded maximum of 4 parts, parsing stopped"
+	if len(p.Errors) != 1 || p.Errors[0].String() != want {
+		t.Errorf("Errors got: %v, want: %v", p.Errors, want)
+	}
+
+	// The Parts parsed match those of the complete tree, enclosing multiparts are completed
+	var ids []string
+	for _, c := range p.DepthMatchAll(func(*enmime.Part) bool { return true }) {
+		ids = append(ids, c.PartID)
+	}
+	if got, want := strings.Join(ids, " "), "0 1 2.0 2.1"; got != want {
+		t.Errorf("PartIDs got: %q, want: %q", got, want)
+	}
+	test.ContentEqualsString(t, p.Preamble, "Preamble")
+	test.ContentEqualsString(t, p.Epilogue, "Outer epilogue\r\n")
+	inner := p.FirstChild.NextSibling
+	test.ContentEqualsString(t, inner.Epilogue, "Inner epilogue")
+	if inner.FirstChild.NextSibling != nil {
+		t.Errorf("Part 2.2 got: %v, want nil", inner.FirstChild.NextSibling)
+	}
+	if inner.NextSibling != nil {
+		t.Errorf("Part 3 got: %v, want nil", inner.NextSibling)
+	}
+}
+
+func TestMessageTransferEncoding(t *testing.T) {
+	parser := enmime.NewParser()
+	parser.ParseEncapsulated = true
+	p, err := parser.ReadParts(test.OpenTestData("parts", "message-base64.raw"))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	p = p.FirstChild.NextSibling
+	wantp := &enmime.Part{
+		Parent:      test.PartExists,
+		FirstChild:  test.PartExists,
+		NextSibling: test.PartExists,
+		ContentType: "message/rfc822",
+		PartID:      "2",
+	}
+	test.ComparePart(t, p, wantp)
+	want := "[W] Content Encoding: Content-Type message/rfc822 may not have " +
+		"Content-Transfer-Encoding \"base64\", decoded it"
+	if len(p.Errors) != 1 || p.Errors[0].String() != want {
+		t.Errorf("Errors got: %v, want: %v", p.Errors, want)
+	}
+
+	// The encapsulated message is parsed from the decoded content
+	c := p.FirstChild
+	if got, want := c.Header.Get("Subject"), "Encapsulated"; got != want {
+		t.Errorf("Encapsulated Subject got: %q, want: %q", got, want)
+	}
+	test.ContentEqualsString(t, c.Content, "Inner body\r\n")
+
+	p = p.NextSibling
+	if got, want := p.ContentType, "message/partial"; got != want {
+		t.Errorf("ContentType got: %q, want: %q", got, want)
+	}
+	if len(p.Errors) != 0 {
+		t.Errorf("Errors got: %v, want none for 7bit", p.Errors)
+	}
+}
+
+func TestMultipartTransferEncoding(t *testing.T) {
+	r := test.OpenTestData("parts", "multipart-base64.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	p = p.FirstChild
+	wantp := &enmime.Part{
+		Parent:      test.PartExists,
+		FirstChild:  test.PartExists,
+		NextSibling: test.PartExists,
+		ContentType: "multipart/alternative",
+		PartID:      "1.0",
+	}
+	test.ComparePart(t, p, wantp)
+	want := "[W] Content Encoding: Multipart content may not have Content-Transfer-Encoding " +
+		"\"base64\", decoded it"
+	if len(p.Errors) != 1 || p.Errors[0].String() != want {
+		t.Errorf("Errors got: %v, want: %v", p.Errors, want)
+	}
+
+	c := p.FirstChild
+	wantp = &enmime.Part{
+		Parent:      test.PartExists,
+		NextSibling: test.PartExists,
+		ContentType: "text/plain",
+		Charset:     "us-ascii",
+		PartID:      "1.1",
+	}
+	test.ComparePart(t, c, wantp)
+	test.ContentEqualsString(t, c.Content, "First part")
+
+	c = c.NextSibling
+	wantp = &enmime.Part{
+		Parent:      test.PartExists,
+		ContentType: "text/html",
+		Charset:     "us-ascii",
+		PartID:      "1.2",
+	}
+	test.ComparePart(t, c, wantp)
+	test.ContentEqualsString(t, c.Content, "<p>Second part</p>")
+
+	p = p.NextSibling
+	test.ContentEqualsString(t, p.Content, "Third part")
+}
+
+func TestEmptyContent(t *testing.T) {
+	encodings := []string{"", "7bit", "8bit", "binary", "base64", "quoted-printable", "x-uuencode"}
+	for _, cte := range encodings {
+		t.Run("cte "+cte, func(t *testing.T) {
+			header := "Content-Type: text/plain; charset=us-ascii\r\n"
+			if cte != "" {
+				header += "Content-Transfer-Encoding: " + cte + "\r\n"
+			}
+			msg := "Content-Type: multipart/alternative; boundary=\"Enmime-Test-100\"\r\n" +
+				"\r\n" +
+				"--Enmime-Test-100\r\n" +
+				header +
+				"\r\n" +
+				"--Enmime-Test-100--\r\n"
+
+			root, err := enmime.ReadParts(strings.NewReader(msg))
+			if err != nil {
+				t.Fatal("Unexpected parse error:", err)
+			}
+			p := root.FirstChild
+			if p == nil {
+				t.Fatal("Part should not be nil")
+			}
+			if len(p.Errors) != 0 {
+				t.Errorf("Errors got: %v, want none", p.Errors)
+			}
+			if got := p.ContentLength(); got != 0 {
+				t.Errorf("ContentLength() got: %v, want: 0", got)
+			}
+			if p.Content == nil {
+				t.Error("Content got: nil, want empty")
+			}
+			n, err := p.Read(make([]byte, 10))
+			if n != 0 || err != io.EOF {
+				t.Errorf("Read() got: %v, %v, want: 0, %v", n, err, io.EOF)
+			}
+		})
+	}
+}
+
+func TestStrictCharset(t *testing.T) {
+	r := test.OpenTestData("parts", "undecodable-charset.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	test.ContentEqualsString(t, p.FirstChild.Content, "Caf\xe9")
+	test.ContentEqualsString(t, p.FirstChild.NextSibling.Content, "Bad \xff byte")
+
+	r = test.OpenTestData("parts", "undecodable-charset.raw")
+	parser := enmime.NewParser()
+	parser.StrictCharset = true
+	p, err = parser.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	p = p.FirstChild
+	test.ContentEqualsString(t, p.Content, "Caf\uFFFD")
+	if len(p.Errors) != 1 || p.Errors[0].Name != enmime.ErrorCharsetConversion {
+		t.Errorf("Errors got: %v, want a %v warning", p.Errors, enmime.ErrorCharsetConversion)
+	}
+
+	p = p.NextSibling
+	test.ContentEqualsString(t, p.Content, "Bad \uFFFD byte")
+}
+
+func TestSniffContentType(t *testing.T) {
+	r := test.OpenTestData("parts", "octet-stream.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	for c := p.FirstChild; c != nil; c = c.NextSibling {
+		if c.DetectedContentType != "" {
+			t.Errorf("Part %v DetectedContentType == %q, want empty when disabled", c.PartID,
+				c.DetectedContentType)
+		}
+	}
+
+	r = test.OpenTestData("parts", "octet-stream.raw")
+	parser := enmime.NewParser()
+	parser.SniffContentType = true
+	p, err = parser.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	want := []struct {
+		contentType, detected string
+	}{
+		{"application/octet-stream", "image/png"},
+		{"application/octet-stream", "application/pdf"},
+		{"application/octet-stream", ""},
+		{"image/gif", ""},
+	}
+	c := p.FirstChild
+	for i, w := range want {
+		if c == nil {
+			t.Fatalf("Part %v is missing", i+1)
+		}
+		if c.ContentType != w.contentType {
+			t.Errorf("Part %v ContentType == %q, want: %q", c.PartID, c.ContentType, w.contentType)
+		}
+		if c.DetectedContentType != w.detected {
+			t.Errorf("Part %v DetectedContentType == %q, want: %q", c.PartID,
+				c.DetectedContentType, w.detected)
+		}
+		c = c.NextSibling
+	}
+}
+
+func TestPartRawHeader(t *testing.T) {
+	rootHeader := "DKIM-Signature: v=1; a=rsa-sha256; d=example.com;\r\n" +
+		"\th=from:subject; bh=abc=; b=def=\r\n" +
+		"from: Sender <sender@example.com>\r\n" +
+		"SUBJECT:  Mixed   case\r\n" +
+		"Content-Type: multipart/mixed; boundary=\"Enmime-Test-100\"\r\n"
+	partHeader := "Content-Type: text/plain;\n charset=us-ascii\n"
+	msg := rootHeader + "\r\n" +
+		"--Enmime-Test-100\r\n" +
+		partHeader + "\n" +
+		"Body\r\n" +
+		"--Enmime-Test-100--\r\n"
+
+	p, err := enmime.ReadParts(strings.NewReader(msg))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	test.ContentEqualsString(t, p.RawHeader(), rootHeader)
+	test.ContentEqualsString(t, p.FirstChild.RawHeader(), partHeader)
+	test.ContentEqualsString(t, p.FirstChild.Content, "Body")
+
+	// Header without a body
+	p, err = enmime.ReadParts(strings.NewReader("Subject: Only\r\n X"))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	test.ContentEqualsString(t, p.RawHeader(), "Subject: Only\r\n X")
+
+	if got := enmime.NewPart(nil, "text/plain").RawHeader(); got != nil {
+		t.Errorf("RawHeader() got: %q, want nil", got)
+	}
+}
+
+func TestReadPartsHeaderOnly(t *testing.T) {
+	ttable := []struct {
+		name, msg string
+	}{
+		{"blank line", "Subject: Headers\r\nContent-Type: text/plain\r\n\r\n"},
+		{"line break", "Subject: Headers\r\nContent-Type: text/plain\r\n"},
+		{"eof", "Subject: Headers\r\nContent-Type: text/plain"},
+		{"lf", "Subject: Headers\nContent-Type: text/plain\n\n"},
+		{"multipart", "Subject: Headers\r\nContent-Type: multipart/mixed; boundary=b\r\n\r\n"},
+		{"multipart eof", "Subject: Headers\r\nContent-Type: multipart/mixed; boundary=b"},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := enmime.ReadParts(strings.NewReader(tt.msg))
+			if err != nil {
+				t.Fatal("Unexpected parse error:", err)
+			}
+			if got, want := p.Header.Get("Subject"), "Headers"; got != want {
+				t.Errorf("Subject got: %q, want: %q", got, want)
+			}
+			if p.Header.Get("Content-Type") == "" {
+				t.Error("Content-Type header is missing")
+			}
+			if len(p.Content) != 0 || p.FirstChild != nil {
+				t.Errorf("Part got content %q and child %v, want neither", p.Content, p.FirstChild)
+			}
+			if len(p.Errors) != 0 {
+				t.Errorf("Errors got: %v, want none", p.Errors)
+			}
+		})
+	}
+}
+
+func TestReadPartsBytes(t *testing.T) {
+	b, err := ioutil.ReadAll(test.OpenTestData("parts", "multimixed.raw"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := enmime.ReadPartsBytes(b)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	wantp := &enmime.Part{
+		FirstChild:  test.PartExists,
+		ContentType: "multipart/mixed",
+		PartID:      "0",
+	}
+	test.ComparePart(t, p, wantp)
+	test.ContentContainsString(t, p.FirstChild.Content, "Section one")
+
+	parser := enmime.NewParser()
+	parser.MaxBodySize = 10
+	if _, err := parser.ReadPartsBytes(b); err != enmime.ErrMessageTooLarge {
+		t.Errorf("ReadPartsBytes() error got: %v, want: %v", err, enmime.ErrMessageTooLarge)
+	}
+}
+
+func TestByteOrderMark(t *testing.T) {
+	ttable := []struct {
+		name     string
+		preserve bool
+		plain    string
+		html     string
+	}{
+		{"stripped", false, "Hello plain", "<p>Hello</p>"},
+		{"preserved", true, "\ufeffHello plain", "\ufeff<p>Hello</p>"},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			r := test.OpenTestData("parts", "bom.raw")
+			parser := enmime.NewParser()
+			parser.PreserveBOM = tt.preserve
+			p, err := parser.ReadParts(r)
+			if err != nil {
+				t.Fatal("Unexpected parse error:", err)
+			}
+
+			wantp := &enmime.Part{
+				Parent:      test.PartExists,
+				NextSibling: test.PartExists,
+				ContentType: "text/plain",
+				Charset:     "utf-8",
+				PartID:      "1",
+			}
+			test.ComparePart(t, p.FirstChild, wantp)
+			test.ContentEqualsString(t, p.FirstChild.Content, tt.plain)
+
+			wantp = &enmime.Part{
+				Parent:      test.PartExists,
+				ContentType: "text/html",
+				Charset:     "utf-16le",
+				PartID:      "2",
+			}
+			test.ComparePart(t, p.FirstChild.NextSibling, wantp)
+			test.ContentEqualsString(t, p.FirstChild.NextSibling.Content, tt.html)
+		})
+	}
+}
+
+func TestLineEnding(t *testing.T) {
+	ttable := []struct {
+		name  string
+		input string
+		want  string
+		mixed bool
+	}{
+		{"empty", "", "", false},
+		{"crlf", "Subject: Test\r\n\r\nOne\r\nTwo\r\n", "\r\n", false},
+		{"lf", "Subject: Test\n\nOne\nTwo\n", "\n", false},
+		{"mostly crlf", "Subject: Test\r\n\r\nOne\r\nTwo\n", "\r\n", true},
+		{"mostly lf", "Subject: Test\n\nOne\r\nTwo\n", "\n", true},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := enmime.ReadParts(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal("Unexpected parse error:", err)
+			}
+			if p.LineEnding != tt.want {
+				t.Errorf("LineEnding got: %q, want: %q", p.LineEnding, tt.want)
+			}
+			mixed := false
+			for _, e := range p.Errors {
+				if e.Name == enmime.ErrorMixedLineEndings {
+					mixed = true
+				}
+			}
+			if mixed != tt.mixed {
+				t.Errorf("%v warning got: %v, want: %v", enmime.ErrorMixedLineEndings, mixed,
+					tt.mixed)
+			}
+		})
+	}
+}
+
+func TestLineEndingEncode(t *testing.T) {
+	msg := "Subject: Test\n" +
+		"Content-Type: multipart/mixed; boundary=Enmime-Test\n" +
+		"\n" +
+		"--Enmime-Test\n" +
+		"Content-Type: text/plain; charset=us-ascii\n" +
+		"\n" +
+		"One\n" +
+		"Two\n" +
+		"--Enmime-Test--\n"
+	p, err := enmime.ReadParts(strings.NewReader(msg))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	b := &bytes.Buffer{}
+	if err := p.Encode(b); err != nil {
+		t.Fatal("Encode() returned error:", err)
+	}
+	if bytes.Contains(b.Bytes(), []byte{'\r'}) {
+		t.Errorf("Encode() got: %q, want LF line endings", b.String())
+	}
+	got, err := enmime.ReadParts(b)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	if got.LineEnding != "\n" {
+		t.Errorf("LineEnding got: %q, want: %q", got.LineEnding, "\n")
+	}
+	// Encode separates content from the boundary with an additional line ending
+	test.ContentEqualsString(t, bytes.TrimSpace(got.FirstChild.Content), "One\nTwo")
+}
+
+func TestUnknownTransferEncodingAs8Bit(t *testing.T) {
+	r := test.OpenTestData("parts", "unknown-cte-charset.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	// Content is left as is by default
+	test.ContentEqualsBytes(t, p.Content, []byte("Caf\xe9 cr\xe8me\r\n"))
+	want := "[W] Content Encoding: Unrecognized Content-Transfer-Encoding type \"weird\""
+	if len(p.Errors) != 1 || p.Errors[0].String() != want {
+		t.Errorf("Errors got: %v, want: %v", p.Errors, want)
+	}
+
+	r = test.OpenTestData("parts", "unknown-cte-charset.raw")
+	parser := enmime.NewParser()
+	parser.UnknownTransferEncodingAs8Bit = true
+	p, err = parser.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	test.ContentEqualsString(t, p.Content, "Café crème\r\n")
+	want = "[W] Content Encoding: Unrecognized Content-Transfer-Encoding type \"weird\", " +
+		"treated as 8bit"
+	if len(p.Errors) != 1 || p.Errors[0].String() != want {
+		t.Errorf("Errors got: %v, want: %v", p.Errors, want)
+	}
+}
+
+func TestMultipartNoBoundary(t *testing.T) {
+	r := test.OpenTestData("parts", "multipart-no-boundary.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	wantp := &enmime.Part{
+		FirstChild:  test.PartExists,
+		ContentType: "multipart/mixed",
+		Boundary:    "Enmime-Test-100",
+		PartID:      "0",
+	}
+	test.ComparePart(t, p, wantp)
+	want := "[W] Missing Boundary: Content-Type multipart/mixed has no boundary parameter, " +
+		"using \"Enmime-Test-100\" found in content"
+	if len(p.Errors) != 1 || p.Errors[0].String() != want {
+		t.Errorf("Errors got: %v, want: %v", p.Errors, want)
+	}
+
+	wantp = &enmime.Part{
+		Parent:      test.PartExists,
+		NextSibling: test.PartExists,
+		ContentType: "text/plain",
+		Charset:     "us-ascii",
+		PartID:      "1",
+	}
+	test.ComparePart(t, p.FirstChild, wantp)
+	test.ContentEqualsString(t, p.FirstChild.Content, "A text section")
+
+	// Without delimiter lines the content is a single part
+	wantp = &enmime.Part{
+		Parent:      test.PartExists,
+		ContentType: "multipart/alternative",
+		PartID:      "2",
+	}
+	c := p.FirstChild.NextSibling
+	test.ComparePart(t, c, wantp)
+	test.ContentEqualsString(t, c.Content, "Opaque body")
+	want = "[W] Missing Boundary: Content-Type multipart/alternative has no boundary parameter, " +
+		"content treated as a single part"
+	if len(c.Errors) != 1 || c.Errors[0].String() != want {
+		t.Errorf("Errors got: %v, want: %v", c.Errors, want)
+	}
+
+	// The same applies to the root
+	r = strings.NewReader("Content-Type: multipart/mixed\r\n\r\nOpaque body\r\n")
+	p, err = enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	if p.FirstChild != nil {
+		t.Errorf("FirstChild got: %v, want nil", p.FirstChild)
+	}
+	test.ContentEqualsString(t, p.Content, "Opaque body\r\n")
+}
+
+func TestBoundaryWithSpace(t *testing.T) {
+	// The example message of RFC 2046 section 5.1.1
+	r := test.OpenTestData("parts", "rfc2046-boundary.raw")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	wantp := &enmime.Part{
+		FirstChild:  test.PartExists,
+		ContentType: "multipart/mixed",
+		Boundary:    "simple boundary",
+		PartID:      "0",
+	}
+	test.ComparePart(t, p, wantp)
+
+	wantp = &enmime.Part{
+		Parent:      test.PartExists,
+		NextSibling: test.PartExists,
+		PartID:      "1",
+	}
+	test.ComparePart(t, p.FirstChild, wantp)
+	test.ContentEqualsString(t, p.FirstChild.Content,
+		"This is implicitly typed plain US-ASCII text.\r\nIt does NOT end with a linebreak.")
+
+	wantp = &enmime.Part{
+		Parent:      test.PartExists,
+		ContentType: "text/plain",
+		Charset:     "us-ascii",
+		PartID:      "2",
+	}
+	test.ComparePart(t, p.FirstChild.NextSibling, wantp)
+	test.ContentEqualsString(t, p.FirstChild.NextSibling.Content,
+		"This is explicitly typed plain US-ASCII text.\r\nIt DOES end with a linebreak.\r\n")
+}
+
+// recordingObserver records the calls made to an enmime.Observer.
+type recordingObserver struct {
+	parsed []*enmime.Part
+	stats  []enmime.ParseStats
+}
+
+func (o *recordingObserver) PartParsed(p *enmime.Part) {
+	o.parsed = append(o.parsed, p)
+}
+
+func (o *recordingObserver) Done(stats enmime.ParseStats) {
+	o.stats = append(o.stats, stats)
+}
+
+func TestObserver(t *testing.T) {
+	o := &recordingObserver{}
+	parser := enmime.NewParser()
+	parser.Observer = o
+	root, err := parser.ReadParts(test.OpenTestData("parts", "nestedmulti.raw"))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	// Called for every Part, children before their parent
+	want := []string{"1", "2.1", "2.2", "2.3", "2.0", "0"}
+	if len(o.parsed) != len(want) {
+		t.Fatalf("PartParsed called for %v parts, want: %v", len(o.parsed), len(want))
+	}
+	for i, p := range o.parsed {
+		if p.PartID != want[i] {
+			t.Errorf("PartParsed call %v got Part %v, want Part %v", i, p.PartID, want[i])
+		}
+	}
+	if o.parsed[len(o.parsed)-1] != root {
+		t.Error("PartParsed was not called last for the root Part")
+	}
+
+	if len(o.stats) != 1 {
+		t.Fatalf("Done called %v times, want: 1", len(o.stats))
+	}
+	stats := o.stats[0]
+	if stats.BytesRead != 728 {
+		t.Errorf("BytesRead got: %v, want: %v", stats.BytesRead, 728)
+	}
+	if stats.Parts != 6 {
+		t.Errorf("Parts got: %v, want: %v", stats.Parts, 6)
+	}
+	if stats.MaxDepth != 2 {
+		t.Errorf("MaxDepth got: %v, want: %v", stats.MaxDepth, 2)
+	}
+	if stats.Errors != 0 {
+		t.Errorf("Errors got: %v, want: %v", stats.Errors, 0)
+	}
+	if stats.Err != nil {
+		t.Errorf("Err got: %v, want nil", stats.Err)
+	}
+	if stats.Duration <= 0 {
+		t.Errorf("Duration got: %v, want > 0", stats.Duration)
+	}
+
+	// Done is called when parsing fails
+	o = &recordingObserver{}
+	parser.Observer = o
+	parser.ReadParts(iotest.TimeoutReader(strings.NewReader("Subject: Incomplete\r\n")))
+	if len(o.stats) != 1 {
+		t.Fatalf("Done called %v times, want: 1", len(o.stats))
+	}
+	if o.stats[0].Err == nil {
+		t.Error("Err got nil, want an error")
+	}
+	if len(o.parsed) != 0 {
+		t.Errorf("PartParsed called for %v parts after an error, want none", len(o.parsed))
+	}
+}
+
+func TestContentTypeValuelessParam(t *testing.T) {
+	r := strings.NewReader("Content-Type: text/plain; charset\r\n\r\nPlain text\r\n")
+	p, err := enmime.ReadParts(r)
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	wantp := &enmime.Part{
+		ContentType: "text/plain",
+		PartID:      "0",
+	}
+	test.ComparePart(t, p, wantp)
+	test.ContentEqualsString(t, p.Content, "Plain text\r\n")
+	want := "[W] Malformed Content-Type: Content-Type \"text/plain; charset\" has parameters " +
+		"without a value [\"charset\"], using \"text/plain\""
+	if len(p.Errors) != 1 || p.Errors[0].String() != want {
+		t.Errorf("Errors got: %v, want: %v", p.Errors, want)
+	}
+
+	e, err := enmime.EnvelopeFromPart(p)
+	if err != nil {
+		t.Fatal("Unexpected error:", err)
+	}
+	if e.Text != "Plain text\r\n" {
+		t.Errorf("Text got: %q, want: %q", e.Text, "Plain text\r\n")
+	}
+	if len(e.Attachments) != 0 {
+		t.Errorf("Attachments got: %v, want none", len(e.Attachments))
+	}
+}
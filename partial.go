@@ -0,0 +1,119 @@
+package enmime
+
+import (
+	"bytes"
+	"fmt"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ReassemblePartials rebuilds a message split into message/partial fragments, RFC 2046 section
+// 5.2.2.  parts holds one Part for each fragment, such as the roots of the messages that carried
+// them, in any order.  The fragments must share an id parameter, and their number parameters must
+// run from 1 to the total given by at least one of them.  The content of the fragments is joined in
+// order and parsed, using the options of the Parser the first fragment was read with.
+//
+// As the RFC requires, the header of the resulting root Part combines the Content-*, Subject,
+// Message-ID, Encrypted and MIME-Version headers of the fragmented message with the other headers
+// of fragment number 1.
+func ReassemblePartials(parts []*Part) (*Part, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("no message/partial fragments to reassemble")
+	}
+	fragments := make([]*Part, len(parts))
+	copy(fragments, parts)
+	numbers := make(map[*Part]int, len(fragments))
+	id := ""
+	total := 0
+	for _, p := range fragments {
+		if p == nil || !strings.EqualFold(p.ContentType, ctMessagePartial) {
+			return nil, fmt.Errorf("fragment is not a %s Part", ctMessagePartial)
+		}
+		if p.streamed {
+			return nil, fmt.Errorf("content of fragment Part %v was streamed", p.PartID)
+		}
+		pid := p.ContentTypeParams[hpID]
+		if pid == "" {
+			return nil, fmt.Errorf("fragment Part %v has no id parameter", p.PartID)
+		}
+		if id == "" {
+			id = pid
+		} else if pid != id {
+			return nil, fmt.Errorf("fragment id %q does not match %q", pid, id)
+		}
+		n, err := strconv.Atoi(p.ContentTypeParams[hpNumber])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("fragment of %q has invalid number parameter %q", id,
+				p.ContentTypeParams[hpNumber])
+		}
+		numbers[p] = n
+		if t := p.ContentTypeParams[hpTotal]; t != "" {
+			t, err := strconv.Atoi(t)
+			if err != nil || t < 1 || (total != 0 && t != total) {
+				return nil, fmt.Errorf("fragment %v of %q has invalid total parameter %q", n, id,
+					p.ContentTypeParams[hpTotal])
+			}
+			total = t
+		}
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("no fragment of %q has a total parameter", id)
+	}
+	sort.Slice(fragments, func(i, j int) bool {
+		return numbers[fragments[i]] < numbers[fragments[j]]
+	})
+	for i, p := range fragments {
+		switch n := numbers[p]; {
+		case n > total:
+			return nil, fmt.Errorf("fragment %v of %q exceeds the total of %v", n, id, total)
+		case n < i+1:
+			return nil, fmt.Errorf("fragment %v of %q is duplicated", n, id)
+		case n > i+1:
+			return nil, fmt.Errorf("fragment %v of %v of %q is missing", i+1, total, id)
+		}
+	}
+	if len(fragments) < total {
+		return nil, fmt.Errorf("fragment %v of %v of %q is missing", len(fragments)+1, total, id)
+	}
+
+	buf := &bytes.Buffer{}
+	for _, p := range fragments {
+		buf.Write(p.Content)
+	}
+	parser := fragments[0].parser
+	if parser == nil {
+		parser = defaultParser
+	}
+	root, err := parser.ReadPartsBytes(buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	root.Header = mergePartialHeaders(fragments[0].Header, root.Header)
+	return root, nil
+}
+
+// mergePartialHeaders returns the header of a reassembled message, built from the header of the
+// first enclosing message and that of the enclosed message per RFC 2046 section 5.2.2.2.
+func mergePartialHeaders(enclosing, enclosed textproto.MIMEHeader) textproto.MIMEHeader {
+	fromEnclosed := func(key string) bool {
+		switch textproto.CanonicalMIMEHeaderKey(key) {
+		case "Subject", "Message-Id", "Encrypted", "Mime-Version":
+			return true
+		}
+		return strings.HasPrefix(strings.ToLower(key), "content-")
+	}
+	header := make(textproto.MIMEHeader)
+	for k, v := range enclosing {
+		if !fromEnclosed(k) {
+			header[k] = append([]string(nil), v...)
+		}
+	}
+	for k, v := range enclosed {
+		if fromEnclosed(k) {
+			header[k] = append([]string(nil), v...)
+		}
+	}
+	return header
+}
@@ -0,0 +1,112 @@
+package enmime_test
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/jhillyerd/enmime"
+	"github.com/jhillyerd/enmime/internal/test"
+)
+
+// partialFragment parses a message carrying fragment number of the message identified by id, the
+// total parameter is omitted when total is zero.
+func partialFragment(t *testing.T, id string, number, total int, content string) *enmime.Part {
+	t.Helper()
+	ctype := "message/partial; id=\"" + id + "\"; number=" + strconv.Itoa(number)
+	if total > 0 {
+		ctype += "; total=" + strconv.Itoa(total)
+	}
+	msg := "From: Sender <sender@example.com>\r\n" +
+		"Subject: Fragment " + strconv.Itoa(number) + "\r\n" +
+		"Message-ID: <fragment" + strconv.Itoa(number) + "@example.com>\r\n" +
+		"X-Fragment: " + strconv.Itoa(number) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: " + ctype + "\r\n" +
+		"\r\n" +
+		content
+	p, err := enmime.ReadParts(strings.NewReader(msg))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	return p
+}
+
+func TestReassemblePartials(t *testing.T) {
+	id := "split@example.com"
+	f1 := partialFragment(t, id, 1, 0,
+		"Subject: Original\r\n"+
+			"Message-ID: <original@example.com>\r\n"+
+			"X-Original: ignored\r\n"+
+			"Content-Type: text/plain; charset=us-ascii\r\n"+
+			"\r\n"+
+			"First line\r\n")
+	f2 := partialFragment(t, id, 2, 0, "Second line\r\n")
+	f3 := partialFragment(t, id, 3, 3, "Third line\r\n")
+
+	p, err := enmime.ReassemblePartials([]*enmime.Part{f3, f1, f2})
+	if err != nil {
+		t.Fatal("ReassemblePartials() returned error:", err)
+	}
+	wantp := &enmime.Part{
+		ContentType: "text/plain",
+		Charset:     "us-ascii",
+		PartID:      "0",
+	}
+	test.ComparePart(t, p, wantp)
+	test.ContentEqualsString(t, p.Content, "First line\r\nSecond line\r\nThird line\r\n")
+
+	// Header merged from the first enclosing message and the enclosed message
+	for _, h := range []struct {
+		name, want string
+	}{
+		{"From", "Sender <sender@example.com>"},
+		{"X-Fragment", "1"},
+		{"Subject", "Original"},
+		{"Message-ID", "<original@example.com>"},
+		{"Content-Type", "text/plain; charset=us-ascii"},
+		{"X-Original", ""},
+		{"MIME-Version", ""},
+	} {
+		if got := p.Header.Get(h.name); got != h.want {
+			t.Errorf("Header %v got: %q, want: %q", h.name, got, h.want)
+		}
+	}
+}
+
+func TestReassemblePartialsErrors(t *testing.T) {
+	id := "split@example.com"
+	f1 := partialFragment(t, id, 1, 0, "Subject: Original\r\n\r\n")
+	f2 := partialFragment(t, id, 2, 0, "Second\r\n")
+	f3 := partialFragment(t, id, 3, 3, "Third\r\n")
+	f4 := partialFragment(t, id, 4, 0, "Fourth\r\n")
+	other := partialFragment(t, "other@example.com", 2, 0, "Other\r\n")
+	badTotal := partialFragment(t, id, 2, 2, "Second\r\n")
+	text, err := enmime.ReadParts(strings.NewReader("Content-Type: text/plain\r\n\r\nText\r\n"))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+
+	ttable := []struct {
+		name  string
+		parts []*enmime.Part
+	}{
+		{"none", nil},
+		{"missing", []*enmime.Part{f1, f3}},
+		{"missing last", []*enmime.Part{f1, f2}},
+		{"duplicate", []*enmime.Part{f1, f2, f2, f3}},
+		{"id mismatch", []*enmime.Part{f1, other, f3}},
+		{"exceeds total", []*enmime.Part{f1, f2, f3, f4}},
+		{"total mismatch", []*enmime.Part{f1, badTotal, f3}},
+		{"not partial", []*enmime.Part{f1, text, f3}},
+	}
+
+	for _, tt := range ttable {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := enmime.ReassemblePartials(tt.parts)
+			if err == nil {
+				t.Errorf("ReassemblePartials() got: %v, want an error", p)
+			}
+		})
+	}
+}
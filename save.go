@@ -0,0 +1,101 @@
+package enmime
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// saveFileMode is the permission of files created by Part.Save.
+const saveFileMode os.FileMode = 0644
+
+// Save writes the decoded content of this Part to the file at path, which is created with mode
+// 0644.  If path is an existing directory the file is created within it using the FileName of this
+// Part; as FileName comes from the message it must be a plain name without path separators, and an
+// existing file of that name is not overwritten.  Otherwise an existing file at path is replaced.
+// The content is written to a temporary file in the same directory, which only replaces path once
+// complete; should saving fail, an existing file is left untouched.  The modification time of the
+// file is set from the modification-date parameter of the Content-Disposition header when
+// present, RFC 2183.
+//
+// Streamed content may be saved from the Parser.StreamContent callback, it is consumed as it is
+// written.  An error is returned once the callback has returned, as the content is gone.
+func (p *Part) Save(path string) error {
+	var src io.Reader = bytes.NewReader(p.Content)
+	if p.streamed {
+		if p.Utf8Reader == nil {
+			return fmt.Errorf("Content of Part %v was streamed, it is not available", p.PartID)
+		}
+		src = p
+	}
+	reserved := false
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		name, err := p.saveFileName()
+		if err != nil {
+			return err
+		}
+		path = filepath.Join(path, name)
+		// Claim the name, failing if the file exists
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, saveFileMode)
+		if err != nil {
+			return err
+		}
+		_ = f.Close()
+		reserved = true
+	}
+	err := p.saveTemp(path, src)
+	if err != nil && reserved {
+		_ = os.Remove(path)
+	}
+	return err
+}
+
+// saveTemp writes src to a temporary file in the directory of path, then renames it to path.
+func (p *Part) saveTemp(path string, src io.Reader) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".enmime-save")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = io.Copy(f, src)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, saveFileMode)
+	}
+	if err == nil {
+		if mtime, derr := p.DispositionDate("modification-date"); derr == nil {
+			err = os.Chtimes(tmp, mtime, mtime)
+		}
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		// Don't leave a partial file behind
+		_ = os.Remove(tmp)
+	}
+	return err
+}
+
+// saveFileName returns the FileName of this Part if it is safe to use as the name of a file within
+// a directory, or an error explaining why it is not.
+func (p *Part) saveFileName() (string, error) {
+	name := p.FileName
+	switch {
+	case name == "":
+		return "", fmt.Errorf("Part %v has no file name", p.PartID)
+	case name == "." || name == ".." || strings.ContainsRune(name, 0):
+		return "", fmt.Errorf("Part %v file name %q is not valid", p.PartID, name)
+	case strings.ContainsAny(name, `/\`) || strings.ContainsRune(name, filepath.Separator):
+		return "", fmt.Errorf("Part %v file name %q contains a path separator", p.PartID, name)
+	case filepath.VolumeName(name) != "":
+		return "", fmt.Errorf("Part %v file name %q contains a volume name", p.PartID, name)
+	}
+	return name, nil
+}
@@ -0,0 +1,163 @@
+package enmime_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/jhillyerd/enmime"
+)
+
+func saveTestPart(t *testing.T, fileName string) *enmime.Part {
+	t.Helper()
+	msg := "Content-Type: application/octet-stream\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"Content-Disposition: attachment; filename=\"" + fileName + "\";\r\n" +
+		" modification-date=\"Fri, 19 Oct 2012 08:15:00 +0000\"\r\n" +
+		"\r\n" +
+		"SGVsbG8gV29ybGQ=\r\n"
+	p, err := enmime.ReadParts(strings.NewReader(msg))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	return p
+}
+
+func TestPartSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "enmime-save")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := saveTestPart(t, "hello.txt")
+	if err := p.Save(dir); err != nil {
+		t.Fatal("Save() returned error:", err)
+	}
+	path := filepath.Join(dir, "hello.txt")
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "Hello World" {
+		t.Errorf("Saved content got: %q, want: %q", got, "Hello World")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := time.Date(2012, 10, 19, 8, 15, 0, 0, time.UTC)
+	if !info.ModTime().Equal(want) {
+		t.Errorf("ModTime got: %v, want: %v", info.ModTime(), want)
+	}
+
+	// An existing file is not overwritten when saving to a directory
+	if err := p.Save(dir); err == nil {
+		t.Error("Save() to a directory containing the file should return an error")
+	}
+
+	// An explicit path is used as is, replacing an existing file
+	path = filepath.Join(dir, "other.bin")
+	if err := ioutil.WriteFile(path, []byte("Previous longer content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Save(path); err != nil {
+		t.Fatal("Save() returned error:", err)
+	}
+	got, err = ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "Hello World" {
+		t.Errorf("Saved content got: %q, want: %q", got, "Hello World")
+	}
+}
+
+func TestPartSaveUnsafeFileName(t *testing.T) {
+	parent, err := ioutil.TempDir("", "enmime-save")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(parent)
+	dir := filepath.Join(parent, "target")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"", ".", "..", "../escape.txt", "sub/file.txt", `sub\file.txt`} {
+		t.Run(name, func(t *testing.T) {
+			p := saveTestPart(t, name)
+			if err := p.Save(dir); err == nil {
+				t.Errorf("Save() with FileName %q should return an error", p.FileName)
+			}
+		})
+	}
+
+	if _, err := os.Stat(filepath.Join(parent, "escape.txt")); !os.IsNotExist(err) {
+		t.Error("Save() wrote a file outside of the target directory")
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Errorf("Save() wrote %v files to the target directory, want none", len(files))
+	}
+}
+
+func TestPartSaveFailureKeepsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "enmime-save")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "existing.bin")
+	if err := ioutil.WriteFile(path, []byte("Original content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	msg := "Content-Type: application/octet-stream\r\n" +
+		"\r\n" +
+		"Replacement content\r\n"
+	var saveErr error
+	parser := enmime.NewParser()
+	parser.StreamContent = func(p *enmime.Part) error {
+		// Fail part way through the content
+		p.Utf8Reader = iotest.TimeoutReader(iotest.OneByteReader(p.Utf8Reader))
+		saveErr = p.Save(path)
+		return nil
+	}
+	p, err := parser.ReadParts(strings.NewReader(msg))
+	if err != nil {
+		t.Fatal("Unexpected parse error:", err)
+	}
+	if saveErr != iotest.ErrTimeout {
+		t.Errorf("Save() error got: %v, want: %v", saveErr, iotest.ErrTimeout)
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "Original content" {
+		t.Errorf("File content got: %q, want: %q", got, "Original content")
+	}
+
+	// Streamed content is no longer available once StreamContent has returned
+	if err := p.Save(path); err == nil {
+		t.Error("Save() of streamed content should return an error")
+	}
+	if err := p.Save(dir); err == nil {
+		t.Error("Save() of streamed content should return an error")
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("Save() left %v files in the directory, want 1", len(files))
+	}
+}